@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/PuerkitoBio/goquery"
+	"net/url"
+	"strings"
+)
+
+// The kinds of alternate format pages found with -alternates.
+const (
+	alternateAMP  = "amp"
+	alternateHTML = "html"
+)
+
+// scheduleAlternates queues the alternate formats of the page u declares
+// in <link> tags: its AMP version and other HTML alternates, such as the
+// versions in other languages. Like links, they are only followed to the
+// allowed hosts.
+func (c *Crawler) scheduleAlternates(doc *goquery.Document, linkBase, baseURL *url.URL, u string) {
+	doc.Find("link[href][rel]").Each(func(_ int, s *goquery.Selection) {
+		var kind string
+		rels := strings.Fields(strings.ToLower(s.AttrOr("rel", "")))
+		typ := strings.ToLower(strings.TrimSpace(s.AttrOr("type", "")))
+		_, hreflang := s.Attr("hreflang")
+		for _, rel := range rels {
+			switch {
+			case rel == "amphtml":
+				kind = alternateAMP
+			case rel == "alternate" && kind == "" && (strings.HasPrefix(typ, "text/html") || typ == "" && hreflang):
+				kind = alternateHTML
+			}
+		}
+		if kind == "" {
+			return
+		}
+		ref, err := url.Parse(strings.TrimSpace(s.AttrOr("href", "")))
+		if err != nil {
+			return
+		}
+		target := linkBase.ResolveReference(ref)
+		link := removeHashFromURL(target.String())
+		if target.Scheme != "http" && target.Scheme != "https" || link == removeHashFromURL(u) || !c.hostAllowed(target, baseURL) {
+			return
+		}
+		c.recordLink(link, u)
+		c.scheduleTask(task{url: link, referrer: u, link: true, alternate: kind})
+	})
+}
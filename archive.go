@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// archiveManifest is the name of the manifest written to the -save-bodies
+// directory.
+const archiveManifest = "manifest.json"
+
+// maxArchiveName is the longest file or directory name the archive
+// writes; longer ones are shortened and made unique with a hash.
+const maxArchiveName = 200
+
+// archive saves response bodies with -save-bodies, under a directory per
+// host and the path of the URL, and records what it saved in a manifest.
+// It is shared by the crawlers of a multi-site run.
+type archive struct {
+	dir        string
+	saveErrors bool
+	limit      int64
+
+	mu    sync.Mutex
+	taken map[string]bool
+	pages []archivePage
+}
+
+// archivePage is an entry of the manifest.
+type archivePage struct {
+	URL        string      `json:"url"`
+	File       string      `json:"file"`
+	StatusCode int         `json:"status"`
+	Size       int64       `json:"size"`
+	Truncated  bool        `json:"truncated,omitempty"`
+	Header     http.Header `json:"headers,omitempty"`
+}
+
+func newArchive(dir string, saveErrors bool, limit int64) (*archive, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = math.MaxInt64
+	}
+	return &archive{dir: dir, saveErrors: saveErrors, limit: limit, taken: make(map[string]bool)}, nil
+}
+
+// archiveFile is a body being saved. Only the first limit bytes are written.
+type archiveFile struct {
+	a      *archive
+	f      *os.File
+	page   archivePage
+	limit  int64
+	failed error
+}
+
+// create opens the file for the body of the response to u, or returns nil
+// if the response isn't saved.
+func (a *archive) create(u string, res *http.Response, success bool) (*archiveFile, error) {
+	if a == nil || !success && !a.saveErrors {
+		return nil, nil
+	}
+	name := a.claim(archivePath(u))
+	f, err := a.createFile(name)
+	if err != nil {
+		// A directory on the way is a file saved earlier, or the file a
+		// directory.
+		name = a.claim(fallbackArchivePath(u))
+		if f, err = a.createFile(name); err != nil {
+			return nil, err
+		}
+	}
+	return &archiveFile{
+		a:     a,
+		f:     f,
+		page:  archivePage{URL: u, File: name, StatusCode: res.StatusCode, Header: res.Header},
+		limit: a.limit,
+	}, nil
+}
+
+func (a *archive) createFile(name string) (*os.File, error) {
+	full := filepath.Join(a.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return nil, err
+	}
+	return os.Create(full)
+}
+
+// claim returns name, or name with a number added before its extension if
+// another URL already has it, and reserves it.
+func (a *archive) claim(name string) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	candidate := name
+	ext := path.Ext(name)
+	for i := 2; a.taken[candidate]; i++ {
+		candidate = fmt.Sprintf("%s~%d%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	a.taken[candidate] = true
+	return candidate
+}
+
+func (f *archiveFile) Write(p []byte) (int, error) {
+	n := len(p)
+	if f.failed != nil {
+		return n, nil
+	}
+	if int64(len(p)) > f.limit-f.page.Size {
+		p = p[:max(f.limit-f.page.Size, 0)]
+		f.page.Truncated = true
+	}
+	written, err := f.f.Write(p)
+	f.page.Size += int64(written)
+	// A body that can't be saved is still read for its links.
+	f.failed = err
+	return n, nil
+}
+
+// close finishes the file and adds it to the manifest, or removes it if
+// the body turned out not to be needed after all.
+func (f *archiveFile) close(keep bool) (int64, error) {
+	err := f.f.Close()
+	if f.failed != nil {
+		err = f.failed
+	}
+	if !keep || err != nil {
+		os.Remove(f.f.Name())
+		return 0, err
+	}
+	f.a.mu.Lock()
+	f.a.pages = append(f.a.pages, f.page)
+	f.a.mu.Unlock()
+	return f.page.Size, nil
+}
+
+// saveBody finishes saving a body and counts it.
+func (c *Crawler) saveBody(f *archiveFile, keep bool) {
+	n, err := f.close(keep)
+	if err != nil {
+		slog.Warn("saving the body failed", "url", f.page.URL, "error", err)
+		return
+	}
+	if !keep {
+		return
+	}
+	c.lock.Lock()
+	c.savedFiles++
+	c.savedBytes += n
+	c.lock.Unlock()
+}
+
+// writeManifest writes the manifest of the saved bodies, sorted by URL.
+func (a *archive) writeManifest() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	sort.Slice(a.pages, func(i, j int) bool { return a.pages[i].URL < a.pages[j].URL })
+	b, err := json.MarshalIndent(struct {
+		Pages []archivePage `json:"pages"`
+	}{a.pages}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(a.dir, archiveManifest), append(b, '\n'), 0o644)
+}
+
+// archivePath returns where the body of u is saved, relative to the
+// archive: the host, then the path with every segment made safe as a file
+// name. A path ending in a slash or whose last segment has no extension is
+// taken as a directory and saved as its index.html, and the query, if any,
+// becomes part of the file name.
+func archivePath(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return fallbackArchivePath(u)
+	}
+	parts := []string{safeArchiveName(normalizeHost(parsed))}
+	var segments []string
+	for _, s := range strings.Split(parsed.EscapedPath(), "/") {
+		if s == "" || s == "." {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(s); err == nil {
+			s = unescaped
+		}
+		segments = append(segments, s)
+	}
+	if len(segments) == 0 || strings.HasSuffix(parsed.Path, "/") || path.Ext(segments[len(segments)-1]) == "" {
+		segments = append(segments, "index.html")
+	}
+	if parsed.RawQuery != "" {
+		last := segments[len(segments)-1]
+		ext := path.Ext(last)
+		segments[len(segments)-1] = strings.TrimSuffix(last, ext) + "?" + parsed.RawQuery + ext
+	}
+	for _, s := range segments {
+		parts = append(parts, safeArchiveName(s))
+	}
+	return strings.Join(parts, "/")
+}
+
+// fallbackArchivePath is where the body of u goes when archivePath can't be
+// used: a flat directory of files named after a hash of the URL.
+func fallbackArchivePath(u string) string {
+	sum := sha256.Sum256([]byte(u))
+	ext := ""
+	if parsed, err := url.Parse(u); err == nil {
+		ext = safeArchiveName(path.Ext(parsed.Path))
+	}
+	return "_/" + hex.EncodeToString(sum[:8]) + ext
+}
+
+// safeArchiveName escapes the characters of s that aren't safe in a file
+// name on common file systems as %XX, and shortens it if it is too long.
+func safeArchiveName(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9',
+			ch == '-', ch == '_', ch == '.', ch == '=', ch == '&', ch == ',', ch == '+':
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	name := b.String()
+	if name == "." || name == ".." {
+		name = strings.ReplaceAll(name, ".", "%2E")
+	}
+	if len(name) > maxArchiveName {
+		sum := sha256.Sum256([]byte(name))
+		ext := path.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		name = name[:maxArchiveName-17-len(ext)] + "~" + hex.EncodeToString(sum[:8]) + ext
+	}
+	return name
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The outcomes of a content assertion on a page.
+const (
+	assertionPassed       = "pass"
+	assertionFailed       = "fail"
+	assertionNotEvaluated = "not_evaluated"
+)
+
+// contentAssertion is a -assert-selector or -assert-contains check of the
+// pages whose URL matches scope, or of every page if it is nil.
+type contentAssertion struct {
+	scope    *urlPattern
+	selector cascadia.Sel
+	// check is the selector or the text, as given.
+	check    string
+	contains bool
+}
+
+func (a *contentAssertion) String() string {
+	if a.contains {
+		return "contains " + strconv.Quote(a.check)
+	}
+	return "selector " + a.check
+}
+
+// assertionOutcome is the outcome of a content assertion on a page.
+type assertionOutcome struct {
+	Assertion string `json:"assertion"`
+	Outcome   string `json:"outcome"`
+}
+
+// parseAssertions parses the -assert-selector and -assert-contains values.
+// A value can be scoped to the pages whose URL matches a pattern, as
+// compileURLPattern takes it, with "pattern=assertion"; the pattern has to
+// start with /, ^ or http for the = to be taken as a separator rather
+// than part of a selector or text.
+func parseAssertions(selectors, contains []string) ([]*contentAssertion, error) {
+	var res []*contentAssertion
+	for _, list := range []struct {
+		values   []string
+		contains bool
+	}{{selectors, false}, {contains, true}} {
+		for _, v := range list.values {
+			a := &contentAssertion{check: v, contains: list.contains}
+			if scope, check, ok := strings.Cut(v, "="); ok && isAssertionScope(scope) {
+				p, err := compileURLPattern(strings.TrimSpace(scope))
+				if err != nil {
+					return nil, fmt.Errorf("assertion %q: %w", v, err)
+				}
+				a.scope, a.check = &p, check
+			}
+			if !a.contains {
+				a.check = strings.TrimSpace(a.check)
+				sel, err := cascadia.Parse(a.check)
+				if err != nil {
+					return nil, fmt.Errorf("assertion %q: invalid selector: %w", v, err)
+				}
+				a.selector = sel
+			}
+			if a.check == "" {
+				return nil, fmt.Errorf("assertion %q: nothing to check", v)
+			}
+			res = append(res, a)
+		}
+	}
+	return res, nil
+}
+
+func isAssertionScope(s string) bool {
+	s = strings.TrimSpace(s)
+	return strings.HasPrefix(s, "/") || strings.HasPrefix(s, "^") || strings.HasPrefix(s, "http")
+}
+
+// appliesTo reports whether the assertion checks the page at u.
+func (a *contentAssertion) appliesTo(u string) bool {
+	return a.scope == nil || a.scope.match(u)
+}
+
+// checkAssertions evaluates the assertions that apply to the page at u
+// against its document.
+func (c *Crawler) checkAssertions(doc *goquery.Document, u string) []assertionOutcome {
+	var res []assertionOutcome
+	var text string
+	for _, a := range c.assertions {
+		if !a.appliesTo(u) {
+			continue
+		}
+		var ok bool
+		if a.contains {
+			if text == "" {
+				text = doc.Text()
+			}
+			ok = strings.Contains(text, a.check)
+		} else {
+			ok = cascadia.Query(doc.Nodes[0], a.selector) != nil
+		}
+		outcome := assertionPassed
+		if !ok {
+			outcome = assertionFailed
+		}
+		res = append(res, assertionOutcome{Assertion: a.String(), Outcome: outcome})
+	}
+	return res
+}
+
+// unevaluatedAssertions returns the assertions that apply to the page at
+// u as not evaluated, for a page that failed or isn't HTML.
+func (c *Crawler) unevaluatedAssertions(u string) []assertionOutcome {
+	var res []assertionOutcome
+	for _, a := range c.assertions {
+		if a.appliesTo(u) {
+			res = append(res, assertionOutcome{Assertion: a.String(), Outcome: assertionNotEvaluated})
+		}
+	}
+	return res
+}
+
+// assertionCounts returns whether any assertion on r failed, and whether
+// any wasn't evaluated.
+func assertionCounts(r Result) (failed, notEvaluated bool) {
+	for _, o := range r.Assertions {
+		switch o.Outcome {
+		case assertionFailed:
+			failed = true
+		case assertionNotEvaluated:
+			notEvaluated = true
+		}
+	}
+	return failed, notEvaluated
+}
+
+// assertionFailures returns the results with an assertion that failed,
+// sorted by URL.
+func (c *Crawler) assertionFailures() []Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var res []Result
+	for _, r := range c.results {
+		if failed, _ := assertionCounts(r); failed {
+			res = append(res, r)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return resultKey(res[i]) < resultKey(res[j]) })
+	return res
+}
+
+// reportAssertions writes the pages that failed their content assertions.
+func (c *Crawler) reportAssertions(w io.Writer) {
+	failures := c.assertionFailures()
+	if len(failures) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nFailed content assertions:")
+	for i, r := range failures {
+		if i == maxReportedFailures {
+			fmt.Fprintf(w, "  ... and %d more\n", len(failures)-i)
+			break
+		}
+		var failed []string
+		for _, o := range r.Assertions {
+			if o.Outcome == assertionFailed {
+				failed = append(failed, o.Assertion)
+			}
+		}
+		fmt.Fprintf(w, "  %s: %s\n", r.URL, strings.Join(failed, "; "))
+	}
+}
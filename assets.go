@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"golang.org/x/net/html/charset"
+	"log/slog"
+	"net/url"
+	"strings"
+)
+
+// The kinds of assets found with -sitemap-assets.
+const (
+	assetImage = "image"
+	assetVideo = "video"
+)
+
+// assetSitemap is the part of a sitemap with the image and video
+// extensions that -sitemap-assets reads. The extensions are matched by
+// their namespace, whatever prefix the sitemap binds it to.
+type assetSitemap struct {
+	URLs []struct {
+		Loc    string `xml:"loc"`
+		Images []struct {
+			Loc string `xml:"http://www.google.com/schemas/sitemap-image/1.1 loc"`
+		} `xml:"http://www.google.com/schemas/sitemap-image/1.1 image"`
+		Videos []struct {
+			ContentLoc string `xml:"http://www.google.com/schemas/sitemap-video/1.1 content_loc"`
+			PlayerLoc  string `xml:"http://www.google.com/schemas/sitemap-video/1.1 player_loc"`
+		} `xml:"http://www.google.com/schemas/sitemap-video/1.1 video"`
+	} `xml:"url"`
+}
+
+// sitemapAssets returns the images and videos listed in the sitemap data
+// at sitemapURL, by the <loc> of the <url> entry they are listed for.
+// Assets on another host than the sitemap's, such as an image CDN, are
+// left out unless the host is allowed with -allow-hosts.
+func (c *Crawler) sitemapAssets(data []byte, sitemapURL string) map[string][]task {
+	base, err := url.Parse(sitemapURL)
+	if err != nil {
+		return nil
+	}
+	var doc assetSitemap
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = charset.NewReaderLabel
+	if err := dec.Decode(&doc); err != nil {
+		slog.Warn("can't read the images and videos of the sitemap", "url", sitemapURL, "error", err)
+		return nil
+	}
+
+	assets := make(map[string][]task)
+	for _, item := range doc.URLs {
+		page := strings.TrimSpace(item.Loc)
+		add := func(u, kind string) {
+			u = strings.TrimSpace(u)
+			parsed, err := url.Parse(u)
+			if err != nil || parsed.Scheme != "http" && parsed.Scheme != "https" {
+				return
+			}
+			if !c.hostAllowed(parsed, base) {
+				slog.Debug("skipping sitemap asset on a host not allowed", "url", u, "page", page)
+				return
+			}
+			assets[page] = append(assets[page], task{url: u, referrer: page, asset: kind})
+		}
+		for _, image := range item.Images {
+			add(image.Loc, assetImage)
+		}
+		for _, video := range item.Videos {
+			add(video.ContentLoc, assetVideo)
+			add(video.PlayerLoc, assetVideo)
+		}
+	}
+	return assets
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+// authAbortAfter is the number of authentication failures in a row from
+// the primary host after which -abort-on-auth-failure stops the run.
+const authAbortAfter = 5
+
+// exitAuthFailure is the exit status of a run stopped by
+// -abort-on-auth-failure, so that broken credentials can be told apart
+// from a site with some broken pages.
+const exitAuthFailure = 3
+
+// stoppedByAuth is the stoppedBy of a run stopped by
+// -abort-on-auth-failure.
+const stoppedByAuth = "abort-on-auth-failure"
+
+// authFailure reports whether a status means the request wasn't
+// authorized.
+func authFailure(code int) bool {
+	return code == http.StatusUnauthorized || code == http.StatusForbidden
+}
+
+// abortsOnAuthFailure reports whether the run stops after authAbortAfter
+// authentication failures: if -abort-on-auth-failure says so, or by default
+// when credentials are configured, since then every page failing to
+// authorize means the credentials are wrong rather than the pages private.
+func (cfg Config) abortsOnAuthFailure() bool {
+	if cfg.AbortOnAuthFailure != nil {
+		return *cfg.AbortOnAuthFailure
+	}
+	if cfg.Username != "" || cfg.HMACSecret != "" {
+		return true
+	}
+	for name := range cfg.Headers {
+		if sensitiveHeader(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// primaryHost returns the host of the start URL or sitemap, or "" for a
+// list, whose hosts all count.
+func (c *Crawler) primaryHost() string {
+	for _, u := range []string{c.StartURL, c.SitemapURL} {
+		if parsed, err := url.Parse(u); err == nil && parsed.Host != "" {
+			return normalizeHost(parsed)
+		}
+	}
+	return ""
+}
+
+// recordAuth counts the authentication failures in a row from the primary
+// host and reports whether the run should stop because of them. The caller
+// holds the lock.
+func (c *Crawler) recordAuth(r Result) bool {
+	if r.Err != nil || r.Fresh {
+		return false
+	}
+	if host := c.primaryHost(); host != "" {
+		if parsed, err := url.Parse(r.URL); err != nil || normalizeHost(parsed) != host {
+			return false
+		}
+	}
+	if !authFailure(r.StatusCode) {
+		c.authFailuresInRow = 0
+		return false
+	}
+	c.authFailuresInRow++
+	if c.authAborted || !c.abortsOnAuthFailure() || c.authFailuresInRow < authAbortAfter {
+		return false
+	}
+	c.authAborted = true
+	return true
+}
+
+// abortOnAuthFailure stops handing out URLs, as stop does, after the
+// credentials were refused too many times in a row.
+func (c *Crawler) abortOnAuthFailure(r Result) {
+	slog.Error("stopping: the site refused to authorize the requests, check the credentials",
+		c.logArgs("failures", authAbortAfter, "status", r.StatusCode, "url", r.URL)...)
+	c.authStop.Store(true)
+	c.breaker.stop()
+	c.resume()
+}
+
+// authFailures returns the results answered with 401 Unauthorized or 403
+// Forbidden, sorted by URL.
+func (c *Crawler) authFailures() []Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var res []Result
+	for _, r := range c.results {
+		if r.Err == nil && !r.Fresh && authFailure(r.StatusCode) {
+			res = append(res, r)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return resultKey(res[i]) < resultKey(res[j]) })
+	return res
+}
+
+// reportAuthFailures writes the responses that weren't authorized, and why
+// the run stopped if it did because of them.
+func (c *Crawler) reportAuthFailures(w io.Writer, color func(c, s string) string) {
+	n := c.stats.statusCount[http.StatusUnauthorized] + c.stats.statusCount[http.StatusForbidden]
+	if n == 0 && !c.authAborted {
+		return
+	}
+	fmt.Fprintf(w, "\nAuthentication failures (401/403): %d\n", n)
+	if c.authAborted {
+		fmt.Fprintln(w, color(colorRed, fmt.Sprintf("  Stopped after %d in a row: the credentials are likely wrong", authAbortAfter)))
+	}
+	for i, r := range c.authFailures() {
+		if i == maxReportedFailures {
+			fmt.Fprintf(w, "  ... and %d more\n", n-i)
+			break
+		}
+		fmt.Fprintln(w, color(colorRed, fmt.Sprintf("  %d %s", r.StatusCode, r.URL)))
+	}
+}
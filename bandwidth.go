@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// bandwidthLimiter caps the number of response body bytes read per second.
+// A nil *bandwidthLimiter doesn't limit at all. In a multi-site run every
+// site shares the same limiter.
+type bandwidthLimiter struct {
+	mu          sync.Mutex
+	bytesPerSec float64
+	next        time.Time
+}
+
+func newBandwidthLimiter(bytesPerSec float64) *bandwidthLimiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	return &bandwidthLimiter{bytesPerSec: bytesPerSec}
+}
+
+// wait accounts for n bytes read and blocks until reading them is within
+// the limit, or ctx is done.
+func (l *bandwidthLimiter) wait(ctx context.Context, n int) {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / l.bytesPerSec * float64(time.Second)))
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// transport wraps base so every response body it returns is read within
+// the limit.
+func (l *bandwidthLimiter) transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &throttledTransport{base: base, limiter: l}
+}
+
+type throttledTransport struct {
+	base    http.RoundTripper
+	limiter *bandwidthLimiter
+}
+
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	res.Body = &throttledBody{ReadCloser: res.Body, limiter: t.limiter, ctx: req.Context()}
+	return res, nil
+}
+
+// throttledChunk is the most read at once, so a large read doesn't make a
+// long burst followed by a long pause.
+const throttledChunk = 32 << 10
+
+type throttledBody struct {
+	io.ReadCloser
+	limiter *bandwidthLimiter
+	ctx     context.Context
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	if len(p) > throttledChunk {
+		p = p[:throttledChunk]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.limiter.wait(b.ctx, n)
+	}
+	return n, err
+}
+
+// parseBandwidth parses a bandwidth such as 10MB/s, 512KB or 1.5GB/s into
+// bytes per second.
+func parseBandwidth(s string) (float64, error) {
+	v := strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(s), "/s"))
+	unit := 1.0
+	for _, u := range []struct {
+		suffix string
+		size   float64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(v, u.suffix) {
+			v, unit = strings.TrimSuffix(v, u.suffix), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid bandwidth %q, expected e.g. 10MB/s", s)
+	}
+	return n * unit, nil
+}
+
+// avgThroughput returns the average number of response body bytes received
+// per second over crawlTime.
+func (c *Crawler) avgThroughput(crawlTime time.Duration) float64 {
+	if crawlTime <= 0 {
+		return 0
+	}
+	return float64(c.stats.bytes) / crawlTime.Seconds()
+}
+
+// throughputMeter tracks the peak number of bytes received in a second.
+type throughputMeter struct {
+	mu   sync.Mutex
+	sec  int64
+	cur  int64
+	peak int64
+}
+
+func (m *throughputMeter) record(now time.Time, n int64) {
+	sec := now.Unix()
+	m.mu.Lock()
+	if sec != m.sec {
+		m.sec, m.cur = sec, 0
+	}
+	m.cur += n
+	m.peak = max(m.peak, m.cur)
+	m.mu.Unlock()
+}
+
+// peakRate returns the most bytes received in any one second.
+func (m *throughputMeter) peakRate() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.peak
+}
+
+// byteBudget caps the number of response body bytes read in a run. A nil
+// *byteBudget has no limit. In a multi-site run every site shares the same
+// budget.
+type byteBudget struct {
+	limit int64
+	used  atomic.Int64
+}
+
+func newByteBudget(limit int64) *byteBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &byteBudget{limit: limit}
+}
+
+// exhausted reports whether the budget has been used up.
+func (b *byteBudget) exhausted() bool {
+	return b != nil && b.used.Load() >= b.limit
+}
+
+// transport wraps base so the bodies of all responses it returns are
+// counted against the budget.
+func (b *byteBudget) transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		res, err := base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		res.Body = &budgetBody{ReadCloser: res.Body, budget: b}
+		return res, nil
+	})
+}
+
+type budgetBody struct {
+	io.ReadCloser
+	budget *byteBudget
+}
+
+func (b *budgetBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.budget.used.Add(int64(n))
+	return n, err
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// baseline holds the response times of a known good run, loaded with
+// -baseline and written with -write-baseline.
+type baseline struct {
+	times map[string]time.Duration
+}
+
+// baselineFile is the format of a baseline file.
+type baselineFile struct {
+	CreatedAt string          `json:"created_at"`
+	URLs      []baselineEntry `json:"urls"`
+}
+
+type baselineEntry struct {
+	Site           string  `json:"site,omitempty"`
+	URL            string  `json:"url"`
+	ResponseTimeMs float64 `json:"response_time_ms"`
+}
+
+func loadBaseline(path string) (*baseline, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file baselineFile
+	if err := json.Unmarshal(b, &file); err != nil {
+		return nil, err
+	}
+	bl := &baseline{times: make(map[string]time.Duration, len(file.URLs))}
+	for _, e := range file.URLs {
+		key := resultKey(Result{Site: e.Site, URL: e.URL})
+		bl.times[key] = time.Duration(e.ResponseTimeMs * float64(time.Millisecond))
+	}
+	return bl, nil
+}
+
+// baselineTime reports whether r has a response time worth comparing or
+// keeping: it was fetched this run and didn't fail.
+func baselineTime(r Result) bool {
+	return r.Err == nil && !r.Fresh && r.StatusCode < 400 && r.ResponseTime > 0
+}
+
+// writeBaseline writes the response times of the run to path, sorted by
+// URL, for a later run to be compared with.
+func (c *Crawler) writeBaseline(path string) (int, error) {
+	c.lock.Lock()
+	file := baselineFile{CreatedAt: time.Now().UTC().Format(time.RFC3339), URLs: []baselineEntry{}}
+	for _, r := range c.results {
+		if baselineTime(r) {
+			file.URLs = append(file.URLs, baselineEntry{Site: r.Site, URL: r.URL, ResponseTimeMs: durationMs(r.ResponseTime)})
+		}
+	}
+	c.lock.Unlock()
+	sort.Slice(file.URLs, func(i, j int) bool {
+		a, b := file.URLs[i], file.URLs[j]
+		if a.Site != b.Site {
+			return a.Site < b.Site
+		}
+		return a.URL < b.URL
+	})
+	b, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	return len(file.URLs), os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// regression is a URL that got slower than its baseline.
+type regression struct {
+	URL      string
+	Baseline time.Duration
+	Measured time.Duration
+}
+
+// baselineComparison is the outcome of comparing a run with the baseline:
+// the URLs that regressed, slowest first relative to their baseline, and
+// the URLs the baseline doesn't have, sorted.
+type baselineComparison struct {
+	regressed []regression
+	added     []string
+}
+
+func (bc *baselineComparison) sort() {
+	sort.Slice(bc.regressed, func(i, j int) bool {
+		a, b := bc.regressed[i], bc.regressed[j]
+		ra, rb := float64(a.Measured)/float64(a.Baseline), float64(b.Measured)/float64(b.Baseline)
+		if ra != rb {
+			return ra > rb
+		}
+		return a.URL < b.URL
+	})
+	sort.Strings(bc.added)
+}
+
+// compareWithBaseline finds the URLs whose response time exceeds their
+// baseline by more than RegressionThreshold. Responses faster than
+// RegressionFloor are never regressions, however much slower they got, so
+// that a 20ms page taking 40ms doesn't fail the run.
+func (c *Crawler) compareWithBaseline() {
+	if c.baseline == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	bc := &baselineComparison{}
+	for key, r := range c.results {
+		if !baselineTime(r) {
+			continue
+		}
+		before, ok := c.baseline.times[key]
+		if !ok {
+			bc.added = append(bc.added, r.URL)
+			continue
+		}
+		if r.ResponseTime < c.RegressionFloor || before <= 0 {
+			continue
+		}
+		if float64(r.ResponseTime) > float64(before)*(1+c.RegressionThreshold) {
+			bc.regressed = append(bc.regressed, regression{URL: r.URL, Baseline: before, Measured: r.ResponseTime})
+		}
+	}
+	bc.sort()
+	c.regressions = bc
+}
+
+// reportRegressions writes the comparison with the baseline.
+func (c *Crawler) reportRegressions(w io.Writer, color func(c, s string) string) {
+	bc := c.regressions
+	if bc == nil {
+		return
+	}
+	fmt.Fprintf(w, "\nResponse times against the baseline: %d regressed by more than %s, %d new\n",
+		len(bc.regressed), percentFlag{&c.RegressionThreshold}, len(bc.added))
+	for i, r := range bc.regressed {
+		if i == maxReportedFailures {
+			fmt.Fprintf(w, "  ... and %d more regressed\n", len(bc.regressed)-i)
+			break
+		}
+		change := fmt.Sprintf("+%.0f%%", (float64(r.Measured)/float64(r.Baseline)-1)*100)
+		fmt.Fprintf(w, "  %s %v -> %v %s\n", color(colorRed, fmt.Sprintf("%6s", change)),
+			r.Baseline.Round(time.Millisecond), r.Measured.Round(time.Millisecond), r.URL)
+	}
+	for i, u := range bc.added {
+		if i == maxReportedFailures {
+			fmt.Fprintf(w, "  ... and %d more new\n", len(bc.added)-i)
+			break
+		}
+		fmt.Fprintf(w, "  %6s %s\n", "new", u)
+	}
+}
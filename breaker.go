@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// breakerMinRequests is the fewest requests in the window the breaker
+// judges the error rate on, so the first few failures of a run don't trip
+// it.
+const breakerMinRequests = 10
+
+// breakerState is the state of a circuitBreaker.
+type breakerState int
+
+const (
+	// breakerClosed lets requests through.
+	breakerClosed breakerState = iota
+	// breakerOpen holds them back until the cooldown is over.
+	breakerOpen
+	// breakerHalfOpen lets a single probe through and waits for its
+	// outcome.
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// breakerOutcome is a response seen by the breaker.
+type breakerOutcome struct {
+	at     time.Time
+	failed bool
+}
+
+// circuitBreaker stops dispatching requests while the origin looks
+// unhealthy: when the share of network errors and 5xx responses over the
+// window reaches the threshold it opens, holding the workers back for the
+// cooldown, and then lets a single probe through. It closes again if the
+// probe succeeds and opens for another cooldown if it fails, unless it has
+// been open for maxOpen by then: it gives up on the origin instead, and
+// lets the workers through for the crawl to stop.
+//
+// The workers go through acquire before taking a task and release after,
+// as they do with the concurrencyTuner.
+type circuitBreaker struct {
+	threshold float64
+	window    time.Duration
+	cooldown  time.Duration
+	maxOpen   time.Duration
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	state    breakerState
+	outcomes []breakerOutcome
+	probing  bool
+	stopped  bool
+	gaveUp   bool
+
+	// The breaker opened trips times, last at trippedAt, and has held the
+	// requests back for openFor in total until it last closed.
+	trips     int
+	trippedAt time.Time
+	openFor   time.Duration
+}
+
+func newCircuitBreaker(threshold float64, window, cooldown, maxOpen time.Duration) *circuitBreaker {
+	b := &circuitBreaker{threshold: threshold, window: window, cooldown: cooldown, maxOpen: maxOpen}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire waits until the breaker lets a request through. A nil breaker
+// always does.
+func (b *circuitBreaker) acquire() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for !b.stopped && (b.state == breakerOpen || b.state == breakerHalfOpen && b.probing) {
+		b.cond.Wait()
+	}
+	if b.state == breakerHalfOpen {
+		b.probing = true
+	}
+}
+
+// release ends a request let through by acquire. A probe that ended
+// without a response, because it was parked or not fetched at all, makes
+// way for another.
+func (b *circuitBreaker) release() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen && b.probing {
+		b.probing = false
+		b.cond.Broadcast()
+	}
+}
+
+// observe records the outcome of a request and opens or closes the breaker
+// accordingly.
+func (b *circuitBreaker) observe(r Result) {
+	if b == nil || r.Fresh {
+		return
+	}
+	failed := r.Err != nil || r.StatusCode >= 500
+	now := time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerHalfOpen:
+		if !b.probing {
+			return
+		}
+		b.probing = false
+		if failed && b.maxOpen > 0 && now.Sub(b.trippedAt) >= b.maxOpen {
+			slog.Error("origin still failing, giving up", "url", r.URL, "status", r.StatusCode,
+				"paused_for", now.Sub(b.trippedAt).Round(time.Second))
+			b.state = breakerOpen
+			b.gaveUp = true
+			b.stopped = true
+			b.cond.Broadcast()
+			return
+		}
+		if failed {
+			slog.Warn("circuit breaker probe failed, pausing again", "url", r.URL, "status", r.StatusCode, "cooldown", b.cooldown)
+			b.open()
+			return
+		}
+		b.openFor += now.Sub(b.trippedAt)
+		b.state = breakerClosed
+		b.outcomes = b.outcomes[:0]
+		slog.Info("circuit breaker closed, resuming", "url", r.URL, "paused_for", now.Sub(b.trippedAt).Round(time.Second))
+		b.cond.Broadcast()
+	case breakerClosed:
+		b.outcomes = append(b.outcomes, breakerOutcome{at: now, failed: failed})
+		i := 0
+		for i < len(b.outcomes) && now.Sub(b.outcomes[i].at) > b.window {
+			i++
+		}
+		b.outcomes = b.outcomes[i:]
+		if !failed || len(b.outcomes) < breakerMinRequests {
+			return
+		}
+		failures := 0
+		for _, o := range b.outcomes {
+			if o.failed {
+				failures++
+			}
+		}
+		if rate := float64(failures) / float64(len(b.outcomes)); rate >= b.threshold {
+			slog.Warn("origin looks unhealthy, circuit breaker opened", "error_rate", fmt.Sprintf("%.0f%%", rate*100),
+				"requests", len(b.outcomes), "window", b.window, "cooldown", b.cooldown)
+			b.trips++
+			b.trippedAt = now
+			b.outcomes = b.outcomes[:0]
+			b.open()
+		}
+	}
+}
+
+// open holds the workers back for the cooldown. The caller holds b.mu.
+func (b *circuitBreaker) open() {
+	b.state = breakerOpen
+	time.AfterFunc(b.cooldown, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.state == breakerOpen {
+			b.state = breakerHalfOpen
+			slog.Info("circuit breaker half-open, probing with a single request")
+			b.cond.Broadcast()
+		}
+	})
+}
+
+// stop lets every worker through for good, so that a stopped crawl doesn't
+// wait for the cooldown to end.
+func (b *circuitBreaker) stop() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.stopped = true
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// givenUp reports whether the breaker gave up on the origin after being
+// open for maxOpen. A nil breaker never does.
+func (b *circuitBreaker) givenUp() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.gaveUp
+}
+
+// usage returns the number of times the breaker opened and how long it
+// held the requests back in total, up to now if it still does.
+func (b *circuitBreaker) usage(now time.Time) (trips int, open time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	open = b.openFor
+	if b.state != breakerClosed {
+		open += now.Sub(b.trippedAt)
+	}
+	return b.trips, open
+}
+
+// percentFlag is a flag holding a fraction, given as a percentage such as
+// 25% or as a fraction such as 0.25.
+type percentFlag struct {
+	value *float64
+}
+
+func (f percentFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f.value*100, 'f', -1, 64) + "%"
+}
+
+func (f percentFlag) Set(s string) error {
+	s = strings.TrimSpace(s)
+	percent := strings.HasSuffix(s, "%")
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil {
+		return fmt.Errorf("expected a percentage such as 25%%")
+	}
+	if percent {
+		v /= 100
+	}
+	*f.value = v
+	return nil
+}
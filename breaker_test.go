@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBreakerStopsCrawlOfDeadOrigin(t *testing.T) {
+	const pages = 200
+	var hits hitCounter
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.count(r)
+		if r.URL.Path != "/" {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		var b strings.Builder
+		for i := 0; i < pages; i++ {
+			fmt.Fprintf(&b, `<a href="/%d">%d</a>`, i, i)
+		}
+		fmt.Fprint(w, b.String())
+	}))
+	defer srv.Close()
+	c := newTestCrawler(t, func(cfg *Config) {
+		cfg.StartURL = srv.URL + "/"
+		cfg.MaxConcurrency = 2
+		cfg.RetryOn = nil
+		cfg.BreakerCooldown = 20 * time.Millisecond
+		cfg.BreakerMaxOpen = 100 * time.Millisecond
+	})
+
+	runWithin(t, c, 10*time.Second)
+
+	if c.stoppedBy != "breaker-max-open" {
+		t.Errorf("crawl stopped by %q, want breaker-max-open", c.stoppedBy)
+	}
+	fetched := 0
+	for i := 0; i < pages; i++ {
+		fetched += hits.get(fmt.Sprintf("/%d", i))
+	}
+	if fetched >= pages/2 || c.notWarmed != pages-fetched {
+		t.Errorf("%d of %d pages fetched and %d not warmed, want the rest not warmed", fetched, pages, c.notWarmed)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// contentChanges are the URLs whose body hash differs from the one in the
+// previous run, the URLs it didn't have and the ones it had that weren't
+// fetched this time, each sorted.
+type contentChanges struct {
+	changed []string
+	added   []string
+	removed []string
+}
+
+// compareWithPrevious finds the content changes since the previous run with
+// -detect-changes. URLs without a hash on either side, because they failed
+// or the previous run didn't hash bodies, aren't compared.
+func (c *Crawler) compareWithPrevious() {
+	if !c.DetectChanges || c.previous == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var ch contentChanges
+	for key, r := range c.results {
+		if r.BodyHash == "" {
+			continue
+		}
+		prev, ok := c.previous.results[key]
+		switch {
+		case !ok:
+			ch.added = append(ch.added, r.URL)
+		case prev.BodyHash != "" && prev.BodyHash != r.BodyHash:
+			ch.changed = append(ch.changed, r.URL)
+		}
+	}
+	for key, prev := range c.previous.results {
+		if prev.Site != c.Name || prev.BodyHash == "" {
+			continue
+		}
+		if _, ok := c.results[key]; !ok {
+			ch.removed = append(ch.removed, prev.URL)
+		}
+	}
+	ch.sort()
+	c.changes = &ch
+}
+
+func (ch *contentChanges) sort() {
+	sort.Strings(ch.changed)
+	sort.Strings(ch.added)
+	sort.Strings(ch.removed)
+}
+
+// reportChanges writes the content changes since the previous run.
+func (c *Crawler) reportChanges(w io.Writer) {
+	ch := c.changes
+	if ch == nil {
+		return
+	}
+	fmt.Fprintf(w, "\nContent changes since the previous run: %d changed, %d new, %d removed\n",
+		len(ch.changed), len(ch.added), len(ch.removed))
+	for _, group := range []struct {
+		label string
+		urls  []string
+	}{{"changed", ch.changed}, {"new", ch.added}, {"removed", ch.removed}} {
+		for i, u := range group.urls {
+			if i == maxReportedFailures {
+				fmt.Fprintf(w, "  ... and %d more %s\n", len(group.urls)-i, group.label)
+				break
+			}
+			fmt.Fprintf(w, "  %-7s %s\n", group.label, u)
+		}
+	}
+}
+
+// writeChangedList writes the changed, new and removed URLs to path, one
+// per line, so they can be purged with `gowarmer list -purge`.
+func (c *Crawler) writeChangedList(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if ch := c.changes; ch != nil {
+		for _, list := range [][]string{ch.changed, ch.added, ch.removed} {
+			for _, u := range list {
+				w.WriteString(u + "\n")
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/transform"
+	"io"
+	"log/slog"
+	"regexp"
+	"unicode/utf8"
+)
+
+// charsetPrescan is how much of a page is looked at for its charset, as
+// much as browsers do.
+const charsetPrescan = 1024
+
+// metaCharsetPattern finds the charset a page declares in a
+// <meta charset> or <meta http-equiv="Content-Type"> tag.
+var metaCharsetPattern = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([a-z0-9._:-]+)`)
+
+// utf8Body returns r transcoded to UTF-8 for parsing, going by the byte
+// order mark, the charset of contentType or the one the page declares in a
+// meta tag. Links with non-ASCII characters on a page in Latin-1 or
+// Shift_JIS would otherwise be mangled. A page that declares no charset, or
+// one that isn't known, is taken as UTF-8 unless its first bytes aren't
+// valid UTF-8, in which case it is read as Windows-1252, as browsers do.
+func utf8Body(r io.Reader, contentType, u string) io.Reader {
+	br := bufio.NewReaderSize(r, charsetPrescan)
+	peek, _ := br.Peek(charsetPrescan)
+	enc, name, certain := charset.DetermineEncoding(peek, contentType)
+	if !certain && name == "windows-1252" && !declaresCharset(peek) && validUTF8Prefix(peek) {
+		// Nothing said which charset it is, and that was only the
+		// fallback.
+		return br
+	}
+	if name == "utf-8" {
+		return br
+	}
+	slog.Debug("transcoding the page to UTF-8 to find its links", "url", u, "charset", name)
+	return transform.NewReader(br, enc.NewDecoder())
+}
+
+// declaresCharset reports whether the start of a page declares a charset
+// that is known.
+func declaresCharset(peek []byte) bool {
+	m := metaCharsetPattern.FindSubmatch(peek)
+	if m == nil {
+		return false
+	}
+	enc, _ := charset.Lookup(string(m[1]))
+	return enc != nil
+}
+
+// validUTF8Prefix reports whether b is valid UTF-8, but for a character cut
+// off at its end.
+func validUTF8Prefix(b []byte) bool {
+	for i := len(b) - 1; i >= 0 && i > len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				b = b[:i]
+			}
+			break
+		}
+	}
+	return utf8.Valid(b)
+}
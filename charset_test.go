@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCrawlExtractsNonASCIILinksOfNonUTF8Pages(t *testing.T) {
+	tests := []struct {
+		fixture     string
+		contentType string
+		want        []string
+	}{
+		{
+			// The charset is only declared in a meta tag.
+			fixture:     "latin1.html",
+			contentType: "text/html",
+			want:        []string{"/caf%C3%A9", "/%C3%BCber/%C3%A9t%C3%A9"},
+		},
+		{
+			fixture:     "shift_jis.html",
+			contentType: "text/html; charset=Shift_JIS",
+			want:        []string{"/%E6%97%A5%E6%9C%AC%E8%AA%9E/", "/%E6%9D%B1%E4%BA%AC"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			page, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var hits hitCounter
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hits.count(r)
+				if r.URL.Path == "/" {
+					w.Header().Set("Content-Type", tt.contentType)
+					w.Write(page)
+				}
+			}))
+			defer srv.Close()
+			c := newTestCrawler(t, func(cfg *Config) {
+				cfg.StartURL = srv.URL + "/"
+			})
+
+			runWithin(t, c, 10*time.Second)
+
+			for _, path := range tt.want {
+				if n := hits.get(path); n != 1 {
+					t.Errorf("%s fetched %d times, want once", path, n)
+				}
+			}
+			if c.stats.pages != 1+len(tt.want) {
+				t.Errorf("%d pages crawled, want %d", c.stats.pages, 1+len(tt.want))
+			}
+		})
+	}
+}
+
+func TestUTF8Body(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		want        string
+	}{
+		{name: "utf-8", body: "<p>café</p>", contentType: "text/html; charset=utf-8", want: "<p>café</p>"},
+		{name: "undeclared utf-8", body: "<p>café</p>", contentType: "text/html", want: "<p>café</p>"},
+		{name: "latin-1 header", body: "<p>caf\xe9</p>", contentType: "text/html; charset=ISO-8859-1", want: "<p>café</p>"},
+		{name: "latin-1 meta", body: `<meta charset="latin1"><p>caf` + "\xe9</p>", contentType: "text/html", want: `<meta charset="latin1"><p>café</p>`},
+		// Neither declared nor valid UTF-8 is read as Windows-1252.
+		{name: "undeclared", body: "<p>\x93caf\xe9\x94</p>", contentType: "text/html", want: "<p>“café”</p>"},
+		{name: "unknown charset", body: "<p>café</p>", contentType: "text/html; charset=x-made-up", want: "<p>café</p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := io.ReadAll(utf8Body(strings.NewReader(tt.body), tt.contentType, "https://example.com/"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("utf8Body(%q, %q) = %q, want %q", tt.body, tt.contentType, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+	"strings"
+)
+
+// minCompressibleSize is the size below which an uncompressed response isn't
+// worth flagging.
+const minCompressibleSize = 1 << 10
+
+// compressionAcceptEncoding is sent with -check-compression. Setting it
+// turns off the transparent decompression of the HTTP client, so the
+// responses are seen as the server sends them. Only encodings decodedBody
+// can decode are asked for, so that the links of every page are still
+// followed.
+const compressionAcceptEncoding = "gzip"
+
+// compressible reports whether responses of the content type should be
+// compressed: HTML, CSS, JavaScript and JSON.
+func compressible(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mt == "text/html", mt == "text/css", mt == "application/json", strings.HasSuffix(mt, "+json"):
+		return true
+	}
+	return strings.HasSuffix(mt, "javascript")
+}
+
+// gzipEstimator works out the size a body would have gzipped, as it is
+// read.
+type gzipEstimator struct {
+	n  int64
+	gz *gzip.Writer
+}
+
+func newGzipEstimator() *gzipEstimator {
+	e := &gzipEstimator{}
+	e.gz = gzip.NewWriter(byteCounter{&e.n})
+	return e
+}
+
+func (e *gzipEstimator) Write(p []byte) (int, error) {
+	return e.gz.Write(p)
+}
+
+// size returns the gzipped size of what was written.
+func (e *gzipEstimator) size() int64 {
+	e.gz.Close()
+	return e.n
+}
+
+// byteCounter is a writer that only counts what is written to it.
+type byteCounter struct{ n *int64 }
+
+func (bc byteCounter) Write(p []byte) (int, error) {
+	*bc.n += int64(len(p))
+	return len(p), nil
+}
+
+// decodedBody returns a reader of the decoded body for the given
+// Content-Encoding, or nil if it can't be decoded. A body said to be
+// gzipped that doesn't start like gzip is taken as it is, since some
+// servers label bodies they didn't compress. It reads the gzip header
+// straight away, so whatever saves the body as it was sent has to be
+// reading it already.
+func decodedBody(r io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return r
+	case "gzip", "x-gzip":
+		br := bufio.NewReader(r)
+		if magic, _ := br.Peek(2); !bytes.Equal(magic, gzipMagic) {
+			return br
+		}
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil
+		}
+		return gz
+	}
+	return nil
+}
+
+// gzipMagic are the first bytes of a gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// autoConcurrencyStart is the number of requests in flight a -c auto
+	// run starts with, and autoConcurrencyMax its upper bound unless -c-max
+	// gives one.
+	autoConcurrencyStart = 2
+	autoConcurrencyMax   = 64
+
+	// autoWindowMin is the fewest responses the tuner judges the latency
+	// on, so a single slow response doesn't back it off.
+	autoWindowMin = 10
+
+	// autoLatencySlack is how much slower than the best seen the p95 of a
+	// window may get, on top of twice as slow, before it counts as
+	// degraded. It keeps the jitter of fast responses from backing off.
+	autoLatencySlack = 20 * time.Millisecond
+)
+
+// concurrencyFlag is the -c flag: a number of requests in flight, or auto
+// to let a concurrencyTuner pick it.
+type concurrencyFlag struct {
+	cfg *Config
+}
+
+func (f concurrencyFlag) String() string {
+	if f.cfg == nil {
+		return ""
+	}
+	if f.cfg.AutoConcurrency {
+		return "auto"
+	}
+	return strconv.Itoa(f.cfg.MaxConcurrency)
+}
+
+func (f concurrencyFlag) Set(s string) error {
+	if s == "auto" {
+		f.cfg.AutoConcurrency = true
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("expected a number or auto")
+	}
+	f.cfg.MaxConcurrency, f.cfg.AutoConcurrency = n, false
+	return nil
+}
+
+// concurrencyTuner sets the number of requests in flight with -c auto,
+// additive increase, multiplicative decrease: it starts low and allows one
+// more request in flight after every window of responses whose p95 stays
+// close to the best window seen, as long as the limit was reached during
+// the window, and halves the limit as soon as a 429, a 5xx or a network
+// error comes back, or the p95 of a window degrades. A limit that isn't
+// reached says nothing about how the site copes with more.
+type concurrencyTuner struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	limit, max int
+	active     int
+
+	window   []time.Duration
+	baseline time.Duration
+	// saturated is set once the limit is reached during the window.
+	saturated bool
+	// cooldown is the number of responses, those already in flight when
+	// the limit was cut, whose failures don't cut it again.
+	cooldown int
+
+	peak int
+	// weighted is the limit integrated over time since start, up to
+	// changed, for the average.
+	weighted float64
+	start    time.Time
+	changed  time.Time
+}
+
+func newConcurrencyTuner(maxLimit int) *concurrencyTuner {
+	if maxLimit <= 0 {
+		maxLimit = autoConcurrencyMax
+	}
+	now := time.Now()
+	t := &concurrencyTuner{
+		limit:   min(autoConcurrencyStart, maxLimit),
+		max:     maxLimit,
+		start:   now,
+		changed: now,
+	}
+	t.peak = t.limit
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// acquire waits for a slot under the current limit. A nil tuner has no
+// limit.
+func (t *concurrencyTuner) acquire() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.active >= t.limit {
+		t.cond.Wait()
+	}
+	t.active++
+	if t.active >= t.limit {
+		t.saturated = true
+	}
+}
+
+func (t *concurrencyTuner) release() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.active--
+	t.mu.Unlock()
+	t.cond.Signal()
+}
+
+// observe adjusts the limit to the outcome of a request.
+func (t *concurrencyTuner) observe(r Result) {
+	if t == nil || r.Fresh {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	failed := r.Err != nil || r.StatusCode == 429 || r.StatusCode >= 500
+	if t.cooldown > 0 {
+		t.cooldown--
+		if failed {
+			return
+		}
+	}
+	if failed {
+		t.setLimit(t.limit/2, "status", r.StatusCode)
+		return
+	}
+	t.window = append(t.window, r.ResponseTime)
+	if len(t.window) < max(autoWindowMin, t.limit) {
+		return
+	}
+	latencies := &exactLatencies{}
+	for _, d := range t.window {
+		latencies.record(d)
+	}
+	p95 := latencies.quantile(0.95)
+	if t.baseline == 0 || p95 < t.baseline {
+		t.baseline = p95
+	}
+	if p95 > 2*t.baseline && p95 > t.baseline+autoLatencySlack {
+		t.setLimit(t.limit/2, "p95", p95, "baseline_p95", t.baseline)
+	} else if t.saturated {
+		t.setLimit(t.limit + 1)
+	} else {
+		t.setLimit(t.limit)
+	}
+}
+
+// setLimit changes the limit within its bounds and starts a new window. The
+// caller holds t.mu.
+func (t *concurrencyTuner) setLimit(n int, reason ...any) {
+	t.window = t.window[:0]
+	n = max(1, min(n, t.max))
+	t.saturated = t.active >= n
+	if n == t.limit {
+		return
+	}
+	now := time.Now()
+	t.weighted += float64(t.limit) * now.Sub(t.changed).Seconds()
+	t.changed = now
+	if n < t.limit {
+		t.cooldown = t.limit
+		slog.Debug("backing off concurrency", append([]any{"from", t.limit, "to", n}, reason...)...)
+	}
+	t.limit = n
+	t.peak = max(t.peak, n)
+	t.cond.Broadcast()
+}
+
+// current returns the current limit, or 0 for a nil tuner.
+func (t *concurrencyTuner) current() int {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limit
+}
+
+// usage returns the highest limit and the average over time at now.
+func (t *concurrencyTuner) usage(now time.Time) (peak int, average float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	elapsed := now.Sub(t.start).Seconds()
+	if elapsed <= 0 {
+		return t.peak, float64(t.limit)
+	}
+	return t.peak, (t.weighted + float64(t.limit)*now.Sub(t.changed).Seconds()) / elapsed
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The -c auto tuner against an origin that copes up to a number of
+// requests in flight, the cliff, and falls over beyond it.
+
+// simulate drives tuner with responses requests of a crawl that always has
+// more URLs to fetch, taking latency(n) with n requests in flight, and
+// returns the number of requests in flight at each response.
+func simulate(tuner *concurrencyTuner, responses int, latency func(int) Result) []int {
+	inFlight := make([]int, 0, responses)
+	active := 0
+	for i := 0; i < responses; i++ {
+		for active < tuner.current() {
+			tuner.acquire()
+			active++
+		}
+		inFlight = append(inFlight, active)
+		tuner.observe(latency(active))
+		tuner.release()
+		active--
+	}
+	return inFlight
+}
+
+func TestConcurrencyTunerBacksOffBelowLatencyCliff(t *testing.T) {
+	const cliff = 8
+	tuner := newConcurrencyTuner(0)
+	// Responses take 10ms up to the cliff and ten times as long beyond.
+	inFlight := simulate(tuner, 5000, func(n int) Result {
+		if n > cliff {
+			return Result{StatusCode: 200, ResponseTime: 100 * time.Millisecond}
+		}
+		return Result{StatusCode: 200, ResponseTime: 10 * time.Millisecond}
+	})
+
+	probed, run := false, 0
+	for i, n := range inFlight {
+		if n <= cliff {
+			run = 0
+			continue
+		}
+		probed = true
+		// Past the cliff the p95 of the first window is enough to back
+		// off.
+		if run++; run > 2*autoWindowMin {
+			t.Fatalf("%d responses in a row past the cliff of %d at response %d, %d in flight", run, cliff, i, n)
+		}
+	}
+	if !probed {
+		t.Fatalf("the limit never went past the cliff of %d, peak %d", cliff, tuner.peak)
+	}
+	sum := 0
+	for _, n := range inFlight[len(inFlight)/2:] {
+		sum += n
+	}
+	if avg := float64(sum) / float64(len(inFlight)-len(inFlight)/2); avg > cliff || avg < cliff/2 {
+		t.Errorf("%.1f requests in flight on average, want it just below the cliff of %d", avg, cliff)
+	}
+}
+
+func TestConcurrencyTunerHoldsAnUnusedLimit(t *testing.T) {
+	tuner := newConcurrencyTuner(0)
+	// A crawl with only one URL to fetch at a time never reaches the
+	// limit of 2, so fast responses don't raise it.
+	for i := 0; i < 200; i++ {
+		tuner.acquire()
+		tuner.observe(Result{StatusCode: 200, ResponseTime: 10 * time.Millisecond})
+		tuner.release()
+	}
+	if got := tuner.current(); got != autoConcurrencyStart {
+		t.Errorf("limit %d after 200 responses one at a time, want %d", got, autoConcurrencyStart)
+	}
+}
+
+func TestConcurrencyTunerBacksOffOnErrors(t *testing.T) {
+	tuner := newConcurrencyTuner(0)
+	simulate(tuner, 200, func(int) Result {
+		return Result{StatusCode: 200, ResponseTime: 10 * time.Millisecond}
+	})
+	before := tuner.current()
+	if before <= autoConcurrencyStart {
+		t.Fatalf("limit %d after 200 fast responses, want it raised", before)
+	}
+	// A burst of errors, as from the requests in flight when the origin
+	// fell over, halves the limit once.
+	for i := 0; i < before; i++ {
+		tuner.observe(Result{StatusCode: 503})
+	}
+	if got := tuner.current(); got != before/2 {
+		t.Errorf("limit %d after a burst of 503s from %d, want %d", got, before, before/2)
+	}
+}
+
+func TestAutoConcurrencyBacksOffBelowCliff(t *testing.T) {
+	const cliff, pages = 6, 250
+	var inFlight, peak, overloaded atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		if n > cliff {
+			overloaded.Add(1)
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/html")
+		// The start page links to all the others, so there are always
+		// more URLs to fetch than the limit lets through.
+		if r.URL.Path == "/" {
+			for i := 0; i < pages; i++ {
+				fmt.Fprintf(w, `<a href="/%d">%d</a>`, i, i)
+			}
+		}
+	}))
+	defer srv.Close()
+	c := newTestCrawler(t, func(cfg *Config) {
+		cfg.StartURL = srv.URL + "/"
+		cfg.AutoConcurrency = true
+		cfg.MaxAutoConcurrency = 32
+	})
+
+	// The limit is sampled while the crawl runs.
+	var limits []int
+	finished := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		tick := time.NewTicker(5 * time.Millisecond)
+		defer tick.Stop()
+		for {
+			select {
+			case <-finished:
+				return
+			case <-tick.C:
+				limits = append(limits, c.tuner.current())
+			}
+		}
+	}()
+	runWithin(t, c, time.Minute)
+	close(finished)
+	<-sampled
+
+	if overloaded.Load() == 0 {
+		t.Fatalf("at most %d requests in flight, the tuner never reached the cliff of %d", peak.Load(), cliff)
+	}
+	above := 0
+	for _, n := range limits {
+		if n > cliff {
+			above++
+		}
+		// Every probe past the cliff is cut back at the first 503.
+		if n > 2*cliff {
+			t.Fatalf("limit at %d, want it cut back at the cliff of %d", n, cliff)
+		}
+	}
+	if share := float64(above) / float64(len(limits)); share > 0.25 {
+		t.Errorf("limit past the cliff of %d %.0f%% of the time, want it to back off below it", cliff, share*100)
+	}
+	if n := overloaded.Load(); n > pages/20 {
+		t.Errorf("%d of %d requests past the cliff", n, c.stats.pages)
+	}
+}
@@ -0,0 +1,836 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"maps"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the options that control a crawl. Every field can be set from
+// the YAML file given with -config as well as from the command line.
+type Config struct {
+	// Name identifies a site in a multi-site run. It defaults to the host
+	// of the site's URL or sitemap.
+	Name string `yaml:"name,omitempty"`
+
+	// RunID identifies the run in every output. A timestamp-based one is
+	// generated if it is empty.
+	RunID string `yaml:"run_id,omitempty"`
+
+	StartURL       string            `yaml:"url,omitempty"`
+	SitemapURL     string            `yaml:"sitemap,omitempty"`
+	ListFile       string            `yaml:"list,omitempty"`
+	Verbose        bool              `yaml:"verbose,omitempty"`
+	VeryVerbose    bool              `yaml:"very_verbose,omitempty"`
+	LogLevel       string            `yaml:"log_level"`
+	LogFormat      string            `yaml:"log_format"`
+	LogFile        string            `yaml:"log_file,omitempty"`
+	MaxConcurrency int               `yaml:"concurrency"`
+	Timeout        time.Duration     `yaml:"timeout"`
+	Username       string            `yaml:"username,omitempty"`
+	Password       string            `yaml:"password,omitempty"`
+	Headers        map[string]string `yaml:"headers,omitempty"`
+	HMACSecret     string            `yaml:"sign_hmac,omitempty"`
+	Include        []string          `yaml:"include,omitempty"`
+	Exclude        []string          `yaml:"exclude,omitempty"`
+
+	// AutoConcurrency adjusts the number of requests in flight to how the
+	// site copes, up to MaxAutoConcurrency, instead of MaxConcurrency.
+	AutoConcurrency    bool `yaml:"concurrency_auto,omitempty"`
+	MaxAutoConcurrency int  `yaml:"concurrency_max,omitempty"`
+
+	// SitemapConcurrency bounds the child sitemaps of an index fetched at
+	// the same time; 0 uses MaxConcurrency.
+	SitemapConcurrency int `yaml:"sitemap_concurrency,omitempty"`
+
+	// RespectMetaRobots skips the links of pages whose robots meta tag or
+	// X-Robots-Tag header says nofollow or none, and doesn't count noindex
+	// pages as failures.
+	RespectMetaRobots bool `yaml:"respect_meta_robots,omitempty"`
+
+	// ForwardAuthHosts are the hosts besides the URL's own that basic auth
+	// and custom headers are still sent to when a request is redirected
+	// there, e.g. sso.example.com or *.example.com.
+	ForwardAuthHosts []string `yaml:"forward_auth_hosts,omitempty"`
+
+	// LowMemory replaces the URL set with a set of 64-bit hashes and stops
+	// keeping per-URL results, so only running aggregates are available for
+	// the report. Results should be streamed through OnResult instead.
+	LowMemory bool `yaml:"low_memory,omitempty"`
+
+	Progress bool   `yaml:"progress,omitempty"`
+	TUI      bool   `yaml:"tui,omitempty"`
+	Listen   string `yaml:"listen,omitempty"`
+
+	// ProgressJSON replaces the progress line with a JSON progress event
+	// every ProgressInterval, written to file descriptor ProgressFD.
+	ProgressJSON     bool          `yaml:"progress_json,omitempty"`
+	ProgressFD       int           `yaml:"progress_fd,omitempty"`
+	ProgressInterval time.Duration `yaml:"progress_interval,omitempty"`
+
+	// PProf is the address net/http/pprof is served at while running.
+	// CPUProfile and MemProfile are the files the CPU and heap profiles are
+	// written to at exit, including when interrupted.
+	PProf      string `yaml:"pprof,omitempty"`
+	CPUProfile string `yaml:"cpuprofile,omitempty"`
+	MemProfile string `yaml:"memprofile,omitempty"`
+
+	Output     string `yaml:"output"`
+	OutputFile string `yaml:"output_file,omitempty"`
+	// Sort is the order the detailed report and the results of the JSON
+	// outputs list the URLs in: url, status or time.
+	Sort string `yaml:"sort,omitempty"`
+
+	Webhook         string            `yaml:"webhook,omitempty"`
+	WebhookHeaders  map[string]string `yaml:"webhook_headers,omitempty"`
+	WebhookTimeout  time.Duration     `yaml:"webhook_timeout"`
+	WebhookSecret   string            `yaml:"webhook_secret,omitempty"`
+	WebhookRequired bool              `yaml:"webhook_required,omitempty"`
+
+	SlackWebhook     string `yaml:"slack_webhook,omitempty"`
+	NotifyOn         string `yaml:"notify_on"`
+	SlackMaxFailures int    `yaml:"slack_max_failures"`
+
+	Pushgateway  string            `yaml:"pushgateway,omitempty"`
+	PushJob      string            `yaml:"push_job"`
+	PushLabels   map[string]string `yaml:"push_labels,omitempty"`
+	PushUsername string            `yaml:"push_username,omitempty"`
+	PushPassword string            `yaml:"push_password,omitempty"`
+
+	OTelEndpoint    string  `yaml:"otel_endpoint,omitempty"`
+	OTelSampleRatio float64 `yaml:"otel_sample_ratio"`
+
+	Statsd     string   `yaml:"statsd,omitempty"`
+	StatsdTags []string `yaml:"statsd_tags,omitempty"`
+
+	// Shard is "i/n" to fetch only the i-th of n shares of the URLs.
+	Shard        string `yaml:"shard,omitempty"`
+	ShardSkipped string `yaml:"shard_skipped,omitempty"`
+
+	// Previous is the output of an earlier run, used to skip URLs that
+	// are still fresh unless Force is set.
+	Previous string `yaml:"previous,omitempty"`
+	Force    bool   `yaml:"force,omitempty"`
+
+	// Verify re-requests VerifySample (0 for all) of the warmed URLs after
+	// the crawl to check they are cache hits, by the CacheHeader response
+	// header if set, otherwise by response time.
+	Verify       bool   `yaml:"verify,omitempty"`
+	VerifySample int    `yaml:"verify_sample,omitempty"`
+	CacheHeader  string `yaml:"cache_header,omitempty"`
+
+	// Variants are the values each request header is warmed with when a
+	// response varies on it, e.g. Accept-Encoding: [gzip, br]. Encodings and
+	// Languages are shorthands for Accept-Encoding and Accept-Language.
+	Variants  map[string][]string `yaml:"variants,omitempty"`
+	Encodings []string            `yaml:"encodings,omitempty"`
+	Languages []string            `yaml:"languages,omitempty"`
+
+	// MeasureSpeedup fetches every URL a second time, SpeedupDelay after
+	// the first fetch, and compares the two response times.
+	MeasureSpeedup bool          `yaml:"measure_speedup,omitempty"`
+	SpeedupDelay   time.Duration `yaml:"speedup_delay,omitempty"`
+
+	// Repeat is the number of times every URL is fetched in a row.
+	Repeat int `yaml:"repeat,omitempty"`
+
+	// SaveBodies is the directory the response bodies are saved to, those
+	// of unsuccessful responses too with SaveErrors.
+	SaveBodies string `yaml:"save_bodies,omitempty"`
+	SaveErrors bool   `yaml:"save_errors,omitempty"`
+
+	// WARC is the file the requests and responses are written to as WARC
+	// records, gzip-compressed if it ends in .gz.
+	WARC string `yaml:"warc,omitempty"`
+
+	// BreakerThreshold is the share of network errors and 5xx responses
+	// over BreakerWindow at which the crawl holds back its requests for
+	// BreakerCooldown, unless NoBreaker is set. The crawl stops once the
+	// breaker has been open for BreakerMaxOpen, if that isn't 0.
+	BreakerThreshold float64       `yaml:"breaker_threshold,omitempty"`
+	BreakerWindow    time.Duration `yaml:"breaker_window,omitempty"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown,omitempty"`
+	BreakerMaxOpen   time.Duration `yaml:"breaker_max_open,omitempty"`
+	NoBreaker        bool          `yaml:"no_breaker,omitempty"`
+
+	// LoadDuration keeps requesting the input URLs over and over, in
+	// turn, for this long instead of fetching each of them once.
+	LoadDuration time.Duration `yaml:"duration,omitempty"`
+
+	// Purge sends a PurgeMethod request for every URL before warming it,
+	// to PurgeHost instead of the URL's own host if set. With PurgeRequired
+	// a URL whose purge fails isn't warmed.
+	Purge         bool              `yaml:"purge,omitempty"`
+	PurgeMethod   string            `yaml:"purge_method"`
+	PurgeHost     string            `yaml:"purge_host,omitempty"`
+	PurgeHeaders  map[string]string `yaml:"purge_headers,omitempty"`
+	PurgeRequired bool              `yaml:"purge_required,omitempty"`
+
+	// AbortOnAuthFailure stops the run after a few 401 and 403 responses
+	// in a row from the primary host. Unset, it is on when credentials are
+	// configured.
+	AbortOnAuthFailure *bool `yaml:"abort_on_auth_failure,omitempty"`
+
+	// TimeoutFor overrides Timeout for the URLs matching a pattern, as
+	// "pattern=duration" with a glob or regular expression.
+	TimeoutFor []string `yaml:"timeout_for,omitempty"`
+
+	// WeightedFile is a CSV of url,weight rows, such as pageviews, warmed
+	// like a list with the heaviest URLs first, and only the WeightedTop
+	// heaviest of them if set.
+	WeightedFile string `yaml:"weighted_file,omitempty"`
+	WeightedTop  int    `yaml:"weighted_top,omitempty"`
+
+	// OpenAPI is an OpenAPI 3 spec whose GET operations are warmed as
+	// well, at OpenAPIServer or the first server of the spec, with their
+	// parameters filled from the OpenAPIValues file.
+	OpenAPI       string `yaml:"openapi,omitempty"`
+	OpenAPIServer string `yaml:"openapi_server,omitempty"`
+	OpenAPIValues string `yaml:"openapi_values,omitempty"`
+
+	// Order is the order URLs are fetched in: as found (empty), priority
+	// for the highest sitemap <priority> first or lastmod for the newest
+	// <lastmod> first. Priorities, "weight:pattern", go before that: URLs
+	// matching the pattern with the highest weight come first, and those
+	// matching none have weight 0. MaxPages and MaxDuration stop the warm
+	// early.
+	Order       string        `yaml:"order,omitempty"`
+	Priorities  []string      `yaml:"priorities,omitempty"`
+	MaxPages    int           `yaml:"max_pages,omitempty"`
+	MaxDuration time.Duration `yaml:"max_duration,omitempty"`
+
+	// SitemapLimit, Sample and SampleN warm only some of the sitemap's
+	// URLs: the first SitemapLimit, a Sample fraction or SampleN of them
+	// chosen at random with Seed (0 for a random seed).
+	SitemapLimit int     `yaml:"sitemap_limit,omitempty"`
+	Sample       float64 `yaml:"sample,omitempty"`
+	SampleN      int     `yaml:"sample_n,omitempty"`
+	Seed         int64   `yaml:"seed,omitempty"`
+
+	// Shuffle fetches URLs of equal priority in a random order, seeded
+	// with Seed.
+	Shuffle bool `yaml:"shuffle,omitempty"`
+
+	// CrawlSample is the fraction of the links found on pages that are
+	// fetched, chosen with Seed; 0 fetches them all.
+	CrawlSample float64 `yaml:"crawl_sample,omitempty"`
+
+	// TrapDetection stops following links into what look like infinite URL
+	// spaces: to URLs with a path segment repeated more than TrapMaxRepeats
+	// times, to more than TrapMaxParamValues values of a query parameter on
+	// a path, and to more than TrapMaxPatternURLs URLs of a pattern, the
+	// host and path with digits collapsed. TrapLimits are "pattern=limit"
+	// overrides of TrapMaxPatternURLs for the URLs matching pattern.
+	TrapDetection      bool     `yaml:"trap_detection,omitempty"`
+	TrapMaxRepeats     int      `yaml:"trap_max_repeats,omitempty"`
+	TrapMaxParamValues int      `yaml:"trap_max_param_values,omitempty"`
+	TrapMaxPatternURLs int      `yaml:"trap_max_pattern_urls,omitempty"`
+	TrapLimits         []string `yaml:"trap_limits,omitempty"`
+
+	// AllowHosts are the hosts besides the start URL's own that links are
+	// followed to, "*.example.com" for all subdomains. MaxConcurrencyPerHost
+	// limits the requests in flight to any one host.
+	AllowHosts            []string `yaml:"allow_hosts,omitempty"`
+	MaxConcurrencyPerHost int      `yaml:"concurrency_per_host,omitempty"`
+
+	// MaxBodySize limits how much of a response body is read, for link
+	// extraction as well as when draining it.
+	MaxBodySize int64 `yaml:"max_body_size"`
+
+	// Retries is how many times a URL answered with 429 Too Many Requests
+	// or one of the RetryOn statuses is retried, after its Retry-After but
+	// never more than MaxRetryWait.
+	Retries      int           `yaml:"retries"`
+	RetryOn      []int         `yaml:"retry_on"`
+	MaxRetryWait time.Duration `yaml:"max_retry_wait"`
+
+	// RetryPolicy replaces Retries and RetryOn with the most attempts for
+	// each status and for network errors, e.g. "429:5,503:5/2s,network:3".
+	RetryPolicy string `yaml:"retry_policy,omitempty"`
+
+	// Orphans crawls from StartURL and compares the pages reached with
+	// those listed in the sitemap at SitemapURL, which isn't warmed itself.
+	Orphans bool `yaml:"orphans,omitempty"`
+
+	// FailOnRedirectedLinks, unless negative, is the number of linked URLs
+	// that redirect the run fails beyond.
+	FailOnRedirectedLinks int `yaml:"fail_on_redirected_links"`
+
+	// SlowThreshold is the response time over which a page counts as slow,
+	// and FailOnSlow, unless negative, the number of slow pages the run
+	// fails beyond.
+	SlowThreshold time.Duration `yaml:"slow_threshold,omitempty"`
+	FailOnSlow    int           `yaml:"fail_on_slow"`
+
+	// Baseline is a file of response times from a known good run. A URL
+	// that takes RegressionThreshold longer than its baseline, and at least
+	// RegressionFloor, has regressed; more than MaxRegressions of them, unless
+	// negative, fail the run. WriteBaseline writes such a file for the run.
+	Baseline            string        `yaml:"baseline,omitempty"`
+	RegressionThreshold float64       `yaml:"regression_threshold,omitempty"`
+	RegressionFloor     time.Duration `yaml:"regression_floor,omitempty"`
+	MaxRegressions      int           `yaml:"max_regressions"`
+	WriteBaseline       string        `yaml:"write_baseline,omitempty"`
+
+	// MaxPageSize is the size in bytes over which a page is reported as
+	// oversized, along with pages whose size is a statistical outlier.
+	// With FailOnOversize they fail the run.
+	MaxPageSize    int64 `yaml:"max_page_size,omitempty"`
+	FailOnOversize bool  `yaml:"fail_on_oversize,omitempty"`
+
+	// AssertP95, AssertP99 and AssertMean, if set, are the latencies the
+	// successful responses must stay within for the run to pass.
+	AssertP95  time.Duration `yaml:"assert_p95,omitempty"`
+	AssertP99  time.Duration `yaml:"assert_p99,omitempty"`
+	AssertMean time.Duration `yaml:"assert_mean,omitempty"`
+
+	// CaptureHeaders are the response headers recorded for every URL, for
+	// the output.
+	CaptureHeaders []string `yaml:"capture_headers,omitempty"`
+
+	// RequireHeaders are the response headers every successful page must
+	// have, and RequireHeaderMatch "Name: regexp" pairs their values must
+	// match.
+	RequireHeaders     []string `yaml:"require_headers,omitempty"`
+	RequireHeaderMatch []string `yaml:"require_header_match,omitempty"`
+
+	// AssertSelector are the CSS selectors that must match an element of
+	// every successful page, and AssertContains the texts it must contain,
+	// either of them scoped to the URLs matching a pattern with
+	// "pattern=assertion".
+	AssertSelector []string `yaml:"assert_selector,omitempty"`
+	AssertContains []string `yaml:"assert_contains,omitempty"`
+
+	// Soft404 flags 200 responses that look like "not found" pages: whose
+	// title or headings match Soft404Pattern, that have an element matching
+	// Soft404Selector or whose body is smaller than Soft404MinSize. With
+	// FailOnSoft404 they fail the run.
+	Soft404         bool   `yaml:"soft_404,omitempty"`
+	Soft404Pattern  string `yaml:"soft_404_pattern,omitempty"`
+	Soft404Selector string `yaml:"soft_404_selector,omitempty"`
+	Soft404MinSize  int64  `yaml:"soft_404_min_size,omitempty"`
+	FailOnSoft404   bool   `yaml:"fail_on_soft_404,omitempty"`
+
+	// SEOAudit records the meta description, canonical link, h1s and
+	// robots noindex of every page, and reports the pages missing them.
+	SEOAudit bool `yaml:"seo_audit,omitempty"`
+
+	// CheckCompression asks for compressed responses and reports the HTML,
+	// CSS, JavaScript and JSON responses of at least 1KB that weren't. With
+	// FailOnUncompressed they fail the run.
+	CheckCompression   bool `yaml:"check_compression,omitempty"`
+	FailOnUncompressed bool `yaml:"fail_on_uncompressed,omitempty"`
+
+	// DetectDuplicates hashes every successful response body to find the
+	// URLs serving the same page, after removing the matches of
+	// DuplicateStrip, such as a CSRF token, if set.
+	DetectDuplicates bool   `yaml:"detect_duplicates,omitempty"`
+	DuplicateStrip   string `yaml:"duplicate_strip,omitempty"`
+
+	// ValidatorCache is the file the ETag and Last-Modified of every URL
+	// are kept in between runs, for ValidatorCacheKeep runs after its URL
+	// was last requested.
+	ValidatorCache     string `yaml:"validator_cache,omitempty"`
+	ValidatorCacheKeep int    `yaml:"validator_cache_keep,omitempty"`
+
+	// Alternates also warms the AMP and other HTML alternates a page links
+	// to in its head.
+	Alternates bool `yaml:"alternates,omitempty"`
+
+	// SitemapAssets also warms the images and videos listed with the image
+	// and video sitemap extensions.
+	SitemapAssets bool `yaml:"sitemap_assets,omitempty"`
+
+	// WriteSitemap is the file a sitemap of the HTML pages fetched is
+	// written to, with their Last-Modified as lastmod if
+	// WriteSitemapLastmod is set. WriteSitemapBase is the URL the files
+	// of a sitemap split in several are published under, by default the
+	// root of the site.
+	WriteSitemap        string `yaml:"write_sitemap,omitempty"`
+	WriteSitemapLastmod bool   `yaml:"write_sitemap_lastmod,omitempty"`
+	WriteSitemapBase    string `yaml:"write_sitemap_base,omitempty"`
+
+	// DetectChanges hashes the bodies like DetectDuplicates to compare
+	// them with the Previous run, and ChangedList is the file the URLs
+	// that changed are written to.
+	DetectChanges bool   `yaml:"detect_changes,omitempty"`
+	ChangedList   string `yaml:"changed_list,omitempty"`
+
+	// CheckExternal checks the external URLs linked from the crawled pages,
+	// ExternalConcurrency at a time and at most MaxExternal of them,
+	// without following their links.
+	CheckExternal       bool `yaml:"check_external,omitempty"`
+	ExternalConcurrency int  `yaml:"external_concurrency"`
+	MaxExternal         int  `yaml:"max_external"`
+
+	// CheckMixedContent reports the http:// URLs in href and src
+	// attributes of pages served over https.
+	CheckMixedContent bool `yaml:"check_mixed_content,omitempty"`
+
+	// SuccessCodes are the statuses and status classes, e.g. 2xx or 304,
+	// that count as a successful warm. Without any, every status below
+	// 400 does.
+	SuccessCodes []string `yaml:"success_codes,omitempty"`
+
+	// Rate caps the number of requests started per second across the whole
+	// run, so it is shared by every site.
+	Rate float64 `yaml:"rate,omitempty"`
+
+	// MaxBandwidth caps the response body bytes read per second across the
+	// whole run, e.g. 10MB/s.
+	MaxBandwidth string `yaml:"max_bandwidth,omitempty"`
+
+	// MaxTotalBytes stops the run from fetching any more URLs once this
+	// many response body bytes have been read.
+	MaxTotalBytes int64 `yaml:"max_total_bytes,omitempty"`
+
+	// Proxy is a proxy every request goes through, and ProxyFile a file of
+	// proxies, one URL per line, the requests are spread across in turn or
+	// at random as ProxyRotation says.
+	Proxy         string `yaml:"proxy,omitempty"`
+	ProxyFile     string `yaml:"proxy_file,omitempty"`
+	ProxyRotation string `yaml:"proxy_rotation,omitempty"`
+
+	// UnixSocket is a Unix socket every request is sent to, whatever the
+	// host of its URL.
+	UnixSocket string `yaml:"unix_socket,omitempty"`
+
+	// HTTP3 sends the requests over HTTP/3, falling back to HTTP/1.1 or
+	// HTTP/2 for the hosts that don't answer over QUIC.
+	HTTP3 bool `yaml:"http3,omitempty"`
+
+	// Timings times the DNS lookup, connection, TLS handshake, time to
+	// first byte and transfer of every request.
+	Timings bool `yaml:"timings,omitempty"`
+
+	// Sites lists the sites to warm in a multi-site run. Each entry takes
+	// the same keys as the top level and overrides the top-level values
+	// for that site; see siteConfigs.
+	Sites         []yaml.Node `yaml:"sites,omitempty"`
+	ParallelSites int         `yaml:"parallel_sites"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		LogLevel:       "info",
+		LogFormat:      "text",
+		MaxConcurrency: 10,
+		Timeout:        10 * time.Second,
+		Output:         formatText,
+		Sort:           sortURL,
+		ProgressFD:     2,
+		WebhookTimeout: 10 * time.Second,
+
+		NotifyOn:         notifyErrors,
+		SlackMaxFailures: 10,
+
+		PushJob: "gowarmer",
+
+		OTelSampleRatio: 1,
+
+		MaxBodySize: 10 << 20,
+
+		ExternalConcurrency: 2,
+		MaxExternal:         1000,
+
+		FailOnSlow:            -1,
+		FailOnRedirectedLinks: -1,
+
+		RegressionThreshold: 0.5,
+		RegressionFloor:     100 * time.Millisecond,
+
+		Soft404Pattern: defaultSoft404Pattern,
+
+		ValidatorCacheKeep: 5,
+
+		BreakerThreshold: 0.25,
+		BreakerWindow:    30 * time.Second,
+		BreakerCooldown:  30 * time.Second,
+		BreakerMaxOpen:   5 * time.Minute,
+
+		TrapMaxRepeats:     3,
+		TrapMaxParamValues: 100,
+		TrapMaxPatternURLs: 1000,
+
+		Retries:      3,
+		RetryOn:      []int{502, 503, 504},
+		MaxRetryWait: time.Minute,
+
+		PurgeMethod: "PURGE",
+
+		ParallelSites: 1,
+	}
+}
+
+// loadConfig reads a YAML config file on top of cfg. Keys that don't map to
+// an option are an error so typos don't go unnoticed.
+func loadConfig(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// siteConfigs returns the configuration of every site to warm: just cfg
+// itself unless it has a sites list. Each site starts out as a copy of the
+// top-level configuration, flags included, minus its URL inputs, and is
+// decoded as strictly as the file itself. Options that apply to the run
+// as a whole, such as the output, notifications, metrics and rate, are
+// only read from the top level.
+func (cfg Config) siteConfigs() ([]Config, error) {
+	if len(cfg.Sites) == 0 {
+		return []Config{cfg}, nil
+	}
+
+	var sites []Config
+	names := make(map[string]bool)
+	for i, node := range cfg.Sites {
+		site := cfg
+		site.Name, site.StartURL, site.SitemapURL, site.ListFile, site.WeightedFile = "", "", "", "", ""
+		site.OpenAPI = ""
+		site.Sites = nil
+		// Decoding merges into maps, so give the site its own.
+		site.Headers = maps.Clone(cfg.Headers)
+		site.WebhookHeaders = maps.Clone(cfg.WebhookHeaders)
+		site.PushLabels = maps.Clone(cfg.PushLabels)
+		site.PurgeHeaders = maps.Clone(cfg.PurgeHeaders)
+
+		data, err := yaml.Marshal(&node)
+		if err != nil {
+			return nil, fmt.Errorf("site %d: %w", i+1, err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&site); err != nil {
+			return nil, fmt.Errorf("site %d: %w", i+1, err)
+		}
+
+		switch {
+		case len(site.Sites) > 0:
+			return nil, fmt.Errorf("site %d: sites can't be nested", i+1)
+		case site.StartURL == "" && site.SitemapURL == "" && site.ListFile == "":
+			return nil, fmt.Errorf("site %d: one of url, sitemap or list is required", i+1)
+		}
+		if site.Name == "" {
+			site.Name = siteName(site)
+		}
+		if names[site.Name] {
+			return nil, fmt.Errorf("site %d: duplicate name %q", i+1, site.Name)
+		}
+		names[site.Name] = true
+		sites = append(sites, site)
+	}
+	return sites, nil
+}
+
+// siteName derives a default site name from the site's input.
+func siteName(cfg Config) string {
+	for _, u := range []string{cfg.StartURL, cfg.SitemapURL} {
+		if parsed, err := url.Parse(u); err == nil && parsed.Host != "" {
+			return parsed.Host
+		}
+	}
+	return cfg.ListFile
+}
+
+// configPath finds the -config argument before the flags are parsed, since
+// the file provides the defaults that the other flags override.
+func configPath(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return os.Getenv(envName("config"))
+}
+
+const redacted = "REDACTED"
+
+// printConfig writes the effective configuration as YAML, with secrets
+// redacted.
+func printConfig(cfg Config) error {
+	if cfg.Password != "" {
+		cfg.Password = redacted
+	}
+	if cfg.HMACSecret != "" {
+		cfg.HMACSecret = redacted
+	}
+	if cfg.WebhookSecret != "" {
+		cfg.WebhookSecret = redacted
+	}
+	if cfg.SlackWebhook != "" {
+		cfg.SlackWebhook = redacted
+	}
+	if cfg.PushPassword != "" {
+		cfg.PushPassword = redacted
+	}
+	cfg.Headers = redactHeaders(cfg.Headers)
+	cfg.WebhookHeaders = redactHeaders(cfg.WebhookHeaders)
+	cfg.PurgeHeaders = redactHeaders(cfg.PurgeHeaders)
+	sites := make([]yaml.Node, len(cfg.Sites))
+	for i, site := range cfg.Sites {
+		sites[i] = redactSite(site)
+	}
+	cfg.Sites = sites
+
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// secretKeys are the config keys printConfig redacts.
+var secretKeys = map[string]bool{
+	"password":       true,
+	"sign_hmac":      true,
+	"webhook_secret": true,
+	"slack_webhook":  true,
+	"push_password":  true,
+}
+
+// redactSite returns a copy of a sites entry with its secrets redacted.
+func redactSite(site yaml.Node) yaml.Node {
+	if site.Kind != yaml.MappingNode {
+		return site
+	}
+	content := make([]*yaml.Node, len(site.Content))
+	copy(content, site.Content)
+	for i := 0; i+1 < len(content); i += 2 {
+		key, value := content[i].Value, content[i+1]
+		switch {
+		case secretKeys[key]:
+			content[i+1] = &yaml.Node{Kind: yaml.ScalarNode, Value: redacted}
+		case (key == "headers" || key == "webhook_headers" || key == "purge_headers") && value.Kind == yaml.MappingNode:
+			headers := *value
+			headers.Content = make([]*yaml.Node, len(value.Content))
+			copy(headers.Content, value.Content)
+			for j := 0; j+1 < len(headers.Content); j += 2 {
+				if sensitiveHeader(headers.Content[j].Value) {
+					headers.Content[j+1] = &yaml.Node{Kind: yaml.ScalarNode, Value: redacted}
+				}
+			}
+			content[i+1] = &headers
+		}
+	}
+	site.Content = content
+	return site
+}
+
+func redactHeaders(headers map[string]string) map[string]string {
+	if len(headers) == 0 {
+		return headers
+	}
+	res := make(map[string]string, len(headers))
+	for name, value := range headers {
+		if sensitiveHeader(name) {
+			value = redacted
+		}
+		res[name] = value
+	}
+	return res
+}
+
+// sensitiveHeader reports whether a header is likely to carry a credential.
+func sensitiveHeader(name string) bool {
+	name = strings.ToLower(name)
+	if name == "authorization" || name == "proxy-authorization" || name == "cookie" {
+		return true
+	}
+	for _, s := range []string{"token", "secret", "key", "auth", "password"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// headerFlag parses "Header1:Value1,Header2:Value2" into a header map.
+type headerFlag struct {
+	headers *map[string]string
+}
+
+func (f headerFlag) String() string {
+	if f.headers == nil {
+		return ""
+	}
+	var pairs []string
+	for name, value := range *f.headers {
+		pairs = append(pairs, name+":"+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f headerFlag) Set(s string) error {
+	if *f.headers == nil {
+		*f.headers = make(map[string]string)
+	}
+	for _, h := range strings.Split(s, ",") {
+		parts := strings.SplitN(h, ":", 2)
+		if len(parts) == 2 {
+			(*f.headers)[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	return nil
+}
+
+// variantFlag is a flag holding header values to warm variants with, in the
+// form Header:value1|value2,...
+type variantFlag struct {
+	variants *map[string][]string
+}
+
+func (f variantFlag) String() string {
+	if f.variants == nil {
+		return ""
+	}
+	var pairs []string
+	for name, values := range *f.variants {
+		pairs = append(pairs, name+":"+strings.Join(values, "|"))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f variantFlag) Set(s string) error {
+	*f.variants = make(map[string][]string)
+	for _, v := range strings.Split(s, ",") {
+		name, values, ok := strings.Cut(v, ":")
+		if !ok {
+			return fmt.Errorf("invalid variant %q, expected Header:value1|value2", v)
+		}
+		for _, value := range strings.Split(values, "|") {
+			if value = strings.TrimSpace(value); value != "" {
+				(*f.variants)[strings.TrimSpace(name)] = append((*f.variants)[strings.TrimSpace(name)], value)
+			}
+		}
+	}
+	return nil
+}
+
+// optionalBool is a boolean flag that can be left unset, for a default that
+// depends on other flags.
+type optionalBool struct {
+	value **bool
+}
+
+func (f optionalBool) IsBoolFlag() bool { return true }
+
+func (f optionalBool) String() string {
+	if f.value == nil || *f.value == nil {
+		return ""
+	}
+	return strconv.FormatBool(**f.value)
+}
+
+func (f optionalBool) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*f.value = &v
+	return nil
+}
+
+// stringList is a flag that can be repeated, collecting every value. Values
+// given on the command line replace those from the config file.
+type stringList struct {
+	values *[]string
+	set    bool
+}
+
+func newStringList(values *[]string) *stringList {
+	return &stringList{values: values}
+}
+
+func (l *stringList) String() string {
+	if l.values == nil {
+		return ""
+	}
+	return strings.Join(*l.values, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	if !l.set {
+		*l.values = nil
+		l.set = true
+	}
+	*l.values = append(*l.values, s)
+	return nil
+}
+
+// commaList is a flag holding a comma separated list.
+type commaList struct {
+	values *[]string
+}
+
+func (l commaList) String() string {
+	if l.values == nil {
+		return ""
+	}
+	return strings.Join(*l.values, ",")
+}
+
+func (l commaList) Set(s string) error {
+	*l.values = nil
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l.values = append(*l.values, v)
+		}
+	}
+	return nil
+}
+
+// statusList is a flag holding a comma separated list of HTTP status codes.
+type statusList struct {
+	values *[]int
+}
+
+func (l statusList) String() string {
+	if l.values == nil {
+		return ""
+	}
+	codes := make([]string, len(*l.values))
+	for i, code := range *l.values {
+		codes[i] = strconv.Itoa(code)
+	}
+	return strings.Join(codes, ",")
+}
+
+func (l statusList) Set(s string) error {
+	*l.values = nil
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		code, err := strconv.Atoi(v)
+		if err != nil || code < 100 || code > 599 {
+			return fmt.Errorf("invalid status code %q", v)
+		}
+		*l.values = append(*l.values, code)
+	}
+	return nil
+}
@@ -0,0 +1,1473 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Result describes the outcome of fetching a single URL.
+type Result struct {
+	// Site is the name of the site the URL belongs to in a multi-site run.
+	Site string
+
+	URL        string
+	Referrer   string
+	StatusCode int
+	Status     string
+
+	// Header is the full response header as passed to OnResult. The results
+	// kept for the report don't retain it.
+	Header http.Header
+
+	ResponseTime time.Duration
+	Size         int64
+	Err          error
+
+	// Variants describes the variants of the URL warmed because the
+	// response varies on headers there are variant values for, each with
+	// its status or error.
+	Variants []string
+
+	// SecondResponseTime is how long fetching the URL again took with
+	// MeasureSpeedup, and Speedup how many times faster that was.
+	SecondResponseTime time.Duration
+	Speedup            float64
+
+	// Repeat has the spread of the response times with -repeat.
+	Repeat *repeatTimings
+
+	// Load aggregates all the requests for the URL in a -duration run.
+	Load *urlLoad
+
+	// ErrClass is the class of Err when the request itself failed, e.g.
+	// timeout or dns_nxdomain.
+	ErrClass string
+
+	// TimeoutLimit is the limit a request that timed out was held to, set
+	// when there are -timeout-for rules.
+	TimeoutLimit string
+
+	// FetchedAt is when the response was received, and ETag and
+	// LastModified its validators, kept for incremental runs.
+	FetchedAt    time.Time
+	ETag         string
+	LastModified string
+
+	// ContentType is the Content-Type of the response.
+	ContentType string
+
+	// Protocol is the protocol the response came over with -http3, e.g.
+	// HTTP/3.0, and HTTP3Fallback is set when that isn't HTTP/3.
+	Protocol      string
+	HTTP3Fallback bool
+
+	// Timings are the durations of the phases of the request, with
+	// -timings.
+	Timings *phaseTimings
+
+	// RetryPolicy is the retry policy entry that applied to the URL, e.g.
+	// 503:5, if any.
+	RetryPolicy string
+
+	// Alternate is alternateAMP or alternateHTML for a page found as an
+	// alternate format of its referrer with -alternates.
+	Alternate string
+
+	// Asset is assetImage or assetVideo for an image or video a sitemap
+	// lists with -sitemap-assets, and API is set for an operation of the
+	// -openapi spec.
+	Asset string
+	API   bool
+
+	// FinalURL is where the request ended up after redirects, if that's
+	// not URL. OffHost is set when that is a host links aren't followed
+	// to, in which case the page's links aren't extracted.
+	FinalURL string
+	OffHost  bool
+
+	// Purged is set when a purge request was sent before the fetch, with
+	// its status, duration and error in the other Purge fields.
+	Purged      bool
+	PurgeStatus int
+	PurgeTime   time.Duration
+	PurgeErr    error
+
+	// Fresh is set when the URL wasn't fetched because the previous run's
+	// result is still fresh. The other fields are carried over from it.
+	Fresh bool
+
+	// Attempts is the number of requests it took, more than one if the
+	// URL was retried, in which case History has the outcome of each.
+	Attempts int
+	History  []Attempt
+
+	// CapturedHeaders are the response headers named by -capture-header.
+	CapturedHeaders http.Header
+
+	// HeaderViolations are the ways the response fails the -require-header
+	// and -require-header-match requirements, and RequiredHeaders the
+	// values of the required headers it has.
+	HeaderViolations []string
+	RequiredHeaders  map[string]string
+
+	// Assertions are the outcomes of the -assert-selector and
+	// -assert-contains assertions that apply to the page.
+	Assertions []assertionOutcome
+
+	// SEO is the page's -seo-audit.
+	SEO *seoAudit
+
+	// Soft404 is why a 200 response looks like a "not found" page, with
+	// -soft-404.
+	Soft404 string
+
+	// MixedContent are the http:// URLs referenced by an https page, with
+	// CheckMixedContent.
+	MixedContent []string
+
+	// Uncompressed is set, with -check-compression, for a response that
+	// should have been compressed but wasn't, and GzipEstimate is the size
+	// it would have had gzipped.
+	Uncompressed bool
+	GzipEstimate int64
+
+	// BodyHash is the SHA-256 of the body, with -detect-duplicates or
+	// -detect-changes.
+	BodyHash string
+
+	// RedirectStatus is the status of the first redirect followed to
+	// FinalURL.
+	RedirectStatus int
+
+	// MetaRefresh is the URL a <meta http-equiv="refresh"> tag on the page
+	// sends visitors to.
+	MetaRefresh string
+
+	// Slow is set when the page took longer than SlowThreshold, and
+	// Oversize when its body is larger than MaxPageSize.
+	Slow     bool
+	Oversize bool
+
+	// NoIndex is set for a page marked noindex by its robots meta tag or
+	// X-Robots-Tag header, with RespectMetaRobots.
+	NoIndex bool
+}
+
+// RequestHook can modify an outgoing request, e.g. to sign it.
+type RequestHook func(*http.Request) error
+
+// Crawler warms a site starting from a URL or a sitemap.
+type Crawler struct {
+	Config
+
+	// OnResult, if set, is called exactly once for every URL the crawler
+	// attempts to fetch, including failed ones. It is called from the
+	// worker goroutines without any internal lock held, so it may run
+	// concurrently with itself and must be safe for concurrent use. A slow
+	// callback only delays the worker that invoked it. OnResult is never
+	// called after Run returns.
+	OnResult func(Result)
+
+	// RequestHooks are run in registration order on every outgoing request,
+	// after the default headers and basic auth have been applied and before
+	// the request is sent. A hook returning an error aborts the request and
+	// the URL is recorded as failed with that error.
+	RequestHooks []RequestHook
+
+	client   *http.Client
+	include  []*regexp.Regexp
+	exclude  []*regexp.Regexp
+	weights  []weightedPattern
+	timeouts []*timeoutRule
+	retries  retryPolicy
+	seen     seenSet
+	results  map[string]Result
+	stats    *stats
+	lock     sync.Mutex
+	frontier *frontier
+
+	// totalKnown is set once every input URL has been scheduled, from
+	// which point the number of seen URLs is a meaningful total.
+	totalKnown atomic.Bool
+
+	// listeners are the built-in consumers of results, called just like
+	// OnResult.
+	listeners []func(Result)
+
+	tracer trace.Tracer
+	runCtx context.Context
+
+	inFlight atomic.Int64
+
+	// shard is the share of the URLs this instance fetches. URLs of other
+	// shards are counted in otherShard and written to skipped.
+	shard      shard
+	otherShard int
+	skipped    *skippedFile
+
+	// sitemapAvailable and sitemapSelected are the number of sitemap URLs
+	// that passed the filters and the number of them selected to warm by
+	// -sitemap-limit or -sample, and seed the seed of the sample.
+	sitemapAvailable int
+	sitemapSelected  int
+	seed             int64
+
+	// tuner adjusts the requests in flight with -c auto, which peaked at
+	// concurrencyPeak and averaged concurrencyAverage over the run.
+	tuner              *concurrencyTuner
+	concurrencyPeak    int
+	concurrencyAverage float64
+
+	// archive saves the response bodies with -save-bodies, savedFiles of
+	// them with savedBytes in total so far.
+	archive    *archive
+	savedFiles int
+	savedBytes int64
+
+	// changes are the content changes since the previous run, found at the
+	// end of the run with -detect-changes.
+	changes *contentChanges
+
+	// traffic are the weights of the URLs of a -weighted-file.
+	traffic *trafficWeights
+
+	// baseline are the response times of a known good run given with
+	// -baseline, and regressions the outcome of comparing the run with it.
+	baseline    *baseline
+	regressions *baselineComparison
+
+	// validators are the ETag and Last-Modified values kept between runs
+	// with -validator-cache, which made conditionalRequests of the requests
+	// conditional.
+	validators          *validatorCache
+	conditionalRequests int
+
+	// warc writes the responses to a WARC file with -warc, warcResponses
+	// of them so far.
+	warc          *warcWriter
+	warcResponses int
+
+	// breaker holds the requests back while the origin looks unhealthy.
+	// It opened breakerTrips times, for breakerOpen in total.
+	breaker      *circuitBreaker
+	breakerTrips int
+	breakerOpen  time.Duration
+
+	// loads aggregates the requests for each URL in a -duration run, by
+	// resultKey.
+	loads map[string]*urlLoad
+
+	// linksDiscovered counts the new links found on pages with
+	// -crawl-sample, and sampledOut those of them not fetched.
+	linksDiscovered int
+	sampledOut      int
+
+	// variants are the values to warm each varied request header with.
+	variants map[string][]string
+
+	// success are the statuses that count as a successful warm.
+	success successCodes
+
+	// duplicateStrip is removed from bodies before they are hashed.
+	duplicateStrip *regexp.Regexp
+
+	// external checks the external links, with -check-external.
+	external *externalChecker
+
+	// inlinks are the links to each URL by urlKey, without -low-memory.
+	inlinks map[string]*inlinks
+
+	// sitemapURLs are the URLs in the sitemap by urlKey, with -orphans.
+	sitemapURLs map[string]string
+
+	// requiredHeaders are the headers every successful page must have.
+	requiredHeaders []headerRequirement
+
+	// assertions are the content assertions of -assert-selector and
+	// -assert-contains.
+	assertions []*contentAssertion
+
+	soft404 *soft404Detector
+
+	// redirectLoops are the redirect loops detected, and loopMembers the
+	// urlKeys of the URLs in them, which aren't queued again.
+	redirectLoops []redirectLoop
+	loopMembers   map[string]bool
+
+	// failedSitemaps are the sitemaps that couldn't be loaded.
+	failedSitemaps []sitemapFailure
+
+	// openAPISkipped are the operations of the -openapi spec that weren't
+	// warmed for lack of parameter values.
+	openAPISkipped []openAPISkipped
+
+	// verification is the outcome of the -verify pass.
+	verification *verification
+
+	// hosts limits and tracks the requests in flight per host.
+	hosts *hostLimiter
+
+	// skippedLinks counts the links that weren't followed because they
+	// don't point to a crawlable page.
+	skippedLinks atomic.Int64
+
+	// dispatched counts the URLs handed to workers, for MaxPages. Once a
+	// limit is hit, stoppedBy names it and the remaining URLs are counted
+	// in notWarmed instead of being fetched.
+	dispatched atomic.Int64
+	stoppedBy  string
+	notWarmed  int
+
+	// quit is set by stop, and skippedHosts has the number of queued URLs
+	// dropped for each host skipped with skipHost.
+	quit         atomic.Bool
+	skippedHosts map[string]int
+
+	// authFailuresInRow counts the 401 and 403 responses in a row from the
+	// primary host; authAborted is set and authStop stops the run when
+	// there were too many.
+	authFailuresInRow int
+	authAborted       bool
+	authStop          atomic.Bool
+
+	// previous holds the results of an earlier run to skip still-fresh
+	// URLs with.
+	previous *previousRun
+
+	// limiter, if set, is waited on before every request. It may be shared
+	// with other crawlers.
+	limiter *rateLimiter
+
+	// budget, if set, is the MaxTotalBytes budget, shared with the other
+	// crawlers of the run.
+	budget *byteBudget
+
+	// proxies, if set, is the pool of proxies the requests are spread
+	// across, shared with the other crawlers of the run.
+	proxies *proxyPool
+
+	// traps, with -trap-detection, caps the links followed into what look
+	// like infinite URL spaces.
+	traps *trapDetector
+
+	// backoff slows the crawler down while the site answers 429s.
+	backoff backoff
+
+	runID    string
+	started  time.Time
+	finished time.Time
+	elapsed  time.Duration
+
+	// pausedAt is when the crawl was paused, zero while it's running, and
+	// pausedFor the time spent paused before that.
+	pausedAt  time.Time
+	pausedFor time.Duration
+
+	rate       rateMeter
+	throughput throughputMeter
+
+	// sites holds the per-site crawlers when c is the roll-up of a
+	// multi-site run.
+	sites []*Crawler
+
+	// wg counts the tasks that have been queued but not yet processed.
+	wg sync.WaitGroup
+}
+
+func NewCrawler(cfg Config) (*Crawler, error) {
+	c := &Crawler{
+		Config: cfg,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+		stats:  newStats(cfg.LowMemory),
+		hosts:  newHostLimiter(cfg.MaxConcurrencyPerHost),
+		runID:  cfg.RunID,
+		runCtx: context.Background(),
+	}
+	if c.runID == "" {
+		c.runID = newRunID()
+	}
+
+	c.client.CheckRedirect = c.checkRedirect
+	c.variants = cfg.variantValues()
+	c.StartURL = removeHashFromURL(cfg.StartURL)
+	if c.MaxBodySize <= 0 {
+		c.MaxBodySize = math.MaxInt64
+	}
+
+	if cfg.LowMemory {
+		c.seen = make(hashSet)
+	} else {
+		c.seen = make(stringSet)
+		c.results = make(map[string]Result)
+		c.inlinks = make(map[string]*inlinks)
+	}
+
+	// A roll-up of several sites doesn't crawl anything itself.
+	if cfg.Orphans && len(cfg.Sites) == 0 && (cfg.StartURL == "" || cfg.SitemapURL == "") {
+		return nil, fmt.Errorf("-orphans needs both a URL to crawl from and a sitemap")
+	}
+	if cfg.Orphans && cfg.LowMemory {
+		return nil, fmt.Errorf("-orphans needs every result in memory and can't be used with -low-memory")
+	}
+
+	if err := validateSampling(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateLoad(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.UnixSocket != "" {
+		if err := validateUnixSocket(cfg); err != nil {
+			return nil, err
+		}
+		c.client.Transport = unixSocketTransport(cfg.UnixSocket)
+	}
+	if cfg.HTTP3 {
+		if cfg.UnixSocket != "" || cfg.Proxy != "" || cfg.ProxyFile != "" {
+			return nil, fmt.Errorf("-http3 can't be used with -unix-socket, -proxy or -proxy-file")
+		}
+		c.client.Transport = newHTTP3Transport(nil, nil)
+	}
+	if !cfg.NoBreaker {
+		if cfg.BreakerThreshold <= 0 || cfg.BreakerThreshold > 1 {
+			return nil, fmt.Errorf("-breaker-threshold %v out of range, expected a percentage above 0%% and up to 100%%", percentFlag{&cfg.BreakerThreshold})
+		}
+		if cfg.BreakerWindow <= 0 || cfg.BreakerCooldown <= 0 {
+			return nil, fmt.Errorf("-breaker-window and -breaker-cooldown must be positive")
+		}
+		if cfg.BreakerMaxOpen < 0 {
+			return nil, fmt.Errorf("-breaker-max-open can't be negative")
+		}
+		c.breaker = newCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerWindow, cfg.BreakerCooldown, cfg.BreakerMaxOpen)
+	}
+	if cfg.AutoConcurrency {
+		if cfg.MaxAutoConcurrency < 0 {
+			return nil, fmt.Errorf("-c-max can't be negative")
+		}
+		c.tuner = newConcurrencyTuner(cfg.MaxAutoConcurrency)
+	}
+	if cfg.LoadDuration > 0 {
+		if cfg.LowMemory {
+			return nil, fmt.Errorf("-duration keeps statistics for every URL and can't be used with -low-memory")
+		}
+		c.loads = make(map[string]*urlLoad)
+	}
+	c.seed = cfg.Seed
+	if c.seed == 0 && (cfg.Shuffle || cfg.Sample > 0 || cfg.SampleN > 0 || cfg.CrawlSample > 0) {
+		c.seed = time.Now().UnixNano()
+	}
+
+	if !validOrder(cfg.Order) {
+		return nil, fmt.Errorf("unknown order %q, expected priority or lastmod", cfg.Order)
+	}
+	if !validSort(cfg.Sort) {
+		return nil, fmt.Errorf("unknown sort %q, expected url, status or time", cfg.Sort)
+	}
+
+	var err error
+	if c.include, err = compilePatterns(cfg.Include); err != nil {
+		return nil, fmt.Errorf("include: %w", err)
+	}
+	if c.exclude, err = compilePatterns(cfg.Exclude); err != nil {
+		return nil, fmt.Errorf("exclude: %w", err)
+	}
+	if c.weights, err = parseWeights(cfg.Priorities); err != nil {
+		return nil, fmt.Errorf("priority: %w", err)
+	}
+	if c.timeouts, err = parseTimeoutRules(cfg.TimeoutFor); err != nil {
+		return nil, fmt.Errorf("timeout-for: %w", err)
+	}
+	c.retries = legacyRetryPolicy(cfg.Retries, cfg.RetryOn)
+	if cfg.RetryPolicy != "" {
+		if c.retries, err = parseRetryPolicy(cfg.RetryPolicy); err != nil {
+			return nil, fmt.Errorf("retry-policy: %w", err)
+		}
+	}
+	// The client allows the longest timeout; each request gets its own
+	// deadline.
+	for _, r := range c.timeouts {
+		if c.client.Timeout > 0 && r.timeout > c.client.Timeout {
+			c.client.Timeout = r.timeout
+		}
+	}
+	// The weights of a -weighted-file are the priorities of its URLs.
+	less := taskLess(cfg.Order, len(c.weights) > 0 || cfg.WeightedFile != "")
+	if cfg.Shuffle && less == nil {
+		less = func(a, b task) bool { return a.seq < b.seq }
+	}
+	c.frontier = newFrontier(less)
+	if cfg.Shuffle {
+		c.frontier.shuffle(c.seed)
+	}
+
+	if c.success, err = parseSuccessCodes(cfg.SuccessCodes); err != nil {
+		return nil, fmt.Errorf("success codes: %w", err)
+	}
+	if c.requiredHeaders, err = parseHeaderRequirements(cfg.RequireHeaders, cfg.RequireHeaderMatch); err != nil {
+		return nil, fmt.Errorf("required headers: %w", err)
+	}
+	if c.assertions, err = parseAssertions(cfg.AssertSelector, cfg.AssertContains); err != nil {
+		return nil, fmt.Errorf("content assertions: %w", err)
+	}
+	if c.traps, err = newTrapDetector(cfg); err != nil {
+		return nil, fmt.Errorf("trap detection: %w", err)
+	}
+	if cfg.DuplicateStrip != "" {
+		if c.duplicateStrip, err = regexp.Compile(cfg.DuplicateStrip); err != nil {
+			return nil, fmt.Errorf("duplicate strip: %w", err)
+		}
+	}
+	if c.soft404, err = newSoft404Detector(cfg); err != nil {
+		return nil, fmt.Errorf("soft 404: %w", err)
+	}
+
+	if cfg.Shard != "" {
+		if c.shard, err = parseShard(cfg.Shard); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.HMACSecret != "" {
+		c.AddRequestHook(hmacSigner(cfg.HMACSecret))
+	}
+
+	return c, nil
+}
+
+// AddRequestHook registers a hook to run after the already registered ones.
+func (c *Crawler) AddRequestHook(h RequestHook) {
+	c.RequestHooks = append(c.RequestHooks, h)
+}
+
+// Run crawls until every discovered URL has been fetched and returns the
+// total crawl time.
+func (c *Crawler) Run() time.Duration {
+	start := time.Now()
+
+	c.lock.Lock()
+	c.started = start
+	c.lock.Unlock()
+
+	if c.tracer != nil {
+		var span trace.Span
+		c.runCtx, span = c.tracer.Start(context.Background(), "gowarmer.run",
+			trace.WithAttributes(attribute.String("gowarmer.run_id", c.runID)))
+		defer span.End()
+	}
+
+	if c.CheckExternal {
+		client := &http.Client{Timeout: c.Timeout, Transport: c.client.Transport}
+		c.external = newExternalChecker(client, c.ExternalConcurrency, c.MaxExternal)
+	}
+
+	if c.ShardSkipped != "" {
+		var err error
+		if c.skipped, err = createSkippedFile(c.ShardSkipped); err != nil {
+			slog.Error("can't record URLs of other shards", "error", err)
+		}
+		defer func() {
+			if err := c.skipped.close(); err != nil {
+				slog.Error("writing URLs of other shards failed", "error", err)
+			}
+		}()
+	}
+
+	workers := c.MaxConcurrency
+	if c.tuner != nil {
+		// The tuner lets only as many of them work as it sees fit.
+		workers = c.tuner.max
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	var pool sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		pool.Add(1)
+		go func() {
+			defer pool.Done()
+			c.worker()
+		}()
+	}
+
+	// An ordered or shuffled crawl queues all of its input before fetching
+	// anything, otherwise the first URLs would go out in input order.
+	if c.Order != orderFIFO || len(c.weights) > 0 || c.Shuffle || c.WeightedFile != "" {
+		c.frontier.setHeld(true)
+	}
+	if c.Orphans {
+		c.loadSitemapURLs()
+		c.schedule(c.StartURL, "")
+	} else if c.SitemapURL != "" && c.sampling() {
+		if err := c.scheduleSample(); err != nil {
+			slog.Error("sitemap failed", "error", err)
+			c.sitemapFailed(c.SitemapURL, err)
+		}
+		c.totalKnown.Store(true)
+	} else if c.SitemapURL != "" {
+		if err := c.processSitemapURL(c.SitemapURL, c.scheduleTask); err != nil {
+			slog.Error("sitemap failed", "error", err)
+			c.sitemapFailed(c.SitemapURL, err)
+		}
+		c.totalKnown.Store(true)
+	} else if c.WeightedFile != "" {
+		if err := c.processWeightedFile(c.WeightedFile); err != nil {
+			slog.Error("reading the weighted file failed", "error", err)
+		}
+		c.totalKnown.Store(true)
+	} else if c.ListFile != "" {
+		if err := c.processList(c.ListFile); err != nil {
+			slog.Error("reading URL list failed", "error", err)
+		}
+		c.totalKnown.Store(true)
+	} else if c.StartURL != "" {
+		c.schedule(c.StartURL, "")
+	}
+	if c.OpenAPI != "" {
+		if err := c.processOpenAPI(); err != nil {
+			slog.Error("reading the OpenAPI spec failed", c.logArgs("error", err)...)
+		}
+		if c.StartURL == "" {
+			c.totalKnown.Store(true)
+		}
+	}
+	c.frontier.setHeld(false)
+
+	c.wg.Wait()
+	c.frontier.close()
+	pool.Wait()
+	c.external.wait()
+
+	// Sitemaps fail and loops are found in whatever order the requests
+	// finish; the report lists them in a canonical order so identical runs
+	// produce identical reports.
+	c.warnUnusedTimeouts()
+	c.compareWithPrevious()
+	c.compareWithBaseline()
+
+	c.lock.Lock()
+	c.finished = time.Now()
+	if c.tuner != nil {
+		c.concurrencyPeak, c.concurrencyAverage = c.tuner.usage(c.finished)
+	}
+	if c.breaker != nil {
+		c.breakerTrips, c.breakerOpen = c.breaker.usage(c.finished)
+	}
+	sort.Slice(c.failedSitemaps, func(i, j int) bool { return c.failedSitemaps[i].URL < c.failedSitemaps[j].URL })
+	sort.Slice(c.redirectLoops, func(i, j int) bool {
+		return strings.Join(c.redirectLoops[i].Chain, " ") < strings.Join(c.redirectLoops[j].Chain, " ")
+	})
+	c.lock.Unlock()
+
+	slog.Debug("skipped non-crawlable links", c.logArgs("count", c.skippedLinks.Load())...)
+
+	c.elapsed = time.Since(start)
+	return c.elapsed
+}
+
+// counts returns the number of finished and failed fetches, the number of
+// queued URLs and, if it is known, the total number of URLs.
+func (c *Crawler) counts() (done, errors, queued, total int) {
+	c.lock.Lock()
+	done, errors = c.stats.pages+c.stats.fresh, c.stats.errors
+	if c.totalKnown.Load() {
+		total = c.seen.len() - c.otherShard - c.sampledOut - c.traps.suppressed()
+	}
+	c.lock.Unlock()
+	return done, errors, c.frontier.len(), total
+}
+
+func (c *Crawler) requestRate(now, since time.Time) float64 {
+	return c.rate.rate(now, since)
+}
+
+func (c *Crawler) active() int64 {
+	return c.inFlight.Load()
+}
+
+// concurrency returns the current limit of requests in flight with -c auto,
+// or 0 otherwise.
+func (c *Crawler) concurrency() int {
+	return c.tuner.current()
+}
+
+// schedule queues u for fetching unless it has been seen before, is
+// filtered out by the include and exclude patterns or belongs to another
+// shard. The lock is only held for the check itself, never while queueing.
+func (c *Crawler) schedule(u, referrer string) {
+	if referrer != "" {
+		c.recordLink(u, referrer)
+	}
+	c.scheduleTask(task{url: u, referrer: referrer, link: referrer != ""})
+}
+
+// scheduleTask is schedule for a task that carries sitemap metadata.
+// Fragments are stripped first: they never make a URL a different page.
+// URLs from every source are deduplicated by their urlKey, so a page listed
+// in the sitemap as /about/ isn't warmed again when a link spells it /about.
+func (c *Crawler) scheduleTask(t task) {
+	t.url = removeHashFromURL(t.url)
+	u := t.url
+	if u != c.StartURL && !c.allowed(u) {
+		return
+	}
+	key := urlKey(u)
+	t.weight = c.weight(u)
+	owned := u == c.StartURL || c.shard.owns(u)
+
+	c.lock.Lock()
+	if c.inRedirectLoop(u) || c.hostSkipped(u) {
+		c.lock.Unlock()
+		return
+	}
+	isNew := c.seen.add(key)
+	if isNew && !owned {
+		c.otherShard++
+	}
+	sampledOut := isNew && owned && t.link && !c.sampledIn(u)
+	if isNew && owned && t.link && c.CrawlSample > 0 {
+		c.linksDiscovered++
+		if sampledOut {
+			c.sampledOut++
+		}
+	}
+	trapped := isNew && owned && t.link && !sampledOut && c.traps != nil && !c.traps.admit(u)
+	c.lock.Unlock()
+
+	switch {
+	case !isNew:
+	case !owned:
+		c.skipped.add(u)
+	case sampledOut, trapped:
+	default:
+		c.enqueue(t)
+	}
+}
+
+// allowed reports whether u passes the include and exclude patterns.
+func (c *Crawler) allowed(u string) bool {
+	for _, re := range c.exclude {
+		if re.MatchString(u) {
+			return false
+		}
+	}
+	if len(c.include) == 0 {
+		return true
+	}
+	for _, re := range c.include {
+		if re.MatchString(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// weightedPattern is a -priority pattern with its weight.
+type weightedPattern struct {
+	weight float64
+	re     *regexp.Regexp
+}
+
+// parseWeights parses -priority values of the form "weight:pattern".
+func parseWeights(specs []string) ([]weightedPattern, error) {
+	var res []weightedPattern
+	for _, spec := range specs {
+		w, pattern, ok := strings.Cut(spec, ":")
+		weight, err := strconv.ParseFloat(strings.TrimSpace(w), 64)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid priority %q, expected weight:pattern", spec)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, weightedPattern{weight: weight, re: re})
+	}
+	return res, nil
+}
+
+// weight returns the weight of the first -priority pattern u matches.
+func (c *Crawler) weight(u string) float64 {
+	for _, w := range c.weights {
+		if w.re.MatchString(u) {
+			return w.weight
+		}
+	}
+	return 0
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// enqueue adds a URL to the frontier. The WaitGroup is incremented before the
+// task becomes visible to workers so Run can never observe a zero count while
+// work is still pending.
+func (c *Crawler) enqueue(t task) {
+	c.wg.Add(1)
+	c.frontier.push(t)
+}
+
+func (c *Crawler) worker() {
+	for {
+		c.breaker.acquire()
+		t, ok := c.frontier.pop()
+		if !ok {
+			c.breaker.release()
+			return
+		}
+		// A task parked by the host limiter stays pending until it is
+		// queued again.
+		host := taskHost(t)
+		if !c.hosts.acquire(host, t) {
+			c.breaker.release()
+			continue
+		}
+		// A task parked by the host limiter may be on a host skipped while
+		// it waited.
+		if !c.dropIfSkipped(t) && c.claim(t) {
+			// The tuner only counts the requests actually made, so that
+			// it can tell whether its limit is used.
+			c.tuner.acquire()
+			c.crawl(t)
+			c.tuner.release()
+		}
+		c.breaker.release()
+		if next, ok := c.hosts.release(host); ok {
+			c.frontier.push(next)
+		}
+		c.wg.Done()
+	}
+}
+
+// stoppedByQuit is the stoppedBy of a crawl stopped before the end with
+// stop.
+const stoppedByQuit = "quit"
+
+// claim reports whether t may be fetched under the MaxPages, MaxDuration
+// and MaxTotalBytes limits, and whether the circuit breaker gave up. MaxDuration counts active time, so time spent
+// paused doesn't use it up, and a retry doesn't count as another page.
+// Requests in flight when the byte budget runs out still finish.
+func (c *Crawler) claim(t task) bool {
+	// The end of a -duration run isn't a limit: the URLs are just no
+	// longer requested again.
+	if c.LoadDuration > 0 && c.activeTime(time.Now()) >= c.LoadDuration {
+		return false
+	}
+	var stoppedBy string
+	switch {
+	case c.authStop.Load():
+		stoppedBy = stoppedByAuth
+	case c.quit.Load():
+		stoppedBy = stoppedByQuit
+	case c.breaker.givenUp():
+		stoppedBy = "breaker-max-open"
+	case c.budget.exhausted():
+		stoppedBy = "max-total-bytes"
+	case c.MaxDuration > 0 && c.activeTime(time.Now()) >= c.MaxDuration:
+		stoppedBy = "max-duration"
+	case c.MaxPages > 0 && t.attempt == 0 && c.dispatched.Add(1) > int64(c.MaxPages):
+		stoppedBy = "max-pages"
+	default:
+		return true
+	}
+
+	c.lock.Lock()
+	first := c.stoppedBy == ""
+	if first {
+		c.stoppedBy = stoppedBy
+	}
+	c.notWarmed++
+	c.lock.Unlock()
+	if first {
+		slog.Info("limit reached, not warming the remaining URLs", c.logArgs("limit", stoppedBy)...)
+	}
+	return false
+}
+
+// sendRequest fetches u. Header, if not nil, is added to the configured
+// headers.
+func (c *Crawler) sendRequest(ctx context.Context, u string, header http.Header) (*http.Response, error) {
+	ctx, cancel := c.withTimeout(ctx, u)
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// Add custom headers to the request
+	for name, value := range c.Headers {
+		req.Header.Set(name, value)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	if c.CheckCompression && req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", compressionAcceptEncoding)
+	}
+
+	// Set User-Agent header
+	req.Header.Set("User-Agent", userAgent())
+
+	if c.Username != "" && c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	for _, hook := range c.RequestHooks {
+		if err := hook(req); err != nil {
+			cancel()
+			return nil, fmt.Errorf("request hook: %w", err)
+		}
+	}
+
+	if slog.Default().Enabled(ctx, slog.LevelDebug) {
+		slog.Debug("sending request", "url", u, "header", redactHeader(req.Header))
+	}
+
+	res, err := c.client.Do(req)
+	attachCancel(res, err, cancel)
+	return res, err
+}
+
+func (c *Crawler) crawl(t task) {
+	u, referrer := t.url, t.referrer
+	ctx, span := c.startFetchSpan(u)
+
+	result := Result{Site: c.Name, URL: u, Referrer: referrer, Attempts: t.attempt + 1, Alternate: t.alternate, Asset: t.asset, API: t.api, RetryPolicy: t.retryRule}
+	// A URL that is going to be retried has no result yet.
+	retrying := false
+	defer func() {
+		endFetchSpan(span, result, t.attempt)
+		// Responses that are retried tell how the origin copes all the
+		// same.
+		c.tuner.observe(result)
+		c.breaker.observe(result)
+		if retrying {
+			return
+		}
+		result.Slow = c.SlowThreshold > 0 && result.Err == nil && !result.Fresh && !result.NoIndex &&
+			result.ResponseTime > c.SlowThreshold
+		result.Oversize = c.MaxPageSize > 0 && result.Err == nil && !result.Fresh && result.Size > c.MaxPageSize
+		// Pages that failed, or that weren't parsed, have their content
+		// assertions left unevaluated.
+		if result.Assertions == nil && !result.Fresh {
+			result.Assertions = c.unevaluatedAssertions(u)
+		}
+		if t.attempt > 0 {
+			result.History = append(slices.Clone(t.history), Attempt{StatusCode: result.StatusCode, Err: result.Err, Duration: result.ResponseTime})
+		}
+
+		stored := result
+		stored.Header = nil
+
+		c.lock.Lock()
+		if c.loads != nil && !stored.Fresh {
+			stored.Load = c.recordLoad(stored)
+			result.Load = stored.Load
+		}
+		if c.results != nil {
+			c.results[resultKey(stored)] = stored
+		}
+		c.stats.add(stored)
+		c.recordTraffic(stored)
+		abort := c.recordAuth(stored)
+		c.lock.Unlock()
+		if abort {
+			c.abortOnAuthFailure(stored)
+		}
+		if !stored.Fresh {
+			c.rate.record(time.Now())
+		}
+		if c.LoadDuration > 0 {
+			c.requeueForLoad(t)
+		}
+
+		for _, l := range c.listeners {
+			l(result)
+		}
+		if c.OnResult != nil {
+			c.OnResult(result)
+		}
+	}()
+
+	baseURL, _ := url.Parse(u)
+
+	prev, fresh, conditional := c.checkPrevious(t)
+	if fresh {
+		result = prev.carryOver(referrer)
+		c.scheduleKnownLinks(u)
+		return
+	}
+	// Only a 304 for the validators of the previous result can carry it
+	// over; conditional is set below for other reasons too.
+	revalidating := conditional != nil
+	// Without a previous result the validator cache may still have the
+	// validators to request the URL conditionally with.
+	cached := false
+	if conditional == nil {
+		if conditional = c.validators.conditional(resultKey(result)); conditional != nil {
+			cached = true
+			c.lock.Lock()
+			c.conditionalRequests++
+			c.lock.Unlock()
+		}
+	}
+	if t.api {
+		conditional = apiHeader(conditional)
+	}
+
+	if c.Purge {
+		result.Purged = true
+		result.PurgeStatus, result.PurgeTime, result.PurgeErr = c.purge(ctx, u)
+		if result.PurgeErr != nil {
+			slog.Warn("purge failed", "url", u, "error", result.PurgeErr)
+			if c.PurgeRequired {
+				result.Err = fmt.Errorf("not warmed: purge failed: %w", result.PurgeErr)
+				return
+			}
+		}
+	}
+
+	c.limiter.wait(c.runCtx)
+	c.backoff.wait(c.runCtx)
+
+	reqCtx := ctx
+	var trace *requestTrace
+	if c.Timings {
+		reqCtx, trace = withTrace(ctx)
+	}
+	c.inFlight.Add(1)
+	start := time.Now()
+	res, err := c.sendRequest(reqCtx, u, conditional)
+	responseTime := time.Since(start)
+	c.inFlight.Add(-1)
+	result.ResponseTime = responseTime
+	result.FetchedAt = time.Now()
+	if err != nil {
+		result.Timings = trace.finish()
+		result.Err, result.ErrClass = err, classifyError(err)
+		if result.ErrClass == errTimeout && len(c.timeouts) > 0 {
+			result.TimeoutLimit = c.describeTimeout(u)
+		}
+		var loop *redirectLoopError
+		if errors.As(err, &loop) {
+			c.recordRedirectLoop(loop.chain)
+		}
+		if rule := c.retries.forError(result.ErrClass); rule != nil {
+			result.RetryPolicy = rule.String()
+			if rule.allows(t.attempt) && c.runCtx.Err() == nil {
+				delay := retryDelay(nil, rule.base, t.attempt, c.MaxRetryWait, time.Now())
+				slog.Warn("retrying", "url", u, "error", err, "attempt", result.Attempts, "retry_in", delay, "policy", rule)
+				retrying = true
+				t.history = append(t.history, Attempt{Err: err, Duration: responseTime})
+				t.retryRule = rule.String()
+				c.lock.Lock()
+				c.stats.retries++
+				c.lock.Unlock()
+				c.retryLater(t, delay)
+				return
+			}
+		}
+		slog.Error("fetch failed", "url", u, "error", err, "class", result.ErrClass, "duration", responseTime, "attempt", result.Attempts)
+		return
+	}
+	// Variants and the second fetch only start once the first one is done
+	// with.
+	if len(c.variants) > 0 {
+		defer func() {
+			if !retrying && result.Err == nil && !result.Fresh {
+				c.warmVariants(ctx, &result, varyHeaders(res.Header), conditional)
+			}
+		}()
+	}
+	if c.Repeat > 1 {
+		defer func() {
+			if !retrying && result.Err == nil && !result.Fresh {
+				c.repeatFetches(ctx, &result, conditional)
+			}
+		}()
+	}
+	if c.MeasureSpeedup {
+		defer func() {
+			if !retrying && result.Err == nil && !result.Fresh {
+				c.measureSpeedup(ctx, &result, conditional)
+			}
+		}()
+	}
+	// Whatever isn't parsed is drained so the connection can be reused.
+	body := &countingReader{r: res.Body, meter: &c.throughput}
+	var hasher *bodyHasher
+	if (c.DetectDuplicates || c.DetectChanges) && c.success.match(res.StatusCode) {
+		hasher = newBodyHasher(c.duplicateStrip)
+		body.r = io.TeeReader(body.r, hasher)
+	}
+	var parseBody io.Reader = body
+	var estimator *gzipEstimator
+	if c.CheckCompression && res.Header.Get("Content-Encoding") == "" &&
+		compressible(res.Header.Get("Content-Type")) && c.success.match(res.StatusCode) {
+		estimator = newGzipEstimator()
+		body.r = io.TeeReader(body.r, estimator)
+	}
+	var saved *archiveFile
+	var captured *warcCapture
+	defer func() {
+		c.drainAndClose(body, res.Body)
+		result.Timings = trace.finish()
+		if saved != nil {
+			c.saveBody(saved, !retrying)
+		}
+		if captured != nil && !retrying {
+			c.writeWARC(captured)
+		}
+		if !result.Fresh {
+			result.Size = body.n
+		}
+		if estimator != nil && !retrying && result.Size >= minCompressibleSize {
+			result.Uncompressed = true
+			result.GzipEstimate = estimator.size()
+		}
+		if hasher != nil && !retrying && !result.Fresh {
+			result.BodyHash = hasher.sum()
+		}
+	}()
+
+	// A 304 for validators from the cache is a result of its own, with the
+	// links found when the page was last fetched in full.
+	if cached && res.StatusCode == http.StatusNotModified {
+		for _, link := range c.validators.links(resultKey(result)) {
+			c.schedule(link, u)
+		}
+	} else if revalidating && res.StatusCode == http.StatusNotModified {
+		slog.Debug("not modified since the previous run", "url", u, "duration", responseTime)
+		result = prev.carryOver(referrer)
+		result.FetchedAt = time.Now()
+		c.scheduleKnownLinks(u)
+		return
+	}
+
+	// Set before a retry, so that the tuner and the breaker see the status
+	// of the responses that are retried too.
+	result.StatusCode = res.StatusCode
+	result.Status = res.Status
+
+	throttled := res.StatusCode == http.StatusTooManyRequests
+	if throttled {
+		c.backoff.slowDown()
+	} else {
+		c.backoff.speedUp()
+	}
+	rule := c.retries.forStatus(res.StatusCode)
+	if rule != nil {
+		result.RetryPolicy = rule.String()
+	}
+	retry := rule.allows(t.attempt)
+	if throttled || retry {
+		c.lock.Lock()
+		if throttled {
+			c.stats.throttled++
+		}
+		if retry {
+			c.stats.retries++
+		}
+		c.lock.Unlock()
+	}
+	if retry {
+		delay := retryDelay(res.Header, rule.base, t.attempt, c.MaxRetryWait, time.Now())
+		slog.Warn("retrying", "url", u, "status", res.StatusCode, "attempt", result.Attempts, "retry_in", delay, "policy", rule)
+		retrying = true
+		t.retryRule = rule.String()
+		t.history = append(t.history, Attempt{StatusCode: res.StatusCode, Duration: responseTime})
+		c.retryLater(t, delay)
+		return
+	}
+
+	result.Header = res.Header
+	result.ETag = res.Header.Get("ETag")
+	result.LastModified = res.Header.Get("Last-Modified")
+	result.ContentType = res.Header.Get("Content-Type")
+	if c.HTTP3 {
+		result.Protocol = res.Proto
+		result.HTTP3Fallback = res.ProtoMajor != 3
+	}
+	if c.success.match(res.StatusCode) {
+		result.HeaderViolations, result.RequiredHeaders = c.checkHeaders(res.Header)
+	}
+	result.CapturedHeaders = captureHeaders(res.Header, c.CaptureHeaders)
+	if c.archive != nil {
+		var err error
+		if saved, err = c.archive.create(u, res, c.success.match(res.StatusCode)); err != nil {
+			slog.Warn("can't save the body", "url", u, "error", err)
+		} else if saved != nil {
+			body.r = io.TeeReader(body.r, saved)
+		}
+	}
+	if captured = c.warc.capture(res, start); captured != nil {
+		body.r = io.TeeReader(body.r, captured)
+	}
+	// With -check-compression the client doesn't decompress the body, so
+	// the links are read from a decoded copy. Decoding starts reading it,
+	// so whatever keeps a copy of the body has to be attached first.
+	if c.CheckCompression {
+		parseBody = decodedBody(body, res.Header.Get("Content-Encoding"))
+	}
+
+	slog.Debug("fetched", "url", u, "status", res.StatusCode, "duration", responseTime, "attempt", result.Attempts)
+
+	if final := res.Request.URL; final.String() != u {
+		result.FinalURL = final.String()
+		result.RedirectStatus = firstRedirectStatus(res)
+		if baseURL != nil && !c.hostAllowed(final, baseURL) {
+			slog.Info("redirected off-host, not following its links", "url", u, "final_url", result.FinalURL)
+			result.OffHost = true
+			return
+		}
+		// Relative links are relative to where the page actually is.
+		baseURL = final
+	}
+
+	if c.RespectMetaRobots {
+		noindex, nofollow := headerRobots(res.Header)
+		result.NoIndex = noindex
+		if nofollow {
+			slog.Debug("X-Robots-Tag says nofollow, not following its links", "url", u)
+			return
+		}
+	}
+
+	if t.asset != "" || t.api || !isHTML(res.Header) {
+		return
+	}
+	if parseBody == nil {
+		slog.Warn("can't decode the body to find its links", "url", u, "content_encoding", res.Header.Get("Content-Encoding"))
+		return
+	}
+
+	doc, err := goquery.NewDocumentFromReader(utf8Body(io.LimitReader(parseBody, c.MaxBodySize), res.Header.Get("Content-Type"), u))
+	if err != nil {
+		slog.Warn("error reading document", "url", u, "error", err)
+		return
+	}
+
+	if c.SEOAudit && c.success.match(res.StatusCode) {
+		result.SEO = auditSEO(doc, res.Request.URL)
+	}
+	if c.soft404 != nil && res.StatusCode == http.StatusOK {
+		result.Soft404 = c.soft404.check(doc, body.n)
+	}
+	if c.CheckMixedContent && res.Request.URL.Scheme == "https" {
+		result.MixedContent = mixedContent(doc)
+	}
+	if len(c.assertions) > 0 && c.success.match(res.StatusCode) {
+		result.Assertions = c.checkAssertions(doc, u)
+	}
+
+	if c.RespectMetaRobots {
+		noindex, nofollow := metaRobots(doc)
+		result.NoIndex = result.NoIndex || noindex
+		if nofollow {
+			slog.Debug("robots meta tag says nofollow, not following its links", "url", u)
+			return
+		}
+	}
+
+	// A -duration run requests its input URLs only.
+	if c.LoadDuration > 0 {
+		return
+	}
+
+	// Relative links resolve against the document's <base href>, if it
+	// has a valid one.
+	linkBase := baseURL
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok && baseURL != nil {
+		if base, err := url.Parse(strings.TrimSpace(href)); err == nil {
+			linkBase = baseURL.ResolveReference(base)
+		}
+	}
+
+	if c.Alternates && baseURL != nil {
+		c.scheduleAlternates(doc, linkBase, baseURL, u)
+	}
+	if baseURL != nil {
+		result.MetaRefresh = c.followMetaRefresh(doc, linkBase, baseURL, u)
+	}
+
+	found, skipped := 0, 0
+	doc.Find("a[href]").Each(func(index int, item *goquery.Selection) {
+		linkTag := item
+		link, exists := linkTag.Attr("href")
+		if !exists {
+			return
+		}
+
+		linkURL, err := url.Parse(link)
+		if err != nil {
+			skipped++
+			return
+		}
+
+		if baseURL == nil {
+			slog.Warn("base URL could not be parsed", "url", u)
+			return
+		}
+
+		absoluteURL := linkBase.ResolveReference(linkURL)
+
+		// javascript:, mailto:, tel: and the like, as well as anchors on
+		// the page itself, aren't pages to warm.
+		linkStr := removeHashFromURL(absoluteURL.String())
+		if (absoluteURL.Scheme != "http" && absoluteURL.Scheme != "https") || linkStr == removeHashFromURL(u) {
+			skipped++
+			return
+		}
+
+		if !c.hostAllowed(absoluteURL, baseURL) {
+			c.external.add(c.runCtx, linkStr, u)
+			return
+		}
+
+		found++
+		c.schedule(linkStr, u)
+	})
+	c.skippedLinks.Add(int64(skipped))
+	slog.Debug("links extracted", "url", u, "links", found, "skipped_non_crawlable", skipped)
+}
+
+// checkRedirect logs every redirect followed, stops at a redirect back to
+// a URL already visited and, like the default policy, after 10 redirects.
+// A redirect to another host than the one the request was for doesn't get
+// the credentials and custom headers, unless that host is one of
+// ForwardAuthHosts.
+func (c *Crawler) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	key := redirectKey(req.URL.String())
+	for i, prev := range via {
+		if redirectKey(prev.URL.String()) == key {
+			chain := make([]string, 0, len(via)-i+1)
+			for _, r := range via[i:] {
+				chain = append(chain, r.URL.String())
+			}
+			return &redirectLoopError{chain: append(chain, req.URL.String())}
+		}
+	}
+	slog.Debug("following redirect", "url", via[len(via)-1].URL.String(), "location", req.URL.String(), "status", req.Response.StatusCode)
+
+	host := normalizeHost(req.URL)
+	if host == normalizeHost(via[0].URL) {
+		return nil
+	}
+	for _, name := range c.sensitiveHeaders() {
+		// The client itself drops credentials on the way to another
+		// domain, which an allowed host gets back.
+		if matchHost(host, c.ForwardAuthHosts) {
+			if values := via[0].Header.Values(name); len(values) > 0 {
+				req.Header[http.CanonicalHeaderKey(name)] = values
+			}
+		} else {
+			req.Header.Del(name)
+		}
+	}
+	return nil
+}
+
+// sensitiveHeaders returns the request headers that may carry secrets: the
+// credentials, the configured custom headers and the HMAC signature.
+func (c *Crawler) sensitiveHeaders() []string {
+	names := []string{"Authorization", "Proxy-Authorization", "Cookie"}
+	for name := range c.Headers {
+		names = append(names, name)
+	}
+	if c.HMACSecret != "" {
+		names = append(names, "X-Timestamp", "X-Signature")
+	}
+	return names
+}
+
+// redactHeader returns a copy of h safe to log, without credentials.
+func redactHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range []string{"Authorization", "Cookie", "X-Signature"} {
+		if h.Get(name) != "" {
+			h.Set(name, "REDACTED")
+		}
+	}
+	return h
+}
+
+// resultKey is the key of r in Crawler.results. URLs are only unique within
+// a site, so the roll-up of a multi-site run keys them by site as well.
+func resultKey(r Result) string {
+	if r.Site == "" {
+		return r.URL
+	}
+	return r.Site + " " + r.URL
+}
+
+// drainAndClose reads the rest of a response body, up to MaxBodySize, and
+// closes it. A body that isn't read to the end makes the transport drop the
+// connection instead of reusing it.
+func (c *Crawler) drainAndClose(r io.Reader, body io.Closer) {
+	io.CopyN(io.Discard, r, c.MaxBodySize)
+	body.Close()
+}
+
+// isHTML reports whether a response may contain links to follow. A missing
+// Content-Type is given the benefit of the doubt.
+func isHTML(h http.Header) bool {
+	ct := h.Get("Content-Type")
+	return ct == "" || strings.Contains(ct, "html")
+}
+
+// countingReader counts the bytes read through it, recording them in meter
+// as well if set.
+type countingReader struct {
+	r     io.Reader
+	n     int64
+	meter *throughputMeter
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	if cr.meter != nil && n > 0 {
+		cr.meter.record(time.Now(), int64(n))
+	}
+	return n, err
+}
+
+func removeHashFromURL(u string) string {
+	hashIndex := strings.Index(u, "#")
+	if hashIndex != -1 {
+		return u[:hashIndex]
+	}
+	return u
+}
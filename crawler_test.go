@@ -0,0 +1,547 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestCrawler returns a crawler of the default config changed by set.
+func newTestCrawler(t *testing.T, set func(*Config)) *Crawler {
+	t.Helper()
+	cfg := defaultConfig()
+	set(&cfg)
+	c, err := NewCrawler(cfg)
+	if err != nil {
+		t.Fatalf("NewCrawler: %v", err)
+	}
+	return c
+}
+
+// runWithin runs c, failing the test if it doesn't finish within d so that
+// a deadlock fails rather than hangs.
+func runWithin(t *testing.T, c *Crawler, d time.Duration) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Run()
+	}()
+	select {
+	case <-done:
+	case <-time.After(d):
+		t.Fatalf("crawl didn't finish within %v", d)
+	}
+}
+
+// hitCounter counts the requests for every path.
+type hitCounter struct {
+	mu   sync.Mutex
+	hits map[string]int
+}
+
+func (h *hitCounter) count(r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.hits == nil {
+		h.hits = make(map[string]int)
+	}
+	h.hits[r.URL.RequestURI()]++
+}
+
+func (h *hitCounter) get(path string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.hits[path]
+}
+
+// linkSite serves pages /0 to /n-1 that each link to the fanout pages
+// after them, wrapping around, so that every page is linked from several
+// others. / links to /0.
+func linkSite(t *testing.T, n, fanout int, hits *hitCounter) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.count(r)
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<a href="/0">start</a>`)
+			return
+		}
+		var i int
+		if _, err := fmt.Sscanf(r.URL.Path, "/%d", &i); err != nil || i < 0 || i >= n {
+			http.NotFound(w, r)
+			return
+		}
+		for j := 1; j <= fanout; j++ {
+			fmt.Fprintf(w, `<a href="/%d">%d</a>`, (i+j)%n, j)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// pagesCrawled returns the number of pages c got a response for.
+func pagesCrawled(c *Crawler) int {
+	return c.stats.pages
+}
+
+func TestOnResultOncePerURLWithSlowCallback(t *testing.T) {
+	const pages, delay = 50, 20 * time.Millisecond
+	var hits hitCounter
+	srv := linkSite(t, pages, 3, &hits)
+
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	var finished atomic.Bool
+	c := newTestCrawler(t, func(cfg *Config) {
+		cfg.StartURL = srv.URL + "/"
+		cfg.MaxConcurrency = 10
+	})
+	c.OnResult = func(r Result) {
+		if finished.Load() {
+			t.Errorf("OnResult called for %s after Run returned", r.URL)
+		}
+		// A callback that blocks briefly only holds up its own worker.
+		time.Sleep(delay)
+		mu.Lock()
+		calls[r.URL]++
+		mu.Unlock()
+	}
+
+	start := time.Now()
+	runWithin(t, c, 10*time.Second)
+	elapsed := time.Since(start)
+	finished.Store(true)
+
+	if len(calls) != pages+1 {
+		t.Errorf("OnResult called for %d URLs, want %d", len(calls), pages+1)
+	}
+	for u, n := range calls {
+		if n != 1 {
+			t.Errorf("OnResult called %d times for %s, want once", n, u)
+		}
+	}
+	// Run one after the other the callbacks alone would take over a
+	// second.
+	if serial := (pages + 1) * delay; elapsed >= serial/2 {
+		t.Errorf("crawl took %v, the callbacks look serialized (%v one after the other)", elapsed, serial)
+	}
+}
+
+func TestCrawlLargeSiteFetchesEveryPageOnce(t *testing.T) {
+	const pages = 3000
+	var hits hitCounter
+	srv := linkSite(t, pages, 5, &hits)
+	c := newTestCrawler(t, func(cfg *Config) {
+		cfg.StartURL = srv.URL + "/"
+		cfg.MaxConcurrency = 16
+	})
+
+	runWithin(t, c, 2*time.Minute)
+
+	for i := 0; i < pages; i++ {
+		if n := hits.get(fmt.Sprintf("/%d", i)); n != 1 {
+			t.Errorf("/%d fetched %d times, want once", i, n)
+		}
+	}
+	if n := pagesCrawled(c); n != pages+1 {
+		t.Errorf("%d pages crawled, want %d", n, pages+1)
+	}
+	if n := c.frontier.len(); n != 0 {
+		t.Errorf("%d URLs left in the frontier", n)
+	}
+}
+
+func TestCrawlManyLinksWithOneWorker(t *testing.T) {
+	const links = 500
+	var hits hitCounter
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.count(r)
+		w.Header().Set("Content-Type", "text/html")
+		// Every page links to all the others, so the one worker finds
+		// far more links than it can fetch at once.
+		for i := 0; i < links; i++ {
+			fmt.Fprintf(w, `<a href="/%d">%d</a>`, i, i)
+		}
+	}))
+	defer srv.Close()
+	c := newTestCrawler(t, func(cfg *Config) {
+		cfg.StartURL = srv.URL + "/"
+		cfg.MaxConcurrency = 1
+	})
+
+	runWithin(t, c, time.Minute)
+
+	if n := pagesCrawled(c); n != links+1 {
+		t.Errorf("%d pages crawled, want %d", n, links+1)
+	}
+	for i := 0; i < links; i++ {
+		if n := hits.get(fmt.Sprintf("/%d", i)); n != 1 {
+			t.Errorf("/%d fetched %d times, want once", i, n)
+		}
+	}
+}
+
+// htmlSite serves the HTML of pages by path and a 404 for other paths.
+func htmlSite(t *testing.T, pages map[string]string, hits *hitCounter) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.count(r)
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCrawlSkipsNonCrawlableLinks(t *testing.T) {
+	var hits hitCounter
+	srv := htmlSite(t, map[string]string{
+		"/": `<a href="javascript:void(0)">js</a>
+			<a href="JavaScript:alert(1)">js</a>
+			<a href="mailto:info@example.com">mail</a>
+			<a href="tel:+15550100">call</a>
+			<a href="#">top</a>
+			<a href="#section">section</a>
+			<a href="/page">page</a>`,
+		"/page": `<a href="/#top">home</a>`,
+	}, &hits)
+	c := newTestCrawler(t, func(cfg *Config) {
+		cfg.StartURL = srv.URL + "/"
+	})
+
+	runWithin(t, c, 10*time.Second)
+
+	if c.stats.pages != 2 {
+		t.Errorf("%d pages crawled, want / and /page", c.stats.pages)
+	}
+	if n := hits.get("/"); n != 1 {
+		t.Errorf("/ fetched %d times, want once", n)
+	}
+	if n := hits.get("/page"); n != 1 {
+		t.Errorf("/page fetched %d times, want once", n)
+	}
+	// The link back to / from /page is to another page, only one already
+	// seen.
+	if n := c.skippedLinks.Load(); n != 6 {
+		t.Errorf("%d links skipped, want 6", n)
+	}
+}
+
+func TestCrawlFetchesAnchorsOfAPageOnce(t *testing.T) {
+	var hits hitCounter
+	srv := htmlSite(t, map[string]string{
+		"/": `<a href="/a#1">1</a><a href="/a#2">2</a><a href="/a#3">3</a>
+			<a href="/a#4">4</a><a href="/a#5">5</a>`,
+		"/a": `<a href="/a#1">1</a>`,
+	}, &hits)
+	c := newTestCrawler(t, func(cfg *Config) {
+		cfg.StartURL = srv.URL + "/#intro"
+		cfg.MaxConcurrency = 5
+	})
+
+	runWithin(t, c, 10*time.Second)
+
+	if n := hits.get("/a"); n != 1 {
+		t.Errorf("/a fetched %d times, want once", n)
+	}
+	if n := hits.get("/"); n != 1 {
+		t.Errorf("/ fetched %d times, want once", n)
+	}
+	if c.stats.pages != 2 {
+		t.Errorf("%d pages crawled, want 2", c.stats.pages)
+	}
+}
+
+func TestCrawlReusesConnectionsForUnparsedBodies(t *testing.T) {
+	const files = 20
+	data := strings.Repeat("x", 1<<20)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Header().Set("Content-Type", "text/html")
+			for i := 0; i < files; i++ {
+				fmt.Fprintf(w, `<a href="/%d.txt">%d</a>`, i, i)
+			}
+			return
+		}
+		// Bodies that aren't parsed for links, larger than the transport
+		// drains by itself when one is closed unread.
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, data)
+	}))
+	defer srv.Close()
+	c := newTestCrawler(t, func(cfg *Config) {
+		cfg.StartURL = srv.URL + "/"
+		cfg.MaxConcurrency = 1
+	})
+	var mu sync.Mutex
+	var conns, reused int
+	c.runCtx = httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			conns++
+			if info.Reused {
+				reused++
+			}
+		},
+	})
+
+	runWithin(t, c, 10*time.Second)
+
+	if conns != files+1 {
+		t.Fatalf("%d connections got, want one per request (%d)", conns, files+1)
+	}
+	if reused != files {
+		t.Errorf("%d of %d requests reused a connection, want all but the first", reused, conns)
+	}
+}
+
+// resultFor returns the result for u, failing the test if there is none.
+func resultFor(t *testing.T, c *Crawler, u string) Result {
+	t.Helper()
+	for _, r := range c.results {
+		if r.URL == u {
+			return r
+		}
+	}
+	t.Fatalf("no result for %s", u)
+	return Result{}
+}
+
+func TestCrawlDoesntFollowLinksOfOffHostRedirects(t *testing.T) {
+	var otherHits, hits hitCounter
+	var srv *httptest.Server
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		otherHits.count(r)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<a href="/elsewhere">elsewhere</a><a href="%s/from-other">back</a>`, srv.URL)
+	}))
+	defer other.Close()
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.count(r)
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/out">out</a><a href="/moved">moved</a>`)
+		case "/out":
+			http.Redirect(w, r, other.URL+"/landing", http.StatusFound)
+		case "/moved":
+			http.Redirect(w, r, "/dir/", http.StatusMovedPermanently)
+		case "/dir/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="child">child</a>`)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+		}
+	}))
+	defer srv.Close()
+	c := newTestCrawler(t, func(cfg *Config) {
+		cfg.StartURL = srv.URL + "/"
+	})
+
+	runWithin(t, c, 10*time.Second)
+
+	if n := otherHits.get("/landing"); n != 1 {
+		t.Errorf("the redirect target fetched %d times, want once", n)
+	}
+	if n := otherHits.get("/elsewhere"); n != 0 {
+		t.Errorf("a link on the other host followed %d times", n)
+	}
+	if n := hits.get("/from-other"); n != 0 {
+		t.Errorf("a link back from the other host followed %d times", n)
+	}
+	out := resultFor(t, c, srv.URL+"/out")
+	if !out.OffHost || out.FinalURL != other.URL+"/landing" {
+		t.Errorf("/out: off-host %v to %q, want off-host to %q", out.OffHost, out.FinalURL, other.URL+"/landing")
+	}
+	// A redirect on the same host is followed, with links relative to the
+	// page it ends up on.
+	if n := hits.get("/dir/child"); n != 1 {
+		t.Errorf("/dir/child fetched %d times, want once", n)
+	}
+	if moved := resultFor(t, c, srv.URL+"/moved"); moved.OffHost {
+		t.Error("/moved taken as redirected off-host")
+	}
+}
+
+func TestCrossHostRedirectDropsCredentials(t *testing.T) {
+	tests := []struct {
+		name        string
+		forwardAuth bool
+	}{
+		{name: "other host"},
+		{name: "forward-auth host", forwardAuth: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var landed http.Header
+			other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				landed = r.Header.Clone()
+				mu.Unlock()
+				w.Header().Set("Content-Type", "text/html")
+			}))
+			defer other.Close()
+			var startHeader http.Header
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/":
+					mu.Lock()
+					startHeader = r.Header.Clone()
+					mu.Unlock()
+					w.Header().Set("Content-Type", "text/html")
+					fmt.Fprint(w, `<a href="/sso">sign in</a>`)
+				case "/sso":
+					http.Redirect(w, r, other.URL+"/login", http.StatusFound)
+				}
+			}))
+			defer srv.Close()
+			c := newTestCrawler(t, func(cfg *Config) {
+				cfg.StartURL = srv.URL + "/"
+				cfg.Username, cfg.Password = "user", "secret"
+				cfg.Headers = map[string]string{"X-Api-Key": "key"}
+				if tt.forwardAuth {
+					cfg.ForwardAuthHosts = []string{strings.TrimPrefix(other.URL, "http://")}
+				}
+			})
+
+			runWithin(t, c, 10*time.Second)
+
+			if startHeader.Get("Authorization") == "" || startHeader.Get("X-Api-Key") != "key" {
+				t.Fatalf("the start URL was fetched without the credentials: %v", startHeader)
+			}
+			if landed == nil {
+				t.Fatal("the redirect wasn't followed")
+			}
+			for _, name := range []string{"Authorization", "X-Api-Key"} {
+				if got := landed.Get(name) != ""; got != tt.forwardAuth {
+					t.Errorf("%s sent to the other host: %v, want %v", name, got, tt.forwardAuth)
+				}
+			}
+		})
+	}
+}
+
+func TestCrawlResolvesLinksAgainstBaseHref(t *testing.T) {
+	var hits hitCounter
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.count(r)
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<a href="/abs/page">1</a><a href="/rel/page">2</a><a href="/none/page">3</a>`)
+		case "/abs/page":
+			fmt.Fprintf(w, `<head><base href="%s/static/v2/"></head><a href="a">a</a>`, srv.URL)
+		case "/rel/page":
+			fmt.Fprint(w, `<head><base href="sub/"></head><a href="b">b</a><a href="/root">root</a>`)
+		case "/none/page":
+			fmt.Fprint(w, `<a href="c">c</a>`)
+		}
+	}))
+	defer srv.Close()
+	c := newTestCrawler(t, func(cfg *Config) {
+		cfg.StartURL = srv.URL + "/"
+	})
+
+	runWithin(t, c, 10*time.Second)
+
+	for path, want := range map[string]int{
+		"/static/v2/a": 1,
+		"/abs/a":       0,
+		"/rel/sub/b":   1,
+		"/rel/b":       0,
+		"/root":        1,
+		"/none/c":      1,
+	} {
+		if n := hits.get(path); n != want {
+			t.Errorf("%s fetched %d times, want %d", path, n, want)
+		}
+	}
+}
+
+func TestCrawlFetchesByPriorityWithOneWorker(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		order = append(order, r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			for _, p := range []string{"/blog/1", "/other/1", "/products/1", "/blog/2", "/products/2", "/other/2"} {
+				fmt.Fprintf(w, `<a href="%s">%s</a>`, p, p)
+			}
+		}
+	}))
+	defer srv.Close()
+	c := newTestCrawler(t, func(cfg *Config) {
+		cfg.StartURL = srv.URL + "/"
+		cfg.MaxConcurrency = 1
+		cfg.Priorities = []string{"10:/products/", "-1:/blog/"}
+	})
+
+	runWithin(t, c, 10*time.Second)
+
+	// The highest weight first, and the order they were found in between
+	// URLs of the same weight.
+	want := []string{"/", "/products/1", "/products/2", "/other/1", "/other/2", "/blog/1", "/blog/2"}
+	if strings.Join(order, " ") != strings.Join(want, " ") {
+		t.Errorf("fetched in the order %v, want %v", order, want)
+	}
+}
+
+func TestReportShowsAttemptsOfRetriedURLs(t *testing.T) {
+	var hits hitCounter
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.count(r)
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<a href="/flaky">flaky</a>`)
+		case "/flaky":
+			if hits.get("/flaky") < 3 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}
+	}))
+	defer srv.Close()
+	c := newTestCrawler(t, func(cfg *Config) {
+		cfg.StartURL = srv.URL + "/"
+		cfg.Retries = 3
+	})
+
+	runWithin(t, c, 10*time.Second)
+
+	var report strings.Builder
+	c.report(&report, time.Second)
+	lines := map[string]string{}
+	for _, line := range strings.Split(report.String(), "\n") {
+		if u, _, ok := strings.Cut(line, " : "); ok {
+			lines[u] = line
+		}
+	}
+	if line := lines[srv.URL+"/flaky"]; !strings.HasSuffix(line, "| attempts: 3") {
+		t.Errorf("flaky URL reported as %q, want 3 attempts", line)
+	}
+	if line := lines[srv.URL+"/"]; line == "" || strings.Contains(line, "attempts") {
+		t.Errorf("URL fetched once reported as %q", line)
+	}
+	if !strings.Contains(report.String(), "1 URLs needed more than one attempt") {
+		t.Errorf("report doesn't count the URL retried:\n%s", report.String())
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"regexp"
+	"sort"
+)
+
+// bodyHasher hashes a response body as it is read, for -detect-duplicates.
+// With a strip pattern the body has to be buffered to remove its matches,
+// such as a CSRF token, before hashing.
+type bodyHasher struct {
+	h     hash.Hash
+	strip *regexp.Regexp
+	buf   bytes.Buffer
+}
+
+func newBodyHasher(strip *regexp.Regexp) *bodyHasher {
+	return &bodyHasher{h: sha256.New(), strip: strip}
+}
+
+func (bh *bodyHasher) Write(p []byte) (int, error) {
+	if bh.strip != nil {
+		return bh.buf.Write(p)
+	}
+	return bh.h.Write(p)
+}
+
+// sum returns the hash of what was written, in hex.
+func (bh *bodyHasher) sum() string {
+	if bh.strip != nil {
+		bh.h.Write(bh.strip.ReplaceAll(bh.buf.Bytes(), nil))
+	}
+	return hex.EncodeToString(bh.h.Sum(nil))
+}
+
+// duplicateGroup is a set of URLs that served the same body.
+type duplicateGroup struct {
+	hash    string
+	results []Result
+}
+
+// duplicates returns the groups of URLs whose bodies hashed the same, the
+// largest group first. The URLs of a group are sorted.
+func (c *Crawler) duplicates() []duplicateGroup {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	byHash := make(map[string][]Result)
+	for _, r := range c.results {
+		if r.BodyHash != "" {
+			byHash[r.BodyHash] = append(byHash[r.BodyHash], r)
+		}
+	}
+	var groups []duplicateGroup
+	for h, results := range byHash {
+		if len(results) < 2 {
+			continue
+		}
+		sort.Slice(results, func(i, j int) bool { return resultKey(results[i]) < resultKey(results[j]) })
+		groups = append(groups, duplicateGroup{hash: h, results: results})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if len(groups[i].results) != len(groups[j].results) {
+			return len(groups[i].results) > len(groups[j].results)
+		}
+		return resultKey(groups[i].results[0]) < resultKey(groups[j].results[0])
+	})
+	return groups
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const envPrefix = "GOWARMER_"
+
+// envNames spells out the variables for flags whose names are too short to
+// be self-explanatory.
+var envNames = map[string]string{
+	"c":  "CONCURRENCY",
+	"o":  "OUTPUT_FILE",
+	"v":  "VERBOSE",
+	"vv": "VERY_VERBOSE",
+}
+
+// envName returns the environment variable that sets the named flag, e.g.
+// GOWARMER_LOG_LEVEL for -log-level.
+func envName(flagName string) string {
+	name, ok := envNames[flagName]
+	if !ok {
+		name = strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+	}
+	return envPrefix + name
+}
+
+// applyEnv sets every flag that wasn't given on the command line from its
+// environment variable, if present. Flags therefore take precedence over
+// the environment, which in turn takes precedence over the config file.
+func applyEnv(fs *flag.FlagSet) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || err != nil {
+			return
+		}
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		if e := f.Value.Set(value); e != nil {
+			err = fmt.Errorf("%s: %w", envName(f.Name), e)
+		}
+	})
+	return err
+}
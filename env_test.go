@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// parseConfig reads the config the way runWarm does: the defaults, then
+// the config file, then the flags and the environment.
+func parseConfig(t *testing.T, configFile string, args []string) Config {
+	t.Helper()
+	cfg := defaultConfig()
+	if configFile != "" {
+		path := filepath.Join(t.TempDir(), "gowarmer.yaml")
+		if err := os.WriteFile(path, []byte(configFile), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := loadConfig(path, &cfg); err != nil {
+			t.Fatalf("loadConfig: %v", err)
+		}
+	}
+	fs := flag.NewFlagSet("gowarmer crawl", flag.ContinueOnError)
+	registerFlags(fs, &cfg, "crawl")
+	parseInterspersed(fs, args)
+	if err := applyEnv(fs); err != nil {
+		t.Fatalf("applyEnv: %v", err)
+	}
+	return cfg
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	tests := []struct {
+		name       string
+		configFile string
+		env        map[string]string
+		args       []string
+		wantC      int
+		wantLevel  string
+	}{
+		{
+			name:      "default",
+			wantC:     10,
+			wantLevel: "info",
+		},
+		{
+			name:       "config file over default",
+			configFile: "concurrency: 4\nlog_level: warn\n",
+			wantC:      4,
+			wantLevel:  "warn",
+		},
+		{
+			name:       "environment over config file",
+			configFile: "concurrency: 4\nlog_level: warn\n",
+			env:        map[string]string{"GOWARMER_CONCURRENCY": "6", "GOWARMER_LOG_LEVEL": "error"},
+			wantC:      6,
+			wantLevel:  "error",
+		},
+		{
+			name:       "flag over environment",
+			configFile: "concurrency: 4\nlog_level: warn\n",
+			env:        map[string]string{"GOWARMER_CONCURRENCY": "6", "GOWARMER_LOG_LEVEL": "error"},
+			args:       []string{"https://example.com", "-c", "8"},
+			wantC:      8,
+			wantLevel:  "error",
+		},
+		{
+			name:      "environment over default",
+			env:       map[string]string{"GOWARMER_LOG_LEVEL": "debug"},
+			wantC:     10,
+			wantLevel: "debug",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			cfg := parseConfig(t, tt.configFile, tt.args)
+			if cfg.MaxConcurrency != tt.wantC {
+				t.Errorf("concurrency %d, want %d", cfg.MaxConcurrency, tt.wantC)
+			}
+			if cfg.LogLevel != tt.wantLevel {
+				t.Errorf("log level %q, want %q", cfg.LogLevel, tt.wantLevel)
+			}
+		})
+	}
+}
+
+func TestEnvHeadersWithSpaces(t *testing.T) {
+	t.Setenv("GOWARMER_HEADERS", "Authorization: Bearer a token with spaces")
+	cfg := parseConfig(t, "", nil)
+	if got := cfg.Headers["Authorization"]; got != "Bearer a token with spaces" {
+		t.Errorf("Authorization header %q, want %q", got, "Bearer a token with spaces")
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// externalLink is an external URL linked from the crawled pages and the
+// outcome of checking it.
+type externalLink struct {
+	URL        string
+	StatusCode int
+	Err        error
+	linkedFrom []string
+}
+
+// broken reports whether the link is dead.
+func (l *externalLink) broken() bool {
+	return l.Err != nil || l.StatusCode >= 400
+}
+
+// externalChecker checks each external URL linked from the crawled pages
+// once, with a request of its own that doesn't carry the site's headers or
+// credentials, and at most limit of them.
+type externalChecker struct {
+	client *http.Client
+	sem    chan struct{}
+	limit  int
+	wg     sync.WaitGroup
+
+	mu    sync.Mutex
+	links map[string]*externalLink
+}
+
+func newExternalChecker(client *http.Client, concurrency, limit int) *externalChecker {
+	return &externalChecker{
+		client: client,
+		sem:    make(chan struct{}, max(concurrency, 1)),
+		limit:  limit,
+		links:  make(map[string]*externalLink),
+	}
+}
+
+// add records that page links to u, and checks u in the background the
+// first time.
+func (ec *externalChecker) add(ctx context.Context, u, page string) {
+	if ec == nil {
+		return
+	}
+	key := urlKey(u)
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	if l := ec.links[key]; l != nil {
+		if len(l.linkedFrom) < maxLinkingPages && !slices.Contains(l.linkedFrom, page) {
+			l.linkedFrom = append(l.linkedFrom, page)
+		}
+		return
+	}
+	if ec.limit > 0 && len(ec.links) >= ec.limit {
+		return
+	}
+	l := &externalLink{URL: u, linkedFrom: []string{page}}
+	ec.links[key] = l
+
+	ec.wg.Add(1)
+	go func() {
+		defer ec.wg.Done()
+		ec.sem <- struct{}{}
+		defer func() { <-ec.sem }()
+		status, err := ec.check(ctx, u)
+		if err != nil {
+			slog.Debug("external link check failed", "url", u, "error", err)
+		}
+		ec.mu.Lock()
+		l.StatusCode, l.Err = status, err
+		ec.mu.Unlock()
+	}()
+}
+
+// check requests u with HEAD, or with GET if the server doesn't allow HEAD,
+// and returns the status without reading the body.
+func (ec *externalChecker) check(ctx context.Context, u string) (int, error) {
+	status := 0
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, u, nil)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("User-Agent", userAgent())
+		res, err := ec.client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		res.Body.Close()
+		status = res.StatusCode
+		if status != http.StatusMethodNotAllowed && status != http.StatusNotImplemented {
+			break
+		}
+	}
+	return status, nil
+}
+
+// wait waits for the checks in progress.
+func (ec *externalChecker) wait() {
+	if ec != nil {
+		ec.wg.Wait()
+	}
+}
+
+// counts returns the number of external URLs checked and how many of them
+// are broken.
+func (ec *externalChecker) counts() (checked, broken int) {
+	if ec == nil {
+		return 0, 0
+	}
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	for _, l := range ec.links {
+		if l.broken() {
+			broken++
+		}
+	}
+	return len(ec.links), broken
+}
+
+// brokenLinks returns the external URLs that returned an error status or
+// couldn't be fetched, sorted by URL.
+func (ec *externalChecker) brokenLinks() []externalLink {
+	if ec == nil {
+		return nil
+	}
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	var res []externalLink
+	for _, l := range ec.links {
+		if l.broken() {
+			res = append(res, *l)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].URL < res[j].URL })
+	return res
+}
+
+// merge adds the links checked by o to ec, for a roll-up.
+func (ec *externalChecker) merge(o *externalChecker) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	for key, l := range o.links {
+		if _, ok := ec.links[key]; !ok {
+			ec.links[key] = l
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// task is a URL waiting in the frontier to be fetched.
+type task struct {
+	url      string
+	referrer string
+
+	// link is set for URLs found on a page, which -crawl-sample applies
+	// to, and alternate for those found as an alternate format of it.
+	link      bool
+	alternate string
+
+	// asset is set for the images and videos a sitemap lists, and api for
+	// the operations of an OpenAPI spec, which are warmed but not parsed.
+	asset string
+	api   bool
+
+	// lastmod and priority are the URL's <lastmod> and <priority> if it
+	// came from a sitemap.
+	lastmod  time.Time
+	priority float64
+
+	// weight is the weight of the first -priority pattern the URL
+	// matches, 0 if none.
+	weight float64
+
+	// seq is the order in which the task was queued, to break ties.
+	seq uint64
+
+	// attempt is the number of times the URL has been tried before, and
+	// history the outcome of each of those tries.
+	attempt int
+	history []Attempt
+
+	// retryRule is the -retry-policy entry the URL was last retried by.
+	retryRule string
+
+	// iteration is the number of times the URL was requested before in a
+	// -duration run.
+	iteration int
+}
+
+// Orders accepted by -order.
+const (
+	orderFIFO     = ""
+	orderPriority = "priority"
+	orderLastmod  = "lastmod"
+)
+
+func validOrder(o string) bool {
+	switch o {
+	case orderFIFO, orderPriority, orderLastmod:
+		return true
+	}
+	return false
+}
+
+// taskLess returns the comparison for an order, or nil for first in, first
+// out. With weighted set, tasks are ordered by weight first, then by the
+// order, which falls back to sitemap priority for first in, first out.
+func taskLess(order string, weighted bool) func(a, b task) bool {
+	if weighted {
+		if order == orderFIFO {
+			order = orderPriority
+		}
+		less := taskLess(order, false)
+		return func(a, b task) bool {
+			if a.weight != b.weight {
+				return a.weight > b.weight
+			}
+			return less(a, b)
+		}
+	}
+
+	switch order {
+	case orderPriority:
+		return func(a, b task) bool {
+			if a.priority != b.priority {
+				return a.priority > b.priority
+			}
+			return a.seq < b.seq
+		}
+	case orderLastmod:
+		return func(a, b task) bool {
+			if !a.lastmod.Equal(b.lastmod) {
+				return a.lastmod.After(b.lastmod)
+			}
+			return a.seq < b.seq
+		}
+	}
+	return nil
+}
+
+// frontier is the queue of URLs waiting to be fetched. Workers block in pop
+// until a task is available or the frontier is closed. While the frontier is
+// paused or held no tasks are handed out.
+//
+// Tasks are handed out in the order they were pushed unless the frontier
+// was created with a comparison, in which case it is a priority queue.
+type frontier struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  taskQueue
+	seq    uint64
+	paused bool
+	held   bool
+	closed bool
+
+	// shuffled is set to order tasks by shuffleKey instead of by seq.
+	shuffled bool
+	seed     int64
+}
+
+func newFrontier(less func(a, b task) bool) *frontier {
+	f := &frontier{queue: taskQueue{less: less}}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// shuffle randomizes the order tasks of equal priority are handed out in.
+// The frontier must have been created with a comparison.
+func (f *frontier) shuffle(seed int64) {
+	f.mu.Lock()
+	f.shuffled, f.seed = true, seed
+	f.mu.Unlock()
+}
+
+// shuffleKey is the place of u in a shuffled frontier: a hash of the seed
+// and the URL, so a seed gives the same order whatever order the URLs are
+// pushed in.
+func shuffleKey(seed int64, u string) uint64 {
+	h := fnv.New64a()
+	binary.Write(h, binary.LittleEndian, seed)
+	h.Write([]byte(u))
+	// FNV alone leaves URLs differing in their last byte close together,
+	// so the bits are mixed further with the splitmix64 finalizer.
+	x := h.Sum64()
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+func (f *frontier) push(t task) {
+	f.mu.Lock()
+	f.seq++
+	t.seq = f.seq
+	if f.shuffled {
+		// Each round of a -duration run goes before the next.
+		t.seq = uint64(t.iteration)<<40 | shuffleKey(f.seed, t.url)>>24
+	}
+	f.queue.add(t)
+	f.mu.Unlock()
+	f.cond.Signal()
+}
+
+// pop returns the next task, or false once the frontier has been closed.
+func (f *frontier) pop() (task, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for (f.queue.Len() == 0 || f.paused || f.held) && !f.closed {
+		f.cond.Wait()
+	}
+	if f.queue.Len() == 0 {
+		return task{}, false
+	}
+	return f.queue.next(), true
+}
+
+// setPaused stops or resumes handing out tasks.
+func (f *frontier) setPaused(paused bool) {
+	f.mu.Lock()
+	f.paused = paused
+	f.mu.Unlock()
+	f.cond.Broadcast()
+}
+
+// setHeld is setPaused for the crawler's own use, so that an ordered crawl
+// can queue all of its input before the first task is handed out.
+func (f *frontier) setHeld(held bool) {
+	f.mu.Lock()
+	f.held = held
+	f.mu.Unlock()
+	f.cond.Broadcast()
+}
+
+// remove takes the queued tasks for which drop returns true out of the
+// frontier and returns them.
+func (f *frontier) remove(drop func(task) bool) []task {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var removed []task
+	kept := f.queue.tasks[:0]
+	for _, t := range f.queue.tasks {
+		if drop(t) {
+			removed = append(removed, t)
+		} else {
+			kept = append(kept, t)
+		}
+	}
+	clear(f.queue.tasks[len(kept):])
+	f.queue.tasks = kept
+	if f.queue.less != nil {
+		heap.Init(&f.queue)
+	}
+	return removed
+}
+
+func (f *frontier) len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.queue.Len()
+}
+
+// close wakes up all waiting workers; pop returns false once it is drained.
+func (f *frontier) close() {
+	f.mu.Lock()
+	f.closed = true
+	f.mu.Unlock()
+	f.cond.Broadcast()
+}
+
+// taskQueue is a FIFO queue, or a heap when less is set.
+type taskQueue struct {
+	tasks []task
+	less  func(a, b task) bool
+}
+
+func (q *taskQueue) add(t task) {
+	if q.less == nil {
+		q.tasks = append(q.tasks, t)
+		return
+	}
+	heap.Push(q, t)
+}
+
+func (q *taskQueue) next() task {
+	if q.less != nil {
+		return heap.Pop(q).(task)
+	}
+	t := q.tasks[0]
+	q.tasks[0] = task{}
+	q.tasks = q.tasks[1:]
+	return t
+}
+
+// heap.Interface
+func (q *taskQueue) Len() int           { return len(q.tasks) }
+func (q *taskQueue) Less(i, j int) bool { return q.less(q.tasks[i], q.tasks[j]) }
+func (q *taskQueue) Swap(i, j int)      { q.tasks[i], q.tasks[j] = q.tasks[j], q.tasks[i] }
+func (q *taskQueue) Push(x any)         { q.tasks = append(q.tasks, x.(task)) }
+
+func (q *taskQueue) Pop() any {
+	n := len(q.tasks) - 1
+	t := q.tasks[n]
+	q.tasks[n] = task{}
+	q.tasks = q.tasks[:n]
+	return t
+}
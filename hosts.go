@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// normalizeHost returns the lowercased host of u without the default port
+// of its scheme.
+func normalizeHost(u *url.URL) string {
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+	return host
+}
+
+// taskHost returns the normalized host of a task's URL.
+func taskHost(t task) string {
+	u, err := url.Parse(t.url)
+	if err != nil {
+		return ""
+	}
+	return normalizeHost(u)
+}
+
+// hostAllowed reports whether links to u may be followed from a page on
+// base: it must be on the same host or on one of AllowHosts. An allowed
+// host of the form "*.example.com" matches every subdomain of example.com.
+func (c *Crawler) hostAllowed(u, base *url.URL) bool {
+	host := normalizeHost(u)
+	return host == normalizeHost(base) || matchHost(host, c.AllowHosts)
+}
+
+// matchHost reports whether host is one of patterns, where a pattern of
+// the form "*.example.com" matches every subdomain of example.com.
+func matchHost(host string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// hostLimiter caps the number of requests in flight to each host. A task
+// for a host that is at its limit is parked rather than blocking the
+// worker, and put back in the frontier when one of that host's requests
+// finishes, so a slow host can't tie up every worker.
+type hostLimiter struct {
+	mu      sync.Mutex
+	limit   int // 0 for no limit
+	active  map[string]int
+	peak    map[string]int
+	waiting map[string][]task
+}
+
+func newHostLimiter(limit int) *hostLimiter {
+	return &hostLimiter{
+		limit:   limit,
+		active:  make(map[string]int),
+		peak:    make(map[string]int),
+		waiting: make(map[string][]task),
+	}
+}
+
+// acquire takes a slot for host, or parks t and returns false if there is
+// none.
+func (l *hostLimiter) acquire(host string, t task) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit > 0 && l.active[host] >= l.limit {
+		l.waiting[host] = append(l.waiting[host], t)
+		return false
+	}
+	l.active[host]++
+	if l.active[host] > l.peak[host] {
+		l.peak[host] = l.active[host]
+	}
+	return true
+}
+
+// release gives back a slot for host and returns a task parked for it, if
+// any, to be queued again.
+func (l *hostLimiter) release(host string) (task, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active[host]--
+	waiting := l.waiting[host]
+	if len(waiting) == 0 {
+		return task{}, false
+	}
+	t := waiting[0]
+	waiting[0] = task{}
+	if len(waiting) == 1 {
+		delete(l.waiting, host)
+	} else {
+		l.waiting[host] = waiting[1:]
+	}
+	return t, true
+}
+
+// hostPeak is the highest number of concurrent requests seen to a host.
+type hostPeak struct {
+	Host string `json:"host"`
+	Peak int    `json:"peak"`
+}
+
+// peaks returns the peak concurrency per host, busiest first.
+func (l *hostLimiter) peaks() []hostPeak {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	res := make([]hostPeak, 0, len(l.peak))
+	for host, peak := range l.peak {
+		res = append(res, hostPeak{host, peak})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Peak != res[j].Peak {
+			return res[i].Peak > res[j].Peak
+		}
+		return res[i].Host < res[j].Host
+	})
+	return res
+}
+
+// reportHostPeaks reports whether the peak concurrency per host is worth
+// reporting: when it is limited or more than one host was crawled.
+func (c *Crawler) reportHostPeaks() bool {
+	c.hosts.mu.Lock()
+	defer c.hosts.mu.Unlock()
+	return c.MaxConcurrencyPerHost > 0 || len(c.hosts.peak) > 1
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/tls"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// http3HandshakeTimeout is how long a QUIC handshake may take before the
+// host is taken to not serve HTTP/3.
+const http3HandshakeTimeout = 3 * time.Second
+
+// http3Transport sends requests over HTTP/3 with -http3. A request the
+// server doesn't answer over QUIC is sent again with the fallback
+// transport, and the host's further requests go straight to the fallback
+// so that only the first pays for the handshake. Headers, authentication,
+// redirects and timeouts are the client's, as with the fallback.
+type http3Transport struct {
+	h3       *http3.RoundTripper
+	fallback http.RoundTripper
+
+	mu sync.Mutex
+	// noHTTP3 holds the hosts that failed over HTTP/3.
+	noHTTP3 map[string]bool
+}
+
+func newHTTP3Transport(tlsConfig *tls.Config, fallback http.RoundTripper) *http3Transport {
+	if fallback == nil {
+		fallback = http.DefaultTransport
+	}
+	return &http3Transport{
+		h3: &http3.RoundTripper{
+			TLSClientConfig: tlsConfig,
+			QuicConfig:      &quic.Config{HandshakeIdleTimeout: http3HandshakeTimeout},
+		},
+		fallback: fallback,
+		noHTTP3:  make(map[string]bool),
+	}
+}
+
+func (t *http3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// QUIC is always encrypted, so http URLs are never fetched over it.
+	if req.URL.Scheme != "https" || t.fallsBack(req.URL.Host) {
+		return t.fallback.RoundTrip(req)
+	}
+	res, err := t.h3.RoundTrip(req)
+	if err == nil {
+		return res, nil
+	}
+	// A request out of time has none left for the fallback either.
+	if req.Context().Err() != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	first := !t.noHTTP3[req.URL.Host]
+	t.noHTTP3[req.URL.Host] = true
+	t.mu.Unlock()
+	if first {
+		slog.Info("no HTTP/3, falling back to HTTP/1.1 or HTTP/2", "host", req.URL.Host, "error", err)
+	}
+	return t.fallback.RoundTrip(req)
+}
+
+// fallsBack reports whether requests to host go straight to the fallback.
+func (t *http3Transport) fallsBack(host string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.noHTTP3[host]
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/quic-go/quic-go/http3"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// protoRecorder records the protocol of every request by path.
+type protoRecorder struct {
+	mu     sync.Mutex
+	protos map[string][]string
+}
+
+func (p *protoRecorder) record(r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.protos == nil {
+		p.protos = make(map[string][]string)
+	}
+	p.protos[r.URL.Path] = append(p.protos[r.URL.Path], r.Proto)
+}
+
+func (p *protoRecorder) get(path string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.protos[path]
+}
+
+// http3Site starts a TLS server for h, also serving HTTP/3 on the same
+// port if withHTTP3 is set, and returns it with a crawler of the config
+// changed by set that trusts its certificate and sends requests over
+// HTTP/3.
+func http3Site(t *testing.T, h http.Handler, withHTTP3 bool, set func(*Config)) (*httptest.Server, *Crawler) {
+	t.Helper()
+	srv := httptest.NewTLSServer(h)
+	t.Cleanup(srv.Close)
+	if withHTTP3 {
+		addr := srv.Listener.Addr().(*net.TCPAddr)
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: addr.IP, Port: addr.Port})
+		if err != nil {
+			t.Fatal(err)
+		}
+		h3 := &http3.Server{Handler: h, TLSConfig: &tls.Config{Certificates: srv.TLS.Certificates}}
+		go h3.Serve(conn)
+		t.Cleanup(func() {
+			h3.Close()
+			conn.Close()
+		})
+	}
+
+	c := newTestCrawler(t, func(cfg *Config) {
+		cfg.StartURL = srv.URL + "/"
+		cfg.HTTP3 = true
+		set(cfg)
+	})
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	tr := newHTTP3Transport(&tls.Config{RootCAs: roots}, srv.Client().Transport)
+	tr.h3.QuicConfig.HandshakeIdleTimeout = 500 * time.Millisecond
+	c.client.Transport = tr
+	return srv, c
+}
+
+func TestHTTP3SendsRequestsLikeTheStandardClient(t *testing.T) {
+	var protos protoRecorder
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protos.record(r)
+		if user, pass, _ := r.BasicAuth(); user != "user" || pass != "secret" || r.Header.Get("X-Warm") != "1" {
+			http.Error(w, "missing credentials or headers", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<a href="/a">a</a><a href="/slow">slow</a>`)
+		case "/slow":
+			time.Sleep(time.Second)
+		}
+	})
+	_, c := http3Site(t, h, true, func(cfg *Config) {
+		cfg.Username, cfg.Password = "user", "secret"
+		cfg.Headers = map[string]string{"X-Warm": "1"}
+		cfg.Timeout = 300 * time.Millisecond
+		cfg.Retries = 0
+	})
+
+	runWithin(t, c, 10*time.Second)
+
+	for _, path := range []string{"/", "/a"} {
+		if got := protos.get(path); len(got) != 1 || got[0] != "HTTP/3.0" {
+			t.Errorf("%s requested over %v, want HTTP/3.0 once", path, got)
+		}
+		r := resultFor(t, c, c.StartURL+strings.TrimPrefix(path, "/"))
+		if r.StatusCode != http.StatusOK || r.Protocol != "HTTP/3.0" || r.HTTP3Fallback {
+			t.Errorf("%s: status %d over %s, fallback %v, want 200 over HTTP/3.0", path, r.StatusCode, r.Protocol, r.HTTP3Fallback)
+		}
+	}
+	// The timeout holds over HTTP/3 too, and a request out of time isn't
+	// sent again over the fallback.
+	slow := resultFor(t, c, c.StartURL+"slow")
+	if slow.ErrClass != errTimeout {
+		t.Errorf("slow page: error %v, want a timeout", slow.Err)
+	}
+	if got := protos.get("/slow"); len(got) != 1 || got[0] != "HTTP/3.0" {
+		t.Errorf("slow page requested over %v, want HTTP/3.0 once", got)
+	}
+	if n := c.stats.protocols["HTTP/3.0"]; n != 2 {
+		t.Errorf("%d pages counted over HTTP/3.0, want 2", n)
+	}
+}
+
+func TestHTTP3FallsBackForServersWithoutIt(t *testing.T) {
+	var protos protoRecorder
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protos.record(r)
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<a href="/a">a</a><a href="/b">b</a>`)
+		}
+	})
+	_, c := http3Site(t, h, false, func(cfg *Config) {})
+
+	runWithin(t, c, 10*time.Second)
+
+	for _, path := range []string{"/", "/a", "/b"} {
+		if got := protos.get(path); len(got) != 1 || got[0] != "HTTP/1.1" {
+			t.Errorf("%s requested over %v, want HTTP/1.1 once", path, got)
+		}
+		r := resultFor(t, c, c.StartURL+strings.TrimPrefix(path, "/"))
+		if r.StatusCode != http.StatusOK || r.Protocol != "HTTP/1.1" || !r.HTTP3Fallback {
+			t.Errorf("%s: status %d over %s, fallback %v, want 200 over HTTP/1.1 after a fallback", path, r.StatusCode, r.Protocol, r.HTTP3Fallback)
+		}
+	}
+	var report strings.Builder
+	c.report(&report, time.Second)
+	for _, want := range []string{"Protocol Breakdown:\nHTTP/1.1: 3 pages\n", "Fell back from HTTP/3: 3 pages"} {
+		if !strings.Contains(report.String(), want) {
+			t.Errorf("report doesn't have %q:\n%s", want, report.String())
+		}
+	}
+}
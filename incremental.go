@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// previousRun is the per-URL data of an earlier run loaded with -previous.
+type previousRun struct {
+	results map[string]Result
+
+	// links maps a page to the URLs the previous run discovered on it, so
+	// a crawl can still follow the links of pages it skips.
+	links map[string][]string
+}
+
+func loadPrevious(path string) (*previousRun, error) {
+	c, _, err := loadResults(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &previousRun{results: c.results, links: make(map[string][]string)}
+	for _, r := range c.results {
+		if r.Referrer != "" {
+			from := resultKey(Result{Site: r.Site, URL: r.Referrer})
+			p.links[from] = append(p.links[from], r.URL)
+		}
+	}
+	return p, nil
+}
+
+// checkPrevious decides what to do with t given the previous run. A URL
+// that failed before, or is unknown, is always fetched. One that succeeded
+// is fresh if the sitemap says it hasn't been modified since it was last
+// fetched; without a lastmod it is revalidated with the stored ETag and
+// Last-Modified values, which are then returned as conditional headers.
+func (c *Crawler) checkPrevious(t task) (prev Result, fresh bool, conditional http.Header) {
+	if c.previous == nil {
+		return Result{}, false, nil
+	}
+	prev, ok := c.previous.results[resultKey(Result{Site: c.Name, URL: t.url})]
+	if !ok || prev.Err != nil || prev.StatusCode >= 400 || prev.FetchedAt.IsZero() {
+		return prev, false, nil
+	}
+
+	if !t.lastmod.IsZero() {
+		return prev, !t.lastmod.After(prev.FetchedAt), nil
+	}
+
+	if prev.ETag != "" || prev.LastModified != "" {
+		conditional = make(http.Header)
+		if prev.ETag != "" {
+			conditional.Set("If-None-Match", prev.ETag)
+		}
+		if prev.LastModified != "" {
+			conditional.Set("If-Modified-Since", prev.LastModified)
+		}
+	}
+	return prev, false, conditional
+}
+
+// carryOver returns the previous result marked as skipped for being fresh.
+func (r Result) carryOver(referrer string) Result {
+	r.Referrer = referrer
+	r.Fresh = true
+	return r
+}
+
+// scheduleKnownLinks schedules the links the previous run found on u, which
+// isn't fetched this time.
+func (c *Crawler) scheduleKnownLinks(u string) {
+	for _, link := range c.previous.links[resultKey(Result{Site: c.Name, URL: u})] {
+		c.schedule(link, u)
+	}
+}
+
+// formatTime formats t for the JSON output, empty if it is zero.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
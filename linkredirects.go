@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+)
+
+// maxLinkingPages is how many of the pages linking to a URL are kept.
+const maxLinkingPages = 10
+
+// inlinks are the links to a URL: the first maxLinkingPages pages they are
+// on, and how many links there are.
+type inlinks struct {
+	pages []string
+	count int
+}
+
+// recordLink records that page links to target, so links to redirects can be
+// traced back to where they are. It needs every result in memory, so isn't
+// done with -low-memory.
+func (c *Crawler) recordLink(target, page string) {
+	if c.results == nil {
+		return
+	}
+	key := urlKey(target)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	in := c.inlinks[key]
+	if in == nil {
+		in = &inlinks{}
+		c.inlinks[key] = in
+	}
+	in.count++
+	if len(in.pages) < maxLinkingPages && !slices.Contains(in.pages, page) {
+		in.pages = append(in.pages, page)
+	}
+}
+
+// firstRedirectStatus returns the status of the first redirect followed to
+// get res, or 0 if there was none.
+func firstRedirectStatus(res *http.Response) int {
+	status := 0
+	for req := res.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		status = req.Response.StatusCode
+	}
+	return status
+}
+
+// redirectedLink is a link target that redirected. For a page that only
+// redirects with a meta refresh, FinalURL is its target and meta is set.
+type redirectedLink struct {
+	Result
+	linkedFrom []string
+	links      int
+	meta       bool
+}
+
+// redirectedLinks returns the URLs linked to from crawled pages that
+// redirected, with HTTP or a meta refresh, the most linked first.
+func (c *Crawler) redirectedLinks() []redirectedLink {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var res []redirectedLink
+	for _, r := range c.results {
+		if r.FinalURL == "" && r.MetaRefresh == "" || r.Err != nil {
+			continue
+		}
+		if in := c.inlinks[urlKey(r.URL)]; in != nil {
+			l := redirectedLink{Result: r, linkedFrom: slices.Clone(in.pages), links: in.count}
+			if r.FinalURL == "" {
+				l.FinalURL, l.meta = r.MetaRefresh, true
+			}
+			res = append(res, l)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].links != res[j].links {
+			return res[i].links > res[j].links
+		}
+		return resultKey(res[i].Result) < resultKey(res[j].Result)
+	})
+	return res
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// processList schedules the URLs in a file, one per line. Blank lines and
+// lines starting with # are ignored. A path of "-" reads from stdin.
+func (c *Crawler) processList(path string) error {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		c.schedule(line, "")
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// urlLoad aggregates the requests made for one URL in a -duration run. The
+// percentiles come from the samples while the run is going, and are kept as
+// they are for results loaded from a file.
+type urlLoad struct {
+	Requests int
+	Errors   int
+
+	samples       *exactLatencies
+	p50, p95, p99 time.Duration
+}
+
+func (l *urlLoad) quantiles() (p50, p95, p99 time.Duration) {
+	if l.samples == nil {
+		return l.p50, l.p95, l.p99
+	}
+	return l.samples.quantile(0.50), l.samples.quantile(0.95), l.samples.quantile(0.99)
+}
+
+func (l *urlLoad) errorRate() float64 {
+	if l.Requests == 0 {
+		return 0
+	}
+	return float64(l.Errors) / float64(l.Requests)
+}
+
+func validateLoad(cfg Config) error {
+	if cfg.LoadDuration <= 0 {
+		return nil
+	}
+	if cfg.SitemapURL == "" && cfg.ListFile == "" && cfg.WeightedFile == "" || cfg.Orphans {
+		return fmt.Errorf("-duration needs a sitemap or a list of URLs to request, it doesn't crawl")
+	}
+	if cfg.Order != orderFIFO || len(cfg.Priorities) > 0 || cfg.WeightedFile != "" {
+		return fmt.Errorf("-duration can't be combined with -order, -priority or -weighted-file, which would keep requesting the first URLs")
+	}
+	return nil
+}
+
+// recordLoad adds r to the requests of its URL and returns their
+// aggregate. The caller holds the lock.
+func (c *Crawler) recordLoad(r Result) *urlLoad {
+	key := resultKey(r)
+	l := c.loads[key]
+	if l == nil {
+		l = &urlLoad{samples: &exactLatencies{}}
+		c.loads[key] = l
+	}
+	l.Requests++
+	if !c.succeeded(r) {
+		l.Errors++
+	}
+	if r.Err == nil {
+		l.samples.record(r.ResponseTime)
+	}
+	return l
+}
+
+// requeueForLoad queues the URL of t again, behind the others, until
+// LoadDuration has passed.
+func (c *Crawler) requeueForLoad(t task) {
+	if c.quit.Load() || c.activeTime(time.Now()) >= c.LoadDuration {
+		return
+	}
+	c.enqueue(task{url: t.url, referrer: t.referrer, iteration: t.iteration + 1})
+}
+
+// loadTotals returns the number of URLs requested in a -duration run and
+// the number of requests made for them.
+func (c *Crawler) loadTotals() (urls, requests int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, r := range c.results {
+		if r.Load != nil {
+			urls++
+			requests += r.Load.Requests
+		}
+	}
+	return urls, requests
+}
+
+// loaded returns the results of a -duration run, those with the slowest
+// 95th percentile first.
+func (c *Crawler) loaded() []Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var res []Result
+	p95 := make(map[string]time.Duration)
+	for key, r := range c.results {
+		if r.Load != nil {
+			res = append(res, r)
+			_, p95[key], _ = r.Load.quantiles()
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		a, b := p95[resultKey(res[i])], p95[resultKey(res[j])]
+		if a != b {
+			return a > b
+		}
+		return resultKey(res[i]) < resultKey(res[j])
+	})
+	return res
+}
+
+// reportLoad writes the totals of a -duration run and the URLs with the
+// slowest 95th percentile.
+func (c *Crawler) reportLoad(w io.Writer, crawlTime time.Duration) {
+	urls, requests := c.loadTotals()
+	if urls == 0 {
+		return
+	}
+	var achieved float64
+	if crawlTime > 0 {
+		achieved = float64(requests) / crawlTime.Seconds()
+	}
+	requested := "no -rate limit"
+	if c.Rate > 0 {
+		requested = fmt.Sprintf("%.1f req/s requested", c.Rate)
+	}
+	fmt.Fprintf(w, "\nSustained load: %d requests to %d URLs in %v, %.1f req/s (%s)\n",
+		requests, urls, crawlTime.Round(time.Second), achieved, requested)
+
+	for i, r := range c.loaded() {
+		if i == maxReportedFailures {
+			fmt.Fprintf(w, "  ... and %d more\n", urls-i)
+			break
+		}
+		p50, p95, p99 := r.Load.quantiles()
+		fmt.Fprintf(w, "  %s: %d requests, %.1f%% errors, p50 %v | p95 %v | p99 %v\n", r.URL, r.Load.Requests,
+			r.Load.errorRate()*100, p50.Round(time.Millisecond), p95.Round(time.Millisecond), p99.Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/PuerkitoBio/goquery"
+	"net/url"
+	"strings"
+)
+
+// metaRefreshTarget returns the URL in the content of a
+// <meta http-equiv="refresh"> tag, as browsers parse it: a delay, then
+// optionally a ; or , and the URL, with or without url= and quotes, e.g.
+// `0;url=/new`, `0; URL='/new'` or `5, /new`. A delay alone reloads the page
+// itself and has no target.
+func metaRefreshTarget(content string) string {
+	s := strings.TrimLeft(content, " \t\n\f\r")
+	s = strings.TrimLeft(s, "0123456789.")
+	s = strings.TrimLeft(s, " \t\n\f\r")
+	if s != "" && (s[0] == ';' || s[0] == ',') {
+		s = strings.TrimLeft(s[1:], " \t\n\f\r")
+	}
+	if len(s) >= 3 && strings.EqualFold(s[:3], "url") {
+		if rest := strings.TrimLeft(s[3:], " \t\n\f\r"); strings.HasPrefix(rest, "=") {
+			s = strings.TrimLeft(rest[1:], " \t\n\f\r")
+		}
+	}
+	if s != "" && (s[0] == '\'' || s[0] == '"') {
+		quote := s[0]
+		s = s[1:]
+		if i := strings.IndexByte(s, quote); i >= 0 {
+			s = s[:i]
+		}
+	}
+	return strings.TrimSpace(s)
+}
+
+// followMetaRefresh queues the target of the page's meta refresh, which is
+// a redirect as far as a visitor is concerned but isn't one to the HTTP
+// client, and returns it. Like links, it is only followed to the allowed
+// hosts; "" is returned if there is no target to follow.
+func (c *Crawler) followMetaRefresh(doc *goquery.Document, linkBase, baseURL *url.URL, u string) string {
+	var content string
+	doc.Find("meta[http-equiv][content]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		if strings.EqualFold(strings.TrimSpace(s.AttrOr("http-equiv", "")), "refresh") {
+			content = s.AttrOr("content", "")
+			return false
+		}
+		return true
+	})
+	target := metaRefreshTarget(content)
+	if target == "" {
+		return ""
+	}
+	ref, err := url.Parse(target)
+	if err != nil {
+		return ""
+	}
+	abs := linkBase.ResolveReference(ref)
+	link := removeHashFromURL(abs.String())
+	if abs.Scheme != "http" && abs.Scheme != "https" || link == removeHashFromURL(u) || !c.hostAllowed(abs, baseURL) {
+		return ""
+	}
+	c.schedule(link, u)
+	return link
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// mixedContent returns the http:// URLs in the href and src attributes of
+// doc, in document order and without duplicates. Protocol-relative URLs
+// take on the page's scheme and aren't returned.
+func mixedContent(doc *goquery.Document) []string {
+	var refs []string
+	seen := make(map[string]bool)
+	doc.Find("[href], [src]").Each(func(_ int, s *goquery.Selection) {
+		for _, attr := range []string{"href", "src"} {
+			v, ok := s.Attr(attr)
+			v = strings.TrimSpace(v)
+			if !ok || len(v) < len("http://") || !strings.EqualFold(v[:len("http://")], "http://") || seen[v] {
+				continue
+			}
+			seen[v] = true
+			refs = append(refs, v)
+		}
+	})
+	return refs
+}
+
+// mixedContentPages returns the results that have mixed content, sorted by
+// URL.
+func (c *Crawler) mixedContentPages() []Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var res []Result
+	for _, r := range c.results {
+		if len(r.MixedContent) > 0 {
+			res = append(res, r)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return resultKey(res[i]) < resultKey(res[j]) })
+	return res
+}
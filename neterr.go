@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"syscall"
+)
+
+// Classes of the errors a request can fail with, so the report can tell a
+// flaky resolver from an overloaded origin.
+const (
+	errTimeout      = "timeout"
+	errDNSNotFound  = "dns_nxdomain"
+	errDNS          = "dns_failure"
+	errRefused      = "connection_refused"
+	errTLS          = "tls_handshake"
+	errReset        = "connection_reset"
+	errRedirectLoop = "redirect_loop"
+	errOther        = "other"
+)
+
+// classifyError returns the class of an error returned by sendRequest.
+func classifyError(err error) string {
+	var loopErr *redirectLoopError
+	if errors.As(err, &loopErr) {
+		return errRedirectLoop
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsNotFound {
+			return errDNSNotFound
+		}
+		return errDNS
+	}
+
+	var (
+		certErr      *tls.CertificateVerificationError
+		recordErr    tls.RecordHeaderError
+		alertErr     tls.AlertError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+	switch {
+	case errors.As(err, &certErr), errors.As(err, &recordErr), errors.As(err, &alertErr),
+		errors.As(err, &authorityErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return errTLS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return errRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return errReset
+	case errors.Is(err, context.DeadlineExceeded):
+		return errTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return errTimeout
+	}
+	return errOther
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// openAPISpec is the part of an OpenAPI 3 document needed to list its GET
+// operations. JSON documents are read as YAML.
+type openAPISpec struct {
+	Servers []struct {
+		URL       string `yaml:"url"`
+		Variables map[string]struct {
+			Default string `yaml:"default"`
+		} `yaml:"variables"`
+	} `yaml:"servers"`
+	Paths map[string]struct {
+		Parameters []openAPIParameter `yaml:"parameters"`
+		Get        *struct {
+			Parameters []openAPIParameter `yaml:"parameters"`
+		} `yaml:"get"`
+	} `yaml:"paths"`
+	Components struct {
+		Parameters map[string]openAPIParameter `yaml:"parameters"`
+	} `yaml:"components"`
+}
+
+type openAPIParameter struct {
+	Ref      string `yaml:"$ref"`
+	Name     string `yaml:"name"`
+	In       string `yaml:"in"`
+	Required bool   `yaml:"required"`
+}
+
+// openAPISkipped is a GET operation of a -openapi spec that wasn't warmed
+// because some of its parameters have no values.
+type openAPISkipped struct {
+	Path    string   `json:"path"`
+	Missing []string `json:"missing"`
+}
+
+// openAPIPathParam matches the {name} of a path parameter.
+var openAPIPathParam = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// openAPIValues are the values of -openapi-values to fill parameters with:
+// lists of values by parameter name, and by path for the values that only
+// apply to the operations of that path.
+type openAPIValues struct {
+	global map[string][]string
+	byPath map[string]map[string][]string
+}
+
+// readOpenAPIValues reads a YAML file mapping parameter names to a value or
+// a list of values. A key starting with / is a path of the spec, mapping
+// the names of its parameters to values that take precedence there.
+func readOpenAPIValues(path string) (openAPIValues, error) {
+	v := openAPIValues{global: make(map[string][]string), byPath: make(map[string]map[string][]string)}
+	if path == "" {
+		return v, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return v, err
+	}
+	var raw map[string]yaml.Node
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return v, fmt.Errorf("%s: %w", path, err)
+	}
+	for key, node := range raw {
+		if !strings.HasPrefix(key, "/") {
+			if v.global[key], err = openAPIValueList(&node); err != nil {
+				return v, fmt.Errorf("%s: %s: %w", path, key, err)
+			}
+			continue
+		}
+		var params map[string]yaml.Node
+		if err := node.Decode(&params); err != nil {
+			return v, fmt.Errorf("%s: %s: expected parameter values", path, key)
+		}
+		v.byPath[key] = make(map[string][]string)
+		for name, n := range params {
+			if v.byPath[key][name], err = openAPIValueList(&n); err != nil {
+				return v, fmt.Errorf("%s: %s: %s: %w", path, key, name, err)
+			}
+		}
+	}
+	return v, nil
+}
+
+// openAPIValueList decodes a scalar or a list of scalars.
+func openAPIValueList(node *yaml.Node) ([]string, error) {
+	if node.Kind == yaml.ScalarNode {
+		return []string{node.Value}, nil
+	}
+	var values []string
+	if err := node.Decode(&values); err != nil {
+		return nil, fmt.Errorf("expected a value or a list of values")
+	}
+	return values, nil
+}
+
+// lookup returns the values of the parameter name for the operations of
+// path.
+func (v openAPIValues) lookup(path, name string) []string {
+	if values, ok := v.byPath[path][name]; ok {
+		return values
+	}
+	return v.global[name]
+}
+
+// readOpenAPISpec reads an OpenAPI 3 document, in YAML or JSON.
+func readOpenAPISpec(path string) (*openAPISpec, error) {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+	var spec openAPISpec
+	if err := yaml.NewDecoder(in).Decode(&spec); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &spec, nil
+}
+
+// serverURL returns the URL the paths of the spec are relative to:
+// -openapi-server if given, otherwise the first server of the spec with
+// its variables set to their defaults, which has to be absolute.
+func (spec *openAPISpec) serverURL(override string) (string, error) {
+	u := override
+	if u == "" {
+		if len(spec.Servers) == 0 {
+			return "", fmt.Errorf("the spec lists no servers, give the URL of the API with -openapi-server")
+		}
+		s := spec.Servers[0]
+		u = openAPIPathParam.ReplaceAllStringFunc(s.URL, func(m string) string {
+			return s.Variables[m[1:len(m)-1]].Default
+		})
+	}
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", fmt.Errorf("the server URL %q isn't absolute, give the URL of the API with -openapi-server", u)
+	}
+	return strings.TrimSuffix(u, "/"), nil
+}
+
+// resolve returns the parameter p refers to if it is a reference to the
+// parameters of the components of the spec.
+func (spec *openAPISpec) resolve(p openAPIParameter) openAPIParameter {
+	if name, ok := strings.CutPrefix(p.Ref, "#/components/parameters/"); ok {
+		return spec.Components.Parameters[name]
+	}
+	return p
+}
+
+// openAPIURLs returns the URLs of every GET operation of the spec, one for
+// every combination of the values of its path parameters, in the order of
+// their paths. Required query parameters are set to their values too. The
+// operations with parameters that have no values are returned as skipped.
+func (spec *openAPISpec) openAPIURLs(server string, values openAPIValues) (urls []string, skipped []openAPISkipped) {
+	paths := make([]string, 0, len(spec.Paths))
+	for path, item := range spec.Paths {
+		if item.Get != nil {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		item := spec.Paths[path]
+		// Operation parameters override the path's of the same name and
+		// location.
+		params := make(map[string]openAPIParameter)
+		for _, list := range [][]openAPIParameter{item.Parameters, item.Get.Parameters} {
+			for _, p := range list {
+				p = spec.resolve(p)
+				params[p.In+":"+p.Name] = p
+			}
+		}
+
+		var missing []string
+		candidates := []string{path}
+		for _, m := range openAPIPathParam.FindAllStringSubmatch(path, -1) {
+			vals := values.lookup(path, m[1])
+			if len(vals) == 0 {
+				missing = append(missing, m[1])
+				continue
+			}
+			var next []string
+			for _, c := range candidates {
+				for _, v := range vals {
+					next = append(next, strings.Replace(c, m[0], url.PathEscape(v), 1))
+				}
+			}
+			candidates = next
+		}
+		query := url.Values{}
+		names := make([]string, 0, len(params))
+		for key := range params {
+			names = append(names, key)
+		}
+		sort.Strings(names)
+		for _, key := range names {
+			p := params[key]
+			if p.In != "query" || !p.Required {
+				continue
+			}
+			vals := values.lookup(path, p.Name)
+			if len(vals) == 0 {
+				missing = append(missing, p.Name)
+				continue
+			}
+			query.Set(p.Name, vals[0])
+		}
+		if len(missing) > 0 {
+			skipped = append(skipped, openAPISkipped{Path: path, Missing: missing})
+			continue
+		}
+		for _, c := range candidates {
+			u := server + c
+			if len(query) > 0 {
+				u += "?" + query.Encode()
+			}
+			urls = append(urls, u)
+		}
+	}
+	return urls, skipped
+}
+
+// processOpenAPI schedules the GET operations of the -openapi spec, as API
+// requests that are warmed without looking for links, and records those
+// skipped for lack of parameter values.
+func (c *Crawler) processOpenAPI() error {
+	spec, err := readOpenAPISpec(c.OpenAPI)
+	if err != nil {
+		return err
+	}
+	server, err := spec.serverURL(c.OpenAPIServer)
+	if err != nil {
+		return err
+	}
+	values, err := readOpenAPIValues(c.OpenAPIValues)
+	if err != nil {
+		return err
+	}
+	urls, skipped := spec.openAPIURLs(server, values)
+	for _, s := range skipped {
+		slog.Warn("skipping API operation with parameters without values", c.logArgs("path", s.Path, "missing", s.Missing)...)
+	}
+	c.lock.Lock()
+	c.openAPISkipped = skipped
+	c.lock.Unlock()
+	for _, u := range urls {
+		c.scheduleTask(task{url: u, api: true})
+	}
+	return nil
+}
+
+// apiHeader returns header with the Accept of API requests added.
+func apiHeader(header http.Header) http.Header {
+	h := header.Clone()
+	if h == nil {
+		h = make(http.Header)
+	}
+	h.Set("Accept", "application/json")
+	return h
+}
+
+// reportOpenAPISkipped writes the operations of the -openapi spec that
+// weren't warmed, and the parameters they lacked values for.
+func (c *Crawler) reportOpenAPISkipped(w io.Writer) {
+	if len(c.openAPISkipped) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "API operations skipped for lack of parameter values: %d\n", len(c.openAPISkipped))
+	for i, s := range c.openAPISkipped {
+		if i == maxReportedFailures {
+			fmt.Fprintf(w, "  ... and %d more\n", len(c.openAPISkipped)-i)
+			break
+		}
+		fmt.Fprintf(w, "  GET %s: no values for %s\n", s.Path, strings.Join(s.Missing, ", "))
+	}
+}
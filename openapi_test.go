@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// An API request always carries an Accept header, which mustn't be taken
+// for the validators of a previous result: a 304 for a URL not warmed
+// before is a result of its own, not a carried over empty one.
+func TestOpenAPINotModifiedWithoutPreviousResult(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/json" {
+			t.Errorf("Accept = %q, want application/json", r.Header.Get("Accept"))
+		}
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer srv.Close()
+
+	spec := filepath.Join(t.TempDir(), "openapi.yaml")
+	if err := os.WriteFile(spec, []byte("paths:\n  /items:\n    get: {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestCrawler(t, func(cfg *Config) {
+		cfg.OpenAPI = spec
+		cfg.OpenAPIServer = srv.URL
+	})
+	var mu sync.Mutex
+	var results []Result
+	c.OnResult = func(r Result) {
+		mu.Lock()
+		results = append(results, r)
+		mu.Unlock()
+	}
+	runWithin(t, c, 10*time.Second)
+
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	r := results[0]
+	if r.URL != srv.URL+"/items" || r.StatusCode != http.StatusNotModified || r.Fresh {
+		t.Errorf("result = %s %d fresh=%v, want %s/items 304 not fresh", r.URL, r.StatusCode, r.Fresh, srv.URL)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+)
+
+// loadSitemapURLs fetches the URLs listed in the sitemap for -orphans,
+// without queueing them.
+func (c *Crawler) loadSitemapURLs() {
+	c.sitemapURLs = make(map[string]string)
+	add := func(t task) {
+		if t.asset != "" {
+			// Assets aren't pages a link could lead to.
+			return
+		}
+		c.lock.Lock()
+		c.sitemapURLs[urlKey(t.url)] = t.url
+		c.lock.Unlock()
+	}
+	if err := c.processSitemapURL(c.SitemapURL, add); err != nil {
+		slog.Error("sitemap failed", "error", err)
+		c.sitemapFailed(c.SitemapURL, err)
+	}
+}
+
+// orphans compares the sitemap with the pages reached by following links.
+// It returns the sitemap URLs the crawl never reached, and the pages that
+// were warmed successfully but aren't in the sitemap, both sorted.
+func (c *Crawler) orphans() (orphaned, unlisted []string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.sitemapURLs == nil {
+		return nil, nil
+	}
+
+	reached := make(map[string]bool)
+	for _, r := range c.results {
+		key := urlKey(r.URL)
+		reached[key] = true
+		if r.FinalURL != "" {
+			reached[urlKey(r.FinalURL)] = true
+		}
+		if _, listed := c.sitemapURLs[key]; !listed && c.succeeded(r) && !r.OffHost && r.FinalURL == "" {
+			unlisted = append(unlisted, r.URL)
+		}
+	}
+	for key, u := range c.sitemapURLs {
+		if !reached[key] {
+			orphaned = append(orphaned, u)
+		}
+	}
+	sort.Strings(orphaned)
+	sort.Strings(unlisted)
+	return orphaned, unlisted
+}
+
+// reportOrphans writes the -orphans comparison, at most maxReportedFailures
+// URLs of each kind.
+func (c *Crawler) reportOrphans(w io.Writer) {
+	if c.sitemapURLs == nil {
+		return
+	}
+	orphaned, unlisted := c.orphans()
+	for _, section := range []struct {
+		title string
+		urls  []string
+	}{
+		{"Orphan pages (in the sitemap, not linked from any crawled page)", orphaned},
+		{"Pages missing from the sitemap", unlisted},
+	} {
+		fmt.Fprintf(w, "\n%s: %d\n", section.title, len(section.urls))
+		for i, u := range section.urls {
+			if i == maxReportedFailures {
+				fmt.Fprintf(w, "  ... and %d more\n", len(section.urls)-i)
+				break
+			}
+			fmt.Fprintf(w, "  %s\n", u)
+		}
+	}
+}
@@ -0,0 +1,831 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Output formats accepted by -output.
+const (
+	formatText   = "text"
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+)
+
+func validOutputFormat(f string) bool {
+	switch f {
+	case formatText, formatJSON, formatNDJSON:
+		return true
+	}
+	return false
+}
+
+type jsonResult struct {
+	Site           string        `json:"site,omitempty"`
+	URL            string        `json:"url"`
+	Referrer       string        `json:"referrer,omitempty"`
+	StatusCode     int           `json:"status"`
+	Status         string        `json:"status_text,omitempty"`
+	ResponseTimeMs float64       `json:"response_time_ms"`
+	Size           int64         `json:"size"`
+	Error          string        `json:"error,omitempty"`
+	ErrorClass     string        `json:"error_class,omitempty"`
+	TimeoutLimit   string        `json:"timeout_limit,omitempty"`
+	FetchedAt      string        `json:"fetched_at,omitempty"`
+	ETag           string        `json:"etag,omitempty"`
+	LastModified   string        `json:"last_modified,omitempty"`
+	ContentType    string        `json:"content_type,omitempty"`
+	Protocol       string        `json:"protocol,omitempty"`
+	HTTP3Fallback  bool          `json:"http3_fallback,omitempty"`
+	Alternate      string        `json:"alternate,omitempty"`
+	Asset          string        `json:"asset,omitempty"`
+	API            bool          `json:"api,omitempty"`
+	Fresh          bool          `json:"skipped_fresh,omitempty"`
+	FinalURL       string        `json:"final_url,omitempty"`
+	RedirectStatus int           `json:"redirect_status,omitempty"`
+	MetaRefresh    string        `json:"meta_refresh,omitempty"`
+	BodyHash       string        `json:"body_sha256,omitempty"`
+	Uncompressed   bool          `json:"uncompressed,omitempty"`
+	GzipEstimate   int64         `json:"gzip_estimate,omitempty"`
+	OffHost        bool          `json:"off_host,omitempty"`
+	PurgeStatus    int           `json:"purge_status,omitempty"`
+	PurgeTimeMs    float64       `json:"purge_time_ms,omitempty"`
+	PurgeError     string        `json:"purge_error,omitempty"`
+	Attempts       int           `json:"attempts,omitempty"`
+	RetryPolicy    string        `json:"retry_policy,omitempty"`
+	History        []jsonAttempt `json:"attempt_history,omitempty"`
+	NoIndex        bool          `json:"noindex,omitempty"`
+	Slow           bool          `json:"slow,omitempty"`
+	Oversize       bool          `json:"oversize,omitempty"`
+
+	HeaderViolations []string           `json:"header_violations,omitempty"`
+	RequiredHeaders  map[string]string  `json:"required_headers,omitempty"`
+	Assertions       []assertionOutcome `json:"assertions,omitempty"`
+	CapturedHeaders  http.Header        `json:"captured_headers,omitempty"`
+	MixedContent     []string           `json:"mixed_content,omitempty"`
+	Soft404          string             `json:"soft_404,omitempty"`
+	SEO              *seoAudit          `json:"seo,omitempty"`
+	Variants         []string           `json:"variants,omitempty"`
+
+	SecondResponseTimeMs float64 `json:"second_response_time_ms,omitempty"`
+	Speedup              float64 `json:"speedup,omitempty"`
+
+	Repeat  *jsonRepeat  `json:"repeat,omitempty"`
+	Load    *jsonLoad    `json:"load,omitempty"`
+	Timings *jsonTimings `json:"timings,omitempty"`
+}
+
+// jsonLoad aggregates the requests for a URL in a -duration run.
+type jsonLoad struct {
+	Requests  int     `json:"requests"`
+	Errors    int     `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+	P50Ms     float64 `json:"p50_ms"`
+	P95Ms     float64 `json:"p95_ms"`
+	P99Ms     float64 `json:"p99_ms"`
+}
+
+// jsonRepeat is the spread of the response times of a URL fetched with
+// -repeat.
+type jsonRepeat struct {
+	Count    int     `json:"count"`
+	Errors   int     `json:"errors,omitempty"`
+	MinMs    float64 `json:"min_ms"`
+	MeanMs   float64 `json:"mean_ms"`
+	MaxMs    float64 `json:"max_ms"`
+	StdDevMs float64 `json:"stddev_ms"`
+}
+
+// jsonDuplicateGroup is a set of URLs that served the same body, with the
+// size of each.
+type jsonDuplicateGroup struct {
+	Hash  string   `json:"sha256"`
+	URLs  []string `json:"urls"`
+	Sizes []int64  `json:"sizes"`
+}
+
+// jsonExternalLink is a broken external link.
+type jsonExternalLink struct {
+	URL        string   `json:"url"`
+	StatusCode int      `json:"status_code,omitempty"`
+	Error      string   `json:"error,omitempty"`
+	LinkedFrom []string `json:"linked_from"`
+}
+
+// jsonRedirectedLink is a linked URL that redirects.
+type jsonRegression struct {
+	URL            string  `json:"url"`
+	BaselineMs     float64 `json:"baseline_ms"`
+	ResponseTimeMs float64 `json:"response_time_ms"`
+}
+
+type jsonRedirectedLink struct {
+	URL         string   `json:"url"`
+	FinalURL    string   `json:"final_url"`
+	Status      int      `json:"status,omitempty"`
+	MetaRefresh bool     `json:"meta_refresh,omitempty"`
+	Links       int      `json:"links"`
+	LinkedFrom  []string `json:"linked_from"`
+}
+
+// jsonLatencyCheck is the outcome of a latency assertion.
+type jsonLatencyCheck struct {
+	Name       string  `json:"name"`
+	LimitMs    float64 `json:"limit_ms"`
+	MeasuredMs float64 `json:"measured_ms"`
+	Passed     bool    `json:"passed"`
+}
+
+// jsonAttempt is one of the attempts of a URL that took several.
+type jsonAttempt struct {
+	StatusCode int     `json:"status,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+func newJSONResult(r Result) jsonResult {
+	jr := jsonResult{
+		Site:           r.Site,
+		URL:            r.URL,
+		Referrer:       r.Referrer,
+		StatusCode:     r.StatusCode,
+		Status:         r.Status,
+		ResponseTimeMs: durationMs(r.ResponseTime),
+		Size:           r.Size,
+		FetchedAt:      formatTime(r.FetchedAt),
+		ETag:           r.ETag,
+		LastModified:   r.LastModified,
+		ContentType:    r.ContentType,
+		Protocol:       r.Protocol,
+		HTTP3Fallback:  r.HTTP3Fallback,
+		Alternate:      r.Alternate,
+		Asset:          r.Asset,
+		API:            r.API,
+		Fresh:          r.Fresh,
+		FinalURL:       r.FinalURL,
+		RedirectStatus: r.RedirectStatus,
+		MetaRefresh:    r.MetaRefresh,
+		BodyHash:       r.BodyHash,
+		Uncompressed:   r.Uncompressed,
+		GzipEstimate:   r.GzipEstimate,
+		OffHost:        r.OffHost,
+		NoIndex:        r.NoIndex,
+		Slow:           r.Slow,
+		Oversize:       r.Oversize,
+
+		HeaderViolations: r.HeaderViolations,
+		RequiredHeaders:  r.RequiredHeaders,
+		Assertions:       r.Assertions,
+		CapturedHeaders:  r.CapturedHeaders,
+		MixedContent:     r.MixedContent,
+		Soft404:          r.Soft404,
+		SEO:              r.SEO,
+		Variants:         r.Variants,
+
+		SecondResponseTimeMs: durationMs(r.SecondResponseTime),
+		Speedup:              r.Speedup,
+		Timings:              r.Timings.json(),
+	}
+	jr.RetryPolicy = r.RetryPolicy
+	if r.Attempts > 1 {
+		jr.Attempts = r.Attempts
+	}
+	if l := r.Load; l != nil {
+		p50, p95, p99 := l.quantiles()
+		jr.Load = &jsonLoad{
+			Requests:  l.Requests,
+			Errors:    l.Errors,
+			ErrorRate: l.errorRate(),
+			P50Ms:     durationMs(p50),
+			P95Ms:     durationMs(p95),
+			P99Ms:     durationMs(p99),
+		}
+	}
+	if t := r.Repeat; t != nil {
+		jr.Repeat = &jsonRepeat{
+			Count:    t.Count,
+			Errors:   t.Errors,
+			MinMs:    durationMs(t.Min),
+			MeanMs:   durationMs(t.Mean),
+			MaxMs:    durationMs(t.Max),
+			StdDevMs: durationMs(t.StdDev),
+		}
+	}
+	for _, a := range r.History {
+		ja := jsonAttempt{StatusCode: a.StatusCode, DurationMs: durationMs(a.Duration)}
+		if a.Err != nil {
+			ja.Error = a.Err.Error()
+		}
+		jr.History = append(jr.History, ja)
+	}
+	if r.Err != nil {
+		jr.Error = r.Err.Error()
+		jr.ErrorClass = r.ErrClass
+		jr.TimeoutLimit = r.TimeoutLimit
+	}
+	if r.Purged {
+		jr.PurgeStatus = r.PurgeStatus
+		jr.PurgeTimeMs = durationMs(r.PurgeTime)
+		if r.PurgeErr != nil {
+			jr.PurgeError = r.PurgeErr.Error()
+		}
+	}
+	return jr
+}
+
+func (jr jsonResult) result() Result {
+	r := Result{
+		Site:           jr.Site,
+		URL:            jr.URL,
+		Referrer:       jr.Referrer,
+		StatusCode:     jr.StatusCode,
+		Status:         jr.Status,
+		ResponseTime:   time.Duration(jr.ResponseTimeMs * float64(time.Millisecond)),
+		Size:           jr.Size,
+		ETag:           jr.ETag,
+		LastModified:   jr.LastModified,
+		ContentType:    jr.ContentType,
+		Protocol:       jr.Protocol,
+		HTTP3Fallback:  jr.HTTP3Fallback,
+		Alternate:      jr.Alternate,
+		Asset:          jr.Asset,
+		API:            jr.API,
+		Fresh:          jr.Fresh,
+		FinalURL:       jr.FinalURL,
+		RedirectStatus: jr.RedirectStatus,
+		MetaRefresh:    jr.MetaRefresh,
+		BodyHash:       jr.BodyHash,
+		Uncompressed:   jr.Uncompressed,
+		GzipEstimate:   jr.GzipEstimate,
+		OffHost:        jr.OffHost,
+		NoIndex:        jr.NoIndex,
+		Slow:           jr.Slow,
+		Oversize:       jr.Oversize,
+
+		HeaderViolations: jr.HeaderViolations,
+		RequiredHeaders:  jr.RequiredHeaders,
+		Assertions:       jr.Assertions,
+		CapturedHeaders:  jr.CapturedHeaders,
+		MixedContent:     jr.MixedContent,
+		Soft404:          jr.Soft404,
+		SEO:              jr.SEO,
+		Variants:         jr.Variants,
+
+		SecondResponseTime: time.Duration(jr.SecondResponseTimeMs * float64(time.Millisecond)),
+		Speedup:            jr.Speedup,
+		Attempts:           max(jr.Attempts, 1),
+		RetryPolicy:        jr.RetryPolicy,
+		Timings:            jr.Timings.timings(),
+	}
+	for _, ja := range jr.History {
+		a := Attempt{StatusCode: ja.StatusCode, Duration: time.Duration(ja.DurationMs * float64(time.Millisecond))}
+		if ja.Error != "" {
+			a.Err = errors.New(ja.Error)
+		}
+		r.History = append(r.History, a)
+	}
+	r.FetchedAt, _ = time.Parse(time.RFC3339Nano, jr.FetchedAt)
+	ms := func(v float64) time.Duration { return time.Duration(v * float64(time.Millisecond)) }
+	if jl := jr.Load; jl != nil {
+		r.Load = &urlLoad{Requests: jl.Requests, Errors: jl.Errors, p50: ms(jl.P50Ms), p95: ms(jl.P95Ms), p99: ms(jl.P99Ms)}
+	}
+	if jt := jr.Repeat; jt != nil {
+		r.Repeat = &repeatTimings{
+			Count:  jt.Count,
+			Errors: jt.Errors,
+			Min:    ms(jt.MinMs),
+			Mean:   ms(jt.MeanMs),
+			Max:    ms(jt.MaxMs),
+			StdDev: ms(jt.StdDevMs),
+		}
+	}
+	if jr.Error != "" {
+		r.Err = errors.New(jr.Error)
+		r.ErrClass = jr.ErrorClass
+		r.TimeoutLimit = jr.TimeoutLimit
+	}
+	if jr.PurgeStatus != 0 || jr.PurgeError != "" {
+		r.Purged = true
+		r.PurgeStatus = jr.PurgeStatus
+		r.PurgeTime = time.Duration(jr.PurgeTimeMs * float64(time.Millisecond))
+		if jr.PurgeError != "" {
+			r.PurgeErr = errors.New(jr.PurgeError)
+		}
+	}
+	return r
+}
+
+type jsonSummary struct {
+	RunID        string         `json:"run_id,omitempty"`
+	StartedAt    string         `json:"started_at,omitempty"`
+	FinishedAt   string         `json:"finished_at,omitempty"`
+	Site         string         `json:"site,omitempty"`
+	CrawlTimeMs  float64        `json:"crawl_time_ms"`
+	TotalPages   int            `json:"total_pages"`
+	Fresh        int            `json:"skipped_fresh,omitempty"`
+	States       map[string]int `json:"states"`
+	Errors       int            `json:"errors"`
+	Unsuccessful int            `json:"unsuccessful,omitempty"`
+	StatusCount  map[string]int `json:"status_count"`
+	ErrorCount   map[string]int `json:"error_count,omitempty"`
+	P50Ms        float64        `json:"p50_ms"`
+	P95Ms        float64        `json:"p95_ms"`
+	P99Ms        float64        `json:"p99_ms"`
+
+	LatencyAssertions []jsonLatencyCheck `json:"latency_assertions,omitempty"`
+	Approximate       bool               `json:"approximate_percentiles,omitempty"`
+
+	// ProtocolCount counts the responses by protocol with -http3.
+	ProtocolCount map[string]int `json:"protocol_count,omitempty"`
+
+	// Phases are the percentiles of the phases of the requests timed with
+	// -timings, and ReusedConnections the number of those requests that
+	// went over a connection already open.
+	Phases            map[string]jsonPhase `json:"phases,omitempty"`
+	ReusedConnections int                  `json:"reused_connections,omitempty"`
+
+	Order     string `json:"order,omitempty"`
+	StoppedBy string `json:"stopped_by,omitempty"`
+	NotWarmed int    `json:"not_warmed,omitempty"`
+
+	// AuthFailures counts the 401 and 403 responses, and AuthAborted is
+	// set if -abort-on-auth-failure stopped the run.
+	AuthFailures int  `json:"auth_failures,omitempty"`
+	AuthAborted  bool `json:"auth_aborted,omitempty"`
+
+	BudgetBytes     int64 `json:"budget_bytes,omitempty"`
+	DownloadedBytes int64 `json:"downloaded_bytes,omitempty"`
+
+	// Proxies are the requests and errors of every proxy of -proxy and
+	// -proxy-file.
+	Proxies []proxyStat `json:"proxies,omitempty"`
+
+	// TrapsThrottled are the patterns -trap-detection stopped following
+	// links to.
+	TrapsThrottled []trapThrottle `json:"traps_throttled,omitempty"`
+
+	OffHostRedirects int `json:"off_host_redirects,omitempty"`
+	NoIndex          int `json:"noindex,omitempty"`
+	SlowPages        int `json:"slow_pages,omitempty"`
+
+	RedirectedLinks []jsonRedirectedLink `json:"redirected_links,omitempty"`
+
+	ExternalChecked int                `json:"external_links_checked,omitempty"`
+	BrokenExternal  []jsonExternalLink `json:"broken_external_links,omitempty"`
+
+	Duplicates []jsonDuplicateGroup `json:"duplicates,omitempty"`
+
+	// ChangedURLs, NewURLs and RemovedURLs are the content changes since
+	// the previous run with -detect-changes.
+	ChangedURLs []string `json:"changed_urls,omitempty"`
+	NewURLs     []string `json:"new_urls,omitempty"`
+	RemovedURLs []string `json:"removed_urls,omitempty"`
+
+	// Regressions are the URLs slower than their -baseline, and
+	// BaselineNewURLs those it doesn't have.
+	Regressions     []jsonRegression `json:"regressions,omitempty"`
+	BaselineNewURLs []string         `json:"baseline_new_urls,omitempty"`
+
+	OrphanPages   []string `json:"orphan_pages,omitempty"`
+	UnlistedPages []string `json:"unlisted_pages,omitempty"`
+
+	OversizedPages   int `json:"oversized_pages,omitempty"`
+	HeaderViolations int `json:"header_violations,omitempty"`
+	// AssertionFailures counts the pages failing a content assertion, and
+	// AssertionsNotEvaluated those it couldn't be checked on.
+	AssertionFailures      int `json:"assertion_failures,omitempty"`
+	AssertionsNotEvaluated int `json:"assertions_not_evaluated,omitempty"`
+	MixedContent           int `json:"mixed_content_pages,omitempty"`
+	Soft404                int `json:"soft_404,omitempty"`
+	SEOIssues              int `json:"seo_issues,omitempty"`
+
+	Uncompressed     int   `json:"uncompressed,omitempty"`
+	CompressionWaste int64 `json:"compression_waste_bytes,omitempty"`
+
+	TooManyRequests  int `json:"too_many_requests,omitempty"`
+	Retries          int `json:"retries,omitempty"`
+	RecoveredOnRetry int `json:"recovered_on_retry,omitempty"`
+
+	HostPeaks []hostPeak `json:"peak_concurrency_per_host,omitempty"`
+
+	FailedSitemaps []sitemapFailure `json:"failed_sitemaps,omitempty"`
+	RedirectLoops  []redirectLoop   `json:"redirect_loops,omitempty"`
+
+	Purged        int     `json:"purged,omitempty"`
+	PurgeFailures int     `json:"purge_failures,omitempty"`
+	PurgeAvgMs    float64 `json:"purge_avg_ms,omitempty"`
+
+	Verification *jsonVerification `json:"verification,omitempty"`
+
+	AvgBytesPerSec  float64 `json:"avg_bytes_per_sec"`
+	PeakBytesPerSec int64   `json:"peak_bytes_per_sec"`
+
+	VariantRequests int `json:"variant_requests,omitempty"`
+
+	// RepeatRequests counts the requests made to fetch URLs again with
+	// -repeat, and TotalRequests the page requests including them.
+	RepeatRequests int `json:"repeat_requests,omitempty"`
+	TotalRequests  int `json:"total_requests,omitempty"`
+
+	// LoadURLs and LoadRequests are the URLs requested in a -duration run
+	// and the requests made for them, at AchievedRPS.
+	LoadURLs     int     `json:"load_urls,omitempty"`
+	LoadRequests int     `json:"load_requests,omitempty"`
+	AchievedRPS  float64 `json:"achieved_rps,omitempty"`
+	RequestedRPS float64 `json:"requested_rps,omitempty"`
+
+	SpeedupURLs int     `json:"speedup_urls,omitempty"`
+	AvgSpeedup  float64 `json:"avg_speedup,omitempty"`
+	NoSpeedup   int     `json:"no_speedup,omitempty"`
+
+	LinksDiscovered int `json:"links_discovered,omitempty"`
+	LinksSampledOut int `json:"links_sampled_out,omitempty"`
+
+	// ConcurrencyPeak and ConcurrencyAverage are the requests in flight
+	// allowed with -c auto.
+	ConcurrencyPeak    int     `json:"concurrency_peak,omitempty"`
+	ConcurrencyAverage float64 `json:"concurrency_average,omitempty"`
+
+	SavedFiles int   `json:"saved_files,omitempty"`
+	SavedBytes int64 `json:"saved_bytes,omitempty"`
+
+	WARCResponses int `json:"warc_responses,omitempty"`
+
+	ConditionalRequests int `json:"conditional_requests,omitempty"`
+
+	AlternatePages int `json:"alternate_pages,omitempty"`
+	AMPPages       int `json:"amp_pages,omitempty"`
+
+	SitemapAssets        int `json:"sitemap_assets,omitempty"`
+	SitemapAssetFailures int `json:"sitemap_asset_failures,omitempty"`
+
+	// APIRequests counts the requests for the operations of the -openapi
+	// spec, which TotalPages includes, and APIFailures those that failed.
+	// OpenAPISkipped are the operations skipped for lack of parameter
+	// values.
+	APIRequests    int              `json:"api_requests,omitempty"`
+	APIFailures    int              `json:"api_failures,omitempty"`
+	OpenAPISkipped []openAPISkipped `json:"openapi_skipped,omitempty"`
+
+	// WeightTotal is the total weight of the URLs of a -weighted-file and
+	// WeightWarmed that of those warmed successfully.
+	WeightTotal  float64 `json:"weight_total,omitempty"`
+	WeightWarmed float64 `json:"weight_warmed,omitempty"`
+
+	BreakerTrips  int     `json:"breaker_trips,omitempty"`
+	BreakerOpenMs float64 `json:"breaker_open_ms,omitempty"`
+
+	SitemapAvailable int   `json:"sitemap_urls_available,omitempty"`
+	SitemapSelected  int   `json:"sitemap_urls_selected,omitempty"`
+	Seed             int64 `json:"seed,omitempty"`
+
+	Shard          string `json:"shard,omitempty"`
+	ShardURLs      int    `json:"shard_urls,omitempty"`
+	OtherShardURLs int    `json:"other_shard_urls,omitempty"`
+}
+
+type jsonVerification struct {
+	Header     string   `json:"header,omitempty"`
+	Checked    int      `json:"checked"`
+	Hits       int      `json:"hits"`
+	HitRatio   float64  `json:"hit_ratio"`
+	Failed     int      `json:"failed,omitempty"`
+	Misses     []string `json:"misses,omitempty"`
+	AvgSpeedup float64  `json:"avg_speedup"`
+}
+
+func (c *Crawler) jsonSummary(crawlTime time.Duration) jsonSummary {
+	s := jsonSummary{
+		RunID:        c.runID,
+		Site:         c.Name,
+		CrawlTimeMs:  durationMs(crawlTime),
+		TotalPages:   c.stats.pages,
+		Fresh:        c.stats.fresh,
+		States:       c.stateCounts(),
+		Errors:       c.stats.errors,
+		Unsuccessful: c.unsuccessful(),
+		StatusCount:  make(map[string]int),
+		P50Ms:        durationMs(c.stats.latency.quantile(0.50)),
+		P95Ms:        durationMs(c.stats.latency.quantile(0.95)),
+		P99Ms:        durationMs(c.stats.latency.quantile(0.99)),
+		Approximate:  c.stats.latency.approximate(),
+		Phases:       c.stats.jsonPhases(),
+	}
+	s.ReusedConnections = c.stats.reusedConns
+	for status, count := range c.stats.statusCount {
+		s.StatusCount[strconv.Itoa(status)] = count
+	}
+	for _, check := range c.checkLatency() {
+		s.LatencyAssertions = append(s.LatencyAssertions, jsonLatencyCheck{
+			Name:       check.Name,
+			LimitMs:    durationMs(check.Limit),
+			MeasuredMs: durationMs(check.Measured),
+			Passed:     check.Passed,
+		})
+	}
+	if len(c.stats.errorClass) > 0 {
+		s.ErrorCount = maps.Clone(c.stats.errorClass)
+	}
+	if len(c.stats.protocols) > 0 {
+		s.ProtocolCount = maps.Clone(c.stats.protocols)
+	}
+	c.lock.Lock()
+	s.Order, s.StoppedBy, s.NotWarmed = c.Order, c.stoppedBy, c.notWarmed
+	s.AuthFailures = c.stats.statusCount[http.StatusUnauthorized] + c.stats.statusCount[http.StatusForbidden]
+	s.AuthAborted = c.authAborted
+	s.StartedAt, s.FinishedAt = formatTime(c.started), formatTime(c.finished)
+	if b := c.budget; b != nil {
+		s.BudgetBytes, s.DownloadedBytes = b.limit, b.used.Load()
+	}
+	s.Proxies = c.proxies.stats()
+	s.TrapsThrottled = c.traps.list()
+	s.FailedSitemaps, s.RedirectLoops = c.failedSitemaps, c.redirectLoops
+	if c.sampling() || c.sitemapAvailable > 0 {
+		s.SitemapAvailable, s.SitemapSelected = c.sitemapAvailable, c.sitemapSelected
+	}
+	s.LinksDiscovered, s.LinksSampledOut = c.linksDiscovered, c.sampledOut
+	s.ConcurrencyPeak, s.ConcurrencyAverage = c.concurrencyPeak, c.concurrencyAverage
+	s.BreakerTrips, s.BreakerOpenMs = c.breakerTrips, durationMs(c.breakerOpen)
+	s.SavedFiles, s.SavedBytes = c.savedFiles, c.savedBytes
+	s.WARCResponses = c.warcResponses
+	s.ConditionalRequests = c.conditionalRequests
+	s.AlternatePages, s.AMPPages = c.stats.alternates, c.stats.amp
+	s.SitemapAssets, s.SitemapAssetFailures = c.stats.assets, c.stats.assetFailures
+	s.APIRequests, s.APIFailures, s.OpenAPISkipped = c.stats.apis, c.stats.apiFailures, c.openAPISkipped
+	if tw := c.traffic; tw != nil {
+		s.WeightTotal, s.WeightWarmed = tw.total, tw.warmed
+	}
+	if ch := c.changes; ch != nil {
+		s.ChangedURLs, s.NewURLs, s.RemovedURLs = ch.changed, ch.added, ch.removed
+	}
+	if bc := c.regressions; bc != nil {
+		for _, r := range bc.regressed {
+			s.Regressions = append(s.Regressions, jsonRegression{URL: r.URL, BaselineMs: durationMs(r.Baseline), ResponseTimeMs: durationMs(r.Measured)})
+		}
+		s.BaselineNewURLs = bc.added
+	}
+	if c.sampling() || c.Shuffle || c.CrawlSample > 0 {
+		s.Seed = c.seed
+	}
+	c.lock.Unlock()
+	s.OffHostRedirects, s.NoIndex, s.SlowPages = c.stats.offHost, c.stats.noindex, c.stats.slow
+	s.HeaderViolations, s.MixedContent, s.Soft404 = c.stats.headerViolations, c.stats.mixedContent, c.stats.soft404
+	s.SEOIssues = c.stats.seoIssues
+	s.AssertionFailures, s.AssertionsNotEvaluated = c.stats.assertionFailures, c.stats.assertionsNotEvaluated
+	s.Uncompressed, s.CompressionWaste = c.stats.uncompressed, c.stats.compressionWaste
+	s.OversizedPages = c.oversizedCount()
+	s.OrphanPages, s.UnlistedPages = c.orphans()
+	s.ExternalChecked, _ = c.external.counts()
+	for _, g := range c.duplicates() {
+		jg := jsonDuplicateGroup{Hash: g.hash}
+		for _, r := range g.results {
+			jg.URLs = append(jg.URLs, r.URL)
+			jg.Sizes = append(jg.Sizes, r.Size)
+		}
+		s.Duplicates = append(s.Duplicates, jg)
+	}
+	for _, l := range c.external.brokenLinks() {
+		jl := jsonExternalLink{URL: l.URL, StatusCode: l.StatusCode, LinkedFrom: l.linkedFrom}
+		if l.Err != nil {
+			jl.Error = l.Err.Error()
+		}
+		s.BrokenExternal = append(s.BrokenExternal, jl)
+	}
+	for _, l := range c.redirectedLinks() {
+		s.RedirectedLinks = append(s.RedirectedLinks, jsonRedirectedLink{
+			URL:         l.URL,
+			FinalURL:    l.FinalURL,
+			Status:      l.RedirectStatus,
+			MetaRefresh: l.meta,
+			Links:       l.links,
+			LinkedFrom:  l.linkedFrom,
+		})
+	}
+	s.TooManyRequests, s.Retries, s.RecoveredOnRetry = c.stats.throttled, c.stats.retries, c.stats.recovered
+	if c.reportHostPeaks() {
+		s.HostPeaks = c.hosts.peaks()
+	}
+	if c.stats.purged > 0 {
+		s.Purged, s.PurgeFailures = c.stats.purged, c.stats.purgeFailures
+		s.PurgeAvgMs = durationMs(c.stats.purgeTime / time.Duration(c.stats.purged))
+	}
+	s.VariantRequests = c.stats.variantRequests
+	if s.LoadURLs, s.LoadRequests = c.loadTotals(); s.LoadRequests > 0 && crawlTime > 0 {
+		s.AchievedRPS, s.RequestedRPS = float64(s.LoadRequests)/crawlTime.Seconds(), c.Rate
+	}
+	if c.stats.repeatRequests > 0 {
+		s.RepeatRequests, s.TotalRequests = c.stats.repeatRequests, c.stats.pages+c.stats.repeatRequests
+	}
+	s.AvgBytesPerSec, s.PeakBytesPerSec = c.avgThroughput(crawlTime), c.throughput.peakRate()
+	if n := c.stats.speedups; n > 0 {
+		s.SpeedupURLs, s.AvgSpeedup, s.NoSpeedup = n, c.stats.speedupSum/float64(n), c.stats.noSpeedup
+	}
+	if v := c.verification; v != nil {
+		s.Verification = &jsonVerification{
+			Header:     v.header,
+			Checked:    v.checked,
+			Hits:       v.hits,
+			HitRatio:   v.hitRatio(),
+			Failed:     v.failed,
+			Misses:     v.misses,
+			AvgSpeedup: v.avgSpeedup(),
+		}
+	}
+	if c.shard.count > 0 {
+		s.Shard = c.shard.String()
+		s.ShardURLs, s.OtherShardURLs = c.shardCounts()
+	}
+	return s
+}
+
+// writeJSON writes the summary and every result as a single JSON document.
+// The roll-up of a multi-site run adds the summary of each site.
+func (c *Crawler) writeJSON(w io.Writer, crawlTime time.Duration) error {
+	doc := struct {
+		Summary jsonSummary   `json:"summary"`
+		Sites   []jsonSummary `json:"sites,omitempty"`
+		Results []jsonResult  `json:"results"`
+	}{
+		Summary: c.jsonSummary(crawlTime),
+		Sites:   c.siteSummaries(),
+		Results: make([]jsonResult, 0, len(c.results)),
+	}
+	// Sorted like the report, so identical runs produce identical
+	// documents.
+	for _, r := range c.sortedResults() {
+		doc.Results = append(doc.Results, newJSONResult(r))
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// ndjsonWriter streams one JSON object per result as results complete.
+type ndjsonWriter struct {
+	mu  sync.Mutex
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	buf := bufio.NewWriter(w)
+	return &ndjsonWriter{buf: buf, enc: json.NewEncoder(buf)}
+}
+
+func (nw *ndjsonWriter) write(r Result) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.enc.Encode(newJSONResult(r))
+}
+
+// summary writes a summary line, e.g. for a site that has finished.
+func (nw *ndjsonWriter) summary(summary jsonSummary) error {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	return nw.enc.Encode(struct {
+		Summary jsonSummary `json:"summary"`
+	}{summary})
+}
+
+// finish writes a final summary line and flushes the buffer.
+func (nw *ndjsonWriter) finish(summary jsonSummary) error {
+	if err := nw.summary(summary); err != nil {
+		return err
+	}
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	return nw.buf.Flush()
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// loadResults reads results saved with -output json or ndjson into a crawler
+// so they can be rendered again. Results of a multi-site run are grouped
+// into per-site crawlers as well.
+func loadResults(path string) (*Crawler, time.Duration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	c, err := NewCrawler(defaultConfig())
+	if err != nil {
+		return nil, 0, err
+	}
+	// The run ID comes from the summary, if the results have one.
+	c.runID = ""
+	var crawlTime time.Duration
+
+	sites := make(map[string]*Crawler)
+	site := func(name string) *Crawler {
+		if s, ok := sites[name]; ok {
+			return s
+		}
+		cfg := defaultConfig()
+		cfg.Name = name
+		s, _ := NewCrawler(cfg)
+		s.runID = ""
+		sites[name] = s
+		c.sites = append(c.sites, s)
+		return s
+	}
+	add := func(jr jsonResult) {
+		r := jr.result()
+		c.results[resultKey(r)] = r
+		c.stats.add(r)
+		if r.Site != "" {
+			s := site(r.Site)
+			s.results[resultKey(r)] = r
+			s.stats.add(r)
+		}
+	}
+	// The summary holds what the results alone don't tell.
+	setSummary := func(summary jsonSummary) {
+		d := time.Duration(summary.CrawlTimeMs * float64(time.Millisecond))
+		s := c
+		if summary.Site != "" {
+			s = site(summary.Site)
+			s.elapsed = d
+		} else {
+			crawlTime = d
+		}
+		s.stats.throttled, s.stats.retries = summary.TooManyRequests, summary.Retries
+		s.failedSitemaps, s.redirectLoops = summary.FailedSitemaps, summary.RedirectLoops
+		s.openAPISkipped = summary.OpenAPISkipped
+		s.runID = summary.RunID
+		s.linksDiscovered, s.sampledOut = summary.LinksDiscovered, summary.LinksSampledOut
+		s.concurrencyPeak, s.concurrencyAverage = summary.ConcurrencyPeak, summary.ConcurrencyAverage
+		s.savedFiles, s.savedBytes = summary.SavedFiles, summary.SavedBytes
+		s.warcResponses = summary.WARCResponses
+		s.conditionalRequests = summary.ConditionalRequests
+		s.authAborted = summary.AuthAborted
+		if len(summary.Proxies) > 0 {
+			s.proxies = &proxyPool{loaded: summary.Proxies}
+		}
+		s.traps = loadedTraps(summary.TrapsThrottled)
+		if summary.WeightTotal > 0 {
+			s.traffic = &trafficWeights{total: summary.WeightTotal, warmed: summary.WeightWarmed}
+		}
+		if len(summary.ChangedURLs)+len(summary.NewURLs)+len(summary.RemovedURLs) > 0 {
+			s.changes = &contentChanges{changed: summary.ChangedURLs, added: summary.NewURLs, removed: summary.RemovedURLs}
+		}
+		if len(summary.Regressions)+len(summary.BaselineNewURLs) > 0 {
+			s.regressions = &baselineComparison{added: summary.BaselineNewURLs}
+			for _, r := range summary.Regressions {
+				s.regressions.regressed = append(s.regressions.regressed, regression{
+					URL:      r.URL,
+					Baseline: time.Duration(r.BaselineMs * float64(time.Millisecond)),
+					Measured: time.Duration(r.ResponseTimeMs * float64(time.Millisecond)),
+				})
+			}
+		}
+		s.breakerTrips, s.breakerOpen = summary.BreakerTrips, time.Duration(summary.BreakerOpenMs*float64(time.Millisecond))
+		s.started, _ = time.Parse(time.RFC3339Nano, summary.StartedAt)
+		s.finished, _ = time.Parse(time.RFC3339Nano, summary.FinishedAt)
+		s.sitemapAvailable, s.sitemapSelected, s.seed = summary.SitemapAvailable, summary.SitemapSelected, summary.Seed
+		s.throughput.peak = summary.PeakBytesPerSec
+	}
+
+	// A json document is a single object with a results list; ndjson is a
+	// stream of result objects followed by a summary object.
+	dec := json.NewDecoder(f)
+	for {
+		var record struct {
+			jsonResult
+			Summary *jsonSummary  `json:"summary"`
+			Sites   []jsonSummary `json:"sites"`
+			Results []jsonResult  `json:"results"`
+		}
+		if err := dec.Decode(&record); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", path, err)
+		}
+
+		for _, jr := range record.Results {
+			add(jr)
+		}
+		for _, summary := range record.Sites {
+			setSummary(summary)
+		}
+		if record.Summary != nil {
+			setSummary(*record.Summary)
+		} else if record.URL != "" {
+			add(record.jsonResult)
+		}
+	}
+	return c, crawlTime, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Statistical page size outliers are only looked for among at least
+// minOutlierSample pages, and are pages more than outlierStdDevs standard
+// deviations above the mean size or outlierMedianFactor times the median.
+const (
+	minOutlierSample    = 10
+	outlierStdDevs      = 3
+	outlierMedianFactor = 4
+)
+
+// oversizedPage is a page flagged for its size, and why.
+type oversizedPage struct {
+	Result
+	reason string
+}
+
+// oversized returns the pages larger than MaxPageSize or whose size is an
+// outlier among the successful pages, largest first. The outliers can only be
+// computed with every result in memory, i.e. without -low-memory.
+func (c *Crawler) oversized() []oversizedPage {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var sizes []int64
+	for _, r := range c.results {
+		if r.Err == nil && !r.Fresh {
+			sizes = append(sizes, r.Size)
+		}
+	}
+	var median, mean, stddev float64
+	outliers := len(sizes) >= minOutlierSample
+	if outliers {
+		sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+		median = float64(sizes[len(sizes)/2])
+		for _, s := range sizes {
+			mean += float64(s)
+		}
+		mean /= float64(len(sizes))
+		for _, s := range sizes {
+			stddev += (float64(s) - mean) * (float64(s) - mean)
+		}
+		stddev = math.Sqrt(stddev / float64(len(sizes)))
+	}
+
+	limit := "over -max-page-size"
+	if c.MaxPageSize > 0 {
+		limit = "over " + formatSize(c.MaxPageSize)
+	}
+	var res []oversizedPage
+	for _, r := range c.results {
+		if r.Err != nil || r.Fresh {
+			continue
+		}
+		size := float64(r.Size)
+		switch {
+		case r.Oversize:
+			res = append(res, oversizedPage{r, limit})
+		case outliers && median > 0 && size > outlierMedianFactor*median:
+			res = append(res, oversizedPage{r, fmt.Sprintf("%.1fx the median", size/median)})
+		case outliers && stddev > 0 && size > mean+outlierStdDevs*stddev:
+			res = append(res, oversizedPage{r, fmt.Sprintf("%.1f standard deviations above the mean", (size-mean)/stddev)})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Size != res[j].Size {
+			return res[i].Size > res[j].Size
+		}
+		return resultKey(res[i].Result) < resultKey(res[j].Result)
+	})
+	return res
+}
+
+// oversizedCount returns the number of pages flagged for their size. With
+// -low-memory only those over MaxPageSize are counted.
+func (c *Crawler) oversizedCount() int {
+	if c.results == nil {
+		return c.stats.oversize
+	}
+	return len(c.oversized())
+}
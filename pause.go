@@ -0,0 +1,114 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// pause stops handing out URLs to the workers. Requests already in flight
+// finish normally and the workers then wait without holding anything.
+func (c *Crawler) pause() {
+	c.lock.Lock()
+	wasPaused := !c.pausedAt.IsZero()
+	if !wasPaused {
+		c.pausedAt = time.Now()
+		c.frontier.setPaused(true)
+	}
+	c.lock.Unlock()
+
+	if !wasPaused {
+		slog.Info("paused", c.logArgs("in_flight", c.inFlight.Load(), "queued", c.frontier.len())...)
+	}
+}
+
+// resume undoes pause.
+func (c *Crawler) resume() {
+	c.lock.Lock()
+	wasPaused := !c.pausedAt.IsZero()
+	if wasPaused {
+		c.pausedFor += time.Since(c.pausedAt)
+		c.pausedAt = time.Time{}
+		c.frontier.setPaused(false)
+	}
+	c.lock.Unlock()
+
+	if wasPaused {
+		slog.Info("resumed", c.logArgs("queued", c.frontier.len())...)
+	}
+}
+
+// stop stops handing out URLs for good, as a limit would: requests in flight
+// finish and the remaining URLs are counted as not warmed.
+func (c *Crawler) stop() {
+	c.quit.Store(true)
+	c.breaker.stop()
+	c.resume()
+}
+
+// skipHost drops the queued URLs of host and doesn't queue any more of them,
+// returning how many were dropped.
+func (c *Crawler) skipHost(host string) int {
+	c.lock.Lock()
+	if c.skippedHosts == nil {
+		c.skippedHosts = make(map[string]int)
+	}
+	if _, ok := c.skippedHosts[host]; !ok {
+		c.skippedHosts[host] = 0
+	}
+	c.lock.Unlock()
+
+	removed := c.frontier.remove(func(t task) bool { return taskHost(t) == host })
+	c.lock.Lock()
+	c.skippedHosts[host] += len(removed)
+	c.lock.Unlock()
+	for range removed {
+		c.wg.Done()
+	}
+	slog.Info("skipping host", c.logArgs("host", host, "dropped", len(removed))...)
+	return len(removed)
+}
+
+// dropIfSkipped reports whether t is on a host skipped since it was queued,
+// counting it among the host's dropped URLs if so. skipHost only drops the
+// URLs in the frontier, not those parked by the host limiter.
+func (c *Crawler) dropIfSkipped(t task) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.hostSkipped(t.url) {
+		return false
+	}
+	c.skippedHosts[taskHost(t)]++
+	return true
+}
+
+// hostSkipped reports whether u is on a host skipped with skipHost. It is
+// called with c.lock held.
+func (c *Crawler) hostSkipped(u string) bool {
+	if len(c.skippedHosts) == 0 {
+		return false
+	}
+	_, skipped := c.skippedHosts[taskHost(task{url: u})]
+	return skipped
+}
+
+func (c *Crawler) isPaused() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return !c.pausedAt.IsZero()
+}
+
+// activeTime returns how long the crawl has been running at now, not
+// counting the time spent paused. Deadlines and intervals are measured in
+// active time so they don't run out while the crawl is paused.
+func (c *Crawler) activeTime(now time.Time) time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.started.IsZero() {
+		return 0
+	}
+	d := now.Sub(c.started) - c.pausedFor
+	if !c.pausedAt.IsZero() {
+		d -= now.Sub(c.pausedAt)
+	}
+	return d
+}
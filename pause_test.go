@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPauseStopsFetchingUntilResumed(t *testing.T) {
+	const pages = 40
+	var hits hitCounter
+	srv := linkSite(t, pages, 2, &hits)
+	fetched := func() int {
+		n := hits.get("/")
+		for i := 0; i < pages; i++ {
+			n += hits.get(fmt.Sprintf("/%d", i))
+		}
+		return n
+	}
+
+	c := newTestCrawler(t, func(cfg *Config) {
+		cfg.StartURL = srv.URL + "/"
+		cfg.MaxConcurrency = 2
+	})
+	var once sync.Once
+	c.OnResult = func(Result) {
+		once.Do(c.pause)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Run()
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !c.isPaused() {
+		if time.Now().After(deadline) {
+			t.Fatal("crawl not paused after its first result")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Let the requests in flight when it paused finish.
+	time.Sleep(100 * time.Millisecond)
+	before, activeBefore := fetched(), c.activeTime(time.Now())
+	const pausedFor = 300 * time.Millisecond
+	time.Sleep(pausedFor)
+	if after := fetched(); after != before {
+		t.Errorf("%d requests made while paused", after-before)
+	}
+	if active := c.activeTime(time.Now()); active-activeBefore > pausedFor/3 {
+		t.Errorf("active time went from %v to %v while paused", activeBefore, active)
+	}
+	select {
+	case <-done:
+		t.Fatal("crawl finished while paused")
+	default:
+	}
+
+	c.resume()
+	if c.isPaused() {
+		t.Error("still paused after resume")
+	}
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("crawl didn't finish after resume")
+	}
+	if c.stats.pages != pages+1 {
+		t.Errorf("%d pages crawled, want %d", c.stats.pages, pages+1)
+	}
+	if c.pausedFor < pausedFor {
+		t.Errorf("paused for %v, want at least %v", c.pausedFor, pausedFor)
+	}
+}
+
+func TestPauseAndResumeAreIdempotent(t *testing.T) {
+	c := newTestCrawler(t, func(cfg *Config) {
+		cfg.StartURL = "http://example.com/"
+	})
+	c.resume()
+	if c.isPaused() {
+		t.Error("paused by resume")
+	}
+	c.pause()
+	at := c.pausedAt
+	c.pause()
+	if c.pausedAt != at {
+		t.Error("a second pause moved the time the crawl was paused at")
+	}
+	c.resume()
+	c.resume()
+	if c.isPaused() {
+		t.Error("still paused after resume")
+	}
+}
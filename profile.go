@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"sync"
+	"time"
+)
+
+// profiler serves net/http/pprof with -pprof and writes the CPU and heap
+// profiles of -cpuprofile and -memprofile. It only observes the run.
+type profiler struct {
+	cpuFile string
+	memFile string
+
+	srv  *http.Server
+	cpu  *os.File
+	once sync.Once
+}
+
+// startProfiling starts what cfg asks for, or returns nil if it asks for
+// nothing.
+func startProfiling(cfg Config) (*profiler, error) {
+	if cfg.PProf == "" && cfg.CPUProfile == "" && cfg.MemProfile == "" {
+		return nil, nil
+	}
+	p := &profiler{cpuFile: cfg.CPUProfile, memFile: cfg.MemProfile}
+	if cfg.CPUProfile != "" {
+		f, err := os.Create(cfg.CPUProfile)
+		if err != nil {
+			return nil, err
+		}
+		if err := runtimepprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		p.cpu = f
+	}
+	if cfg.PProf != "" {
+		ln, err := net.Listen("tcp", cfg.PProf)
+		if err != nil {
+			p.stop()
+			return nil, err
+		}
+		// The handlers go on a mux of their own rather than the default
+		// one net/http/pprof registers them on.
+		mux := http.NewServeMux()
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		p.srv = &http.Server{Handler: mux}
+		go func() {
+			if err := p.srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+				slog.Error("pprof server failed", "error", err)
+			}
+		}()
+		slog.Info("serving pprof", "addr", ln.Addr().String())
+	}
+	return p, nil
+}
+
+// stop stops the pprof server and writes the profiles. Only the first call
+// does anything, so it can be called both on the way out and from a signal
+// handler.
+func (p *profiler) stop() {
+	if p == nil {
+		return
+	}
+	p.once.Do(func() {
+		if p.srv != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			p.srv.Shutdown(ctx)
+			cancel()
+		}
+		if p.cpu != nil {
+			runtimepprof.StopCPUProfile()
+			if err := p.cpu.Close(); err != nil {
+				slog.Error("writing the CPU profile failed", "path", p.cpuFile, "error", err)
+			}
+		}
+		if p.memFile != "" {
+			if err := writeHeapProfile(p.memFile); err != nil {
+				slog.Error("writing the heap profile failed", "path", p.memFile, "error", err)
+			}
+		}
+	})
+}
+
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	// A collection first, so the profile shows what is still in use.
+	runtime.GC()
+	if err := runtimepprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
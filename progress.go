@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// progress periodically reports how far along a crawl is. On a terminal it
+// redraws a single status line, otherwise it logs a status line every
+// progressLogInterval. With events set it writes a progressEvent to w
+// instead.
+type progress struct {
+	m        monitor
+	w        io.Writer
+	tty      bool
+	events   bool
+	interval time.Duration
+	start    time.Time
+
+	mu sync.Mutex
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+const (
+	progressInterval    = time.Second
+	progressLogInterval = 10 * time.Second
+)
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// progressEvent is the JSON progress event written with -progress-json.
+// Total is only known when the URLs come from a sitemap or list.
+type progressEvent struct {
+	Fetched   int     `json:"fetched"`
+	Queued    int     `json:"queued"`
+	Errors    int     `json:"errors"`
+	RPS       float64 `json:"rps"`
+	ElapsedMS int64   `json:"elapsed_ms"`
+	Total     int     `json:"total,omitempty"`
+	Paused    bool    `json:"paused,omitempty"`
+
+	// Concurrency is the current limit of requests in flight with -c auto.
+	Concurrency int `json:"concurrency,omitempty"`
+}
+
+// newProgress returns a progress updated every interval, or at the default
+// interval if it is 0.
+func newProgress(m monitor, w io.Writer, tty bool, interval time.Duration) *progress {
+	now := time.Now()
+	return &progress{
+		m:        m,
+		w:        w,
+		tty:      tty,
+		interval: interval,
+		start:    now,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// run draws the progress until finish is called.
+func (p *progress) run() {
+	defer close(p.done)
+
+	interval := p.interval
+	if interval <= 0 {
+		interval = progressInterval
+		if !p.tty && !p.events {
+			interval = progressLogInterval
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.draw()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// finish stops the updates and clears the status line so it doesn't end up
+// mixed into the report. Events end with one for the finished run.
+func (p *progress) finish() {
+	close(p.stop)
+	<-p.done
+	if p.events {
+		p.draw()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tty {
+		fmt.Fprint(p.w, "\r\033[K")
+	}
+}
+
+func (p *progress) draw() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	done, errors, queued, total := p.m.counts()
+	paused := p.m.isPaused()
+	concurrency := p.m.concurrency()
+
+	rate := p.m.requestRate(now, p.start)
+
+	elapsed := now.Sub(p.start).Round(time.Second)
+	summary := progressSummary(done, queued, total, rate)
+
+	if p.events {
+		e := progressEvent{
+			Fetched:   done,
+			Queued:    queued,
+			Errors:    errors,
+			RPS:       math.Round(rate*10) / 10,
+			ElapsedMS: now.Sub(p.start).Milliseconds(),
+			Total:     total,
+			Paused:    paused,
+
+			Concurrency: concurrency,
+		}
+		b, _ := json.Marshal(e)
+		p.w.Write(append(b, '\n'))
+		return
+	}
+
+	if !p.tty {
+		args := []any{"progress", summary, "fetched", done, "queued", queued, "errors", errors, "rps", rate, "elapsed", elapsed}
+		if total > 0 {
+			args = append(args, "total", total)
+			if eta := remaining(done, total, rate); eta > 0 {
+				args = append(args, "eta", eta)
+			}
+		}
+		if concurrency > 0 {
+			args = append(args, "concurrency", concurrency)
+		}
+		if paused {
+			args = append(args, "paused", true)
+		}
+		slog.Info("progress", args...)
+		return
+	}
+
+	line := fmt.Sprintf("%s | Errors %d | %.1f req/s | Elapsed %v", summary, errors, rate, elapsed)
+	if concurrency > 0 {
+		line += fmt.Sprintf(" | Concurrency %d", concurrency)
+	}
+	if paused {
+		line = "PAUSED | " + line
+	}
+	fmt.Fprintf(p.w, "\r\033[K%s", line)
+}
+
+// progressSummary describes how far along a run is: the share of the total
+// and the time left if the total is known, or else the URLs fetched and the
+// ones queued so far, as the total still grows.
+func progressSummary(done, queued, total int, rate float64) string {
+	if total <= 0 {
+		return fmt.Sprintf("%s fetched / %s queued", formatCount(done), formatCount(queued))
+	}
+	s := fmt.Sprintf("%s / %s (%d%%)", formatCount(done), formatCount(total), done*100/total)
+	if eta := remaining(done, total, rate); eta > 0 {
+		s += " — ETA " + formatETA(eta)
+	}
+	return s
+}
+
+// remaining estimates the time left to fetch the rest of total URLs at
+// rate, which is measured over a sliding window so a burst at the start
+// doesn't keep the estimate optimistic. It returns 0 if there is no rate
+// to go by yet.
+func remaining(done, total int, rate float64) time.Duration {
+	if rate <= 0 || done >= total {
+		return 0
+	}
+	return time.Duration(float64(total-done) / rate * float64(time.Second)).Round(time.Second)
+}
+
+// formatCount formats n with thousands separators, e.g. 20,000.
+func formatCount(n int) string {
+	if n < 0 {
+		return "-" + formatCount(-n)
+	}
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// formatETA formats d as hours, minutes and seconds, e.g. 6m 40s.
+func formatETA(d time.Duration) string {
+	h, m, s := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+	switch {
+	case h > 0:
+		return fmt.Sprintf("%dh %dm", h, m)
+	case m > 0:
+		return fmt.Sprintf("%dm %ds", m, s)
+	}
+	return fmt.Sprintf("%ds", s)
+}
+
+// Write lets log output share the terminal with the status line: the line
+// is cleared before the log message and redrawn on the next tick.
+func (p *progress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tty {
+		fmt.Fprint(p.w, "\r\033[K")
+	}
+	return p.w.Write(b)
+}
+
+// lineWriter owns a stream written to by several parties, like the progress
+// events and the logs: a single goroutine writes everything sent to it, in
+// the order sent, so lines never interleave.
+type lineWriter struct {
+	w     io.Writer
+	lines chan []byte
+	done  chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newLineWriter(w io.Writer) *lineWriter {
+	lw := &lineWriter{w: w, lines: make(chan []byte, 64), done: make(chan struct{})}
+	go func() {
+		defer close(lw.done)
+		for b := range lw.lines {
+			lw.w.Write(b)
+		}
+	}()
+	return lw
+}
+
+func (lw *lineWriter) Write(b []byte) (int, error) {
+	lw.mu.RLock()
+	defer lw.mu.RUnlock()
+	if lw.closed {
+		return lw.w.Write(b)
+	}
+	lw.lines <- bytes.Clone(b)
+	return len(b), nil
+}
+
+// close writes what is left and stops the goroutine; later writes go to the
+// stream directly.
+func (lw *lineWriter) close() {
+	lw.mu.Lock()
+	lw.closed = true
+	close(lw.lines)
+	lw.mu.Unlock()
+	<-lw.done
+}
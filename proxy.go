@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Rotations accepted by -proxy-rotation.
+const (
+	rotationRoundRobin = "round-robin"
+	rotationRandom     = "random"
+)
+
+// proxyBenchAfter is the number of failures in a row after which a proxy
+// is benched for proxyBenchFor, so that a dead proxy doesn't keep failing
+// a share of the requests.
+const (
+	proxyBenchAfter = 3
+	proxyBenchFor   = 30 * time.Second
+)
+
+// proxyEntry is a proxy of the pool with the requests sent through it.
+type proxyEntry struct {
+	url      *url.URL
+	requests atomic.Int64
+	errors   atomic.Int64
+
+	// failuresInRow and benchedUntil are guarded by the pool's lock.
+	// benched counts the times the proxy was benched.
+	failuresInRow int
+	benchedUntil  time.Time
+	benched       int
+}
+
+// proxyPool rotates the requests through the proxies of -proxy and
+// -proxy-file.
+type proxyPool struct {
+	proxies []*proxyEntry
+	random  bool
+	next    atomic.Uint64
+
+	mu sync.Mutex
+
+	// loaded is the breakdown of a run read back from its results.
+	loaded []proxyStat
+}
+
+// proxyKey is the context key of the proxy a request was given.
+type proxyKey struct{}
+
+// newProxyPool returns the pool of the proxy of -proxy and those listed in
+// -proxy-file, or nil if there are none.
+func newProxyPool(cfg Config) (*proxyPool, error) {
+	var specs []string
+	if cfg.Proxy != "" {
+		specs = append(specs, cfg.Proxy)
+	}
+	if cfg.ProxyFile != "" {
+		listed, err := readProxyFile(cfg.ProxyFile)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, listed...)
+	}
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	switch cfg.ProxyRotation {
+	case "", rotationRoundRobin, rotationRandom:
+	default:
+		return nil, fmt.Errorf("unknown proxy rotation %q, expected %s or %s", cfg.ProxyRotation, rotationRoundRobin, rotationRandom)
+	}
+
+	p := &proxyPool{random: cfg.ProxyRotation == rotationRandom}
+	for _, spec := range specs {
+		u, err := parseProxy(spec)
+		if err != nil {
+			return nil, err
+		}
+		p.proxies = append(p.proxies, &proxyEntry{url: u})
+	}
+	return p, nil
+}
+
+// readProxyFile reads a proxy URL per line, skipping blank lines and those
+// starting with #.
+func readProxyFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var specs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		specs = append(specs, line)
+	}
+	return specs, scanner.Err()
+}
+
+// parseProxy parses a proxy URL, taking one without a scheme as an HTTP
+// proxy as HTTP_PROXY does.
+func parseProxy(spec string) (*url.URL, error) {
+	if !strings.Contains(spec, "://") {
+		spec = "http://" + spec
+	}
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", spec, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy %q: unsupported scheme %s", u.Redacted(), u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: no host", u.Redacted())
+	}
+	return u, nil
+}
+
+// pick returns the proxy for the next request: the next one in turn, or
+// one at random, among those not benched. If they are all benched, the one
+// coming back the soonest is used rather than holding the request up.
+func (p *proxyPool) pick() *proxyEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	n := len(p.proxies)
+	start := int(p.next.Add(1)-1) % n
+	if p.random {
+		start = rand.Intn(n)
+	}
+	var soonest *proxyEntry
+	for i := 0; i < n; i++ {
+		e := p.proxies[(start+i)%n]
+		if !now.Before(e.benchedUntil) {
+			return e
+		}
+		if soonest == nil || e.benchedUntil.Before(soonest.benchedUntil) {
+			soonest = e
+		}
+	}
+	return soonest
+}
+
+// observe records the outcome of a request sent through e. Failing to
+// connect, or the proxy refusing with 407 Proxy Authentication Required,
+// counts as an error of the proxy; the other statuses are the site's.
+func (p *proxyPool) observe(e *proxyEntry, res *http.Response, err error) {
+	e.requests.Add(1)
+	failed := err != nil || res.StatusCode == http.StatusProxyAuthRequired
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !failed {
+		e.failuresInRow = 0
+		return
+	}
+	e.errors.Add(1)
+	e.failuresInRow++
+	if e.failuresInRow >= proxyBenchAfter {
+		e.failuresInRow = 0
+		e.benchedUntil = time.Now().Add(proxyBenchFor)
+		e.benched++
+		slog.Warn("benching proxy after failures in a row", "proxy", e.url.Redacted(), "failures", proxyBenchAfter, "for", proxyBenchFor)
+	}
+}
+
+// transport returns a transport sending every request through the next
+// proxy of the pool.
+func (p *proxyPool) transport() http.RoundTripper {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.Proxy = func(req *http.Request) (*url.URL, error) {
+		if e, ok := req.Context().Value(proxyKey{}).(*proxyEntry); ok {
+			return e.url, nil
+		}
+		return nil, nil
+	}
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		e := p.pick()
+		res, err := base.RoundTrip(req.WithContext(context.WithValue(req.Context(), proxyKey{}, e)))
+		p.observe(e, res, err)
+		return res, err
+	})
+}
+
+// proxyStat is the breakdown of the requests sent through a proxy.
+type proxyStat struct {
+	Proxy    string `json:"proxy"`
+	Requests int64  `json:"requests"`
+	Errors   int64  `json:"errors"`
+	Benched  int    `json:"benched,omitempty"`
+}
+
+// stats returns the requests and errors of every proxy, in the order they
+// were given, with their passwords redacted.
+func (p *proxyPool) stats() []proxyStat {
+	if p == nil {
+		return nil
+	}
+	if p.loaded != nil {
+		return p.loaded
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := make([]proxyStat, len(p.proxies))
+	for i, e := range p.proxies {
+		res[i] = proxyStat{Proxy: e.url.Redacted(), Requests: e.requests.Load(), Errors: e.errors.Load(), Benched: e.benched}
+	}
+	return res
+}
+
+// reportProxies writes the requests and errors of every proxy, so that
+// dead ones stand out.
+func (c *Crawler) reportProxies(w io.Writer, color func(c, s string) string) {
+	stats := c.proxies.stats()
+	if len(stats) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nProxies:")
+	for _, s := range stats {
+		line := fmt.Sprintf("  %s: %d requests, %d errors", s.Proxy, s.Requests, s.Errors)
+		if s.Requests > 0 {
+			line += fmt.Sprintf(" (%.1f%%)", float64(s.Errors)*100/float64(s.Requests))
+		}
+		if s.Benched > 0 {
+			line += fmt.Sprintf(", benched %d time", s.Benched)
+			if s.Benched > 1 {
+				line += "s"
+			}
+		}
+		if s.Errors > 0 && s.Errors == s.Requests {
+			line = color(colorRed, line)
+		}
+		fmt.Fprintln(w, line)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// purge sends the purge request for u: PurgeMethod to u itself or, with
+// PurgeHost, to the same path on that host with the Host header of u so a
+// cache in front of several sites knows which object is meant. Any status
+// of 400 or above is a failure.
+func (c *Crawler) purge(ctx context.Context, u string) (status int, d time.Duration, err error) {
+	target := u
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return 0, 0, err
+	}
+	if c.PurgeHost != "" {
+		host, err := url.Parse(c.PurgeHost)
+		if err != nil || host.Host == "" {
+			return 0, 0, fmt.Errorf("invalid purge host %q", c.PurgeHost)
+		}
+		moved := *parsed
+		moved.Scheme, moved.Host = host.Scheme, host.Host
+		target = moved.String()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, c.PurgeMethod, target, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Host = parsed.Host
+	for name, value := range c.PurgeHeaders {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("User-Agent", userAgent())
+
+	c.limiter.wait(ctx)
+	start := time.Now()
+	res, err := c.client.Do(req)
+	d = time.Since(start)
+	if err != nil {
+		return 0, d, err
+	}
+	c.drainAndClose(res.Body, res.Body)
+
+	if res.StatusCode >= 400 {
+		return res.StatusCode, d, fmt.Errorf("%s %s: %s", c.PurgeMethod, target, res.Status)
+	}
+	return res.StatusCode, d, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runCollector exposes the aggregates of a finished run as constant metrics.
+type runCollector struct {
+	c         *Crawler
+	crawlTime time.Duration
+
+	pages        *prometheus.Desc
+	errors       *prometheus.Desc
+	duration     *prometheus.Desc
+	responseTime *prometheus.Desc
+	lastRun      *prometheus.Desc
+}
+
+func newRunCollector(c *Crawler, crawlTime time.Duration) *runCollector {
+	return &runCollector{
+		c:            c,
+		crawlTime:    crawlTime,
+		pages:        prometheus.NewDesc("gowarmer_pages", "Pages fetched in the last run by HTTP status.", []string{"status"}, nil),
+		errors:       prometheus.NewDesc("gowarmer_request_errors", "Requests in the last run that failed without a response.", nil, nil),
+		duration:     prometheus.NewDesc("gowarmer_duration_seconds", "Duration of the last run.", nil, nil),
+		responseTime: prometheus.NewDesc("gowarmer_response_time_seconds", "Response times of successful requests in the last run.", nil, nil),
+		lastRun:      prometheus.NewDesc("gowarmer_last_run_timestamp_seconds", "Time the last run completed.", nil, nil),
+	}
+}
+
+func (rc *runCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- rc.pages
+	ch <- rc.errors
+	ch <- rc.duration
+	ch <- rc.responseTime
+	ch <- rc.lastRun
+}
+
+func (rc *runCollector) Collect(ch chan<- prometheus.Metric) {
+	s := rc.c.stats
+	for status, count := range s.statusCount {
+		ch <- prometheus.MustNewConstMetric(rc.pages, prometheus.GaugeValue, float64(count), strconv.Itoa(status))
+	}
+	ch <- prometheus.MustNewConstMetric(rc.errors, prometheus.GaugeValue, float64(s.errors))
+	ch <- prometheus.MustNewConstMetric(rc.duration, prometheus.GaugeValue, rc.crawlTime.Seconds())
+	ch <- prometheus.MustNewConstMetric(rc.lastRun, prometheus.GaugeValue, float64(time.Now().Unix()))
+
+	quantiles := make(map[float64]float64)
+	for _, q := range []float64{0.5, 0.9, 0.95, 0.99} {
+		quantiles[q] = s.latency.quantile(q).Seconds()
+	}
+	ch <- prometheus.MustNewConstSummary(rc.responseTime, uint64(s.latency.count()), s.latency.sum().Seconds(), quantiles)
+}
+
+// pushMetrics pushes the metrics of the finished run to the Pushgateway,
+// replacing any earlier metrics of the same job and grouping labels.
+func (c *Crawler) pushMetrics(crawlTime time.Duration) error {
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(newRunCollector(c, crawlTime)); err != nil {
+		return err
+	}
+
+	pusher := push.New(c.Pushgateway, c.PushJob).Gatherer(reg)
+	for name, value := range c.PushLabels {
+		pusher = pusher.Grouping(name, value)
+	}
+	if c.PushUsername != "" {
+		pusher = pusher.BasicAuth(c.PushUsername, c.PushPassword)
+	}
+	return pusher.Push()
+}
+
+// labelFlag parses "name1=value1,name2=value2" into a label map.
+type labelFlag struct {
+	labels *map[string]string
+}
+
+func (f labelFlag) String() string {
+	if f.labels == nil {
+		return ""
+	}
+	var pairs []string
+	for name, value := range *f.labels {
+		pairs = append(pairs, name+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f labelFlag) Set(s string) error {
+	if *f.labels == nil {
+		*f.labels = make(map[string]string)
+	}
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("invalid label %q, expected name=value", pair)
+		}
+		(*f.labels)[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// rateWindow is the number of one-second buckets rateMeter averages over.
+const rateWindow = 10
+
+// rateMeter tracks events per second over a sliding window.
+type rateMeter struct {
+	mu      sync.Mutex
+	counts  [rateWindow]int
+	seconds [rateWindow]int64
+}
+
+func (m *rateMeter) record(now time.Time) {
+	sec := now.Unix()
+	i := sec % rateWindow
+
+	m.mu.Lock()
+	if m.seconds[i] != sec {
+		m.seconds[i] = sec
+		m.counts[i] = 0
+	}
+	m.counts[i]++
+	m.mu.Unlock()
+}
+
+// rate returns the average number of events per second over the last
+// rateWindow full seconds, or over the time since start if that's shorter.
+func (m *rateMeter) rate(now, start time.Time) float64 {
+	sec := now.Unix()
+	window := int64(rateWindow)
+	if elapsed := sec - start.Unix(); elapsed < window {
+		window = elapsed
+	}
+	if window <= 0 {
+		return 0
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	total := 0
+	for i := range m.counts {
+		// Skip the current, incomplete second.
+		if age := sec - m.seconds[i]; age >= 1 && age <= window {
+			total += m.counts[i]
+		}
+	}
+	return float64(total) / float64(window)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// redirectLoopError aborts a request whose redirects lead back to a URL
+// already visited on the way. Chain lists the URLs in the order visited,
+// ending with the repeated one.
+type redirectLoopError struct {
+	chain []string
+}
+
+func (e *redirectLoopError) Error() string {
+	return "redirect loop: " + strings.Join(e.chain, " -> ")
+}
+
+// recordRedirectLoop remembers a loop for the report, once however many of
+// its members it was detected from, and keeps its members from being queued
+// again when they are discovered later.
+func (c *Crawler) recordRedirectLoop(chain []string) {
+	members := make([]string, 0, len(chain)-1)
+	for _, u := range chain[:len(chain)-1] {
+		members = append(members, urlKey(u))
+	}
+	sort.Strings(members)
+	id := strings.Join(members, " ")
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.loopMembers == nil {
+		c.loopMembers = make(map[string]bool)
+	}
+	for _, m := range members {
+		c.loopMembers[m] = true
+	}
+	for _, loop := range c.redirectLoops {
+		if loop.id == id {
+			return
+		}
+	}
+	c.redirectLoops = append(c.redirectLoops, redirectLoop{id: id, Chain: chain})
+}
+
+// redirectLoop is a redirect loop detected during the crawl.
+type redirectLoop struct {
+	id    string
+	Chain []string `json:"chain"`
+}
+
+// inRedirectLoop reports whether u is part of a known redirect loop.
+// The caller holds c.lock.
+func (c *Crawler) inRedirectLoop(u string) bool {
+	return c.loopMembers[urlKey(u)]
+}
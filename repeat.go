@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// repeatTimings are the response times of a URL fetched several times in a
+// row with -repeat, the first fetch included.
+type repeatTimings struct {
+	Count  int
+	Errors int
+	Min    time.Duration
+	Mean   time.Duration
+	Max    time.Duration
+	StdDev time.Duration
+}
+
+// repeatFetches fetches the URL of r Repeat-1 more times, one after the
+// other and with the same headers as the first, and records the spread of
+// the response times. The worst status seen becomes the status of r, so a
+// URL that fails only now and then still shows up in the breakdown.
+func (c *Crawler) repeatFetches(ctx context.Context, r *Result, header http.Header) {
+	times := []time.Duration{r.ResponseTime}
+	errors := 0
+	for i := 1; i < c.Repeat && c.runCtx.Err() == nil; i++ {
+		c.limiter.wait(c.runCtx)
+
+		start := time.Now()
+		res, err := c.sendRequest(ctx, r.URL, header)
+		responseTime := time.Since(start)
+		if err != nil {
+			slog.Warn("repeated fetch failed", "url", r.URL, "repeat", i+1, "error", err)
+			errors++
+			continue
+		}
+		c.drainAndClose(res.Body, res.Body)
+		times = append(times, responseTime)
+		if res.StatusCode > r.StatusCode {
+			r.StatusCode, r.Status = res.StatusCode, res.Status
+		}
+		slog.Debug("fetched again", "url", r.URL, "repeat", i+1, "status", res.StatusCode, "duration", responseTime)
+	}
+
+	t := &repeatTimings{Count: len(times) + errors, Errors: errors, Min: times[0], Max: times[0]}
+	var sum time.Duration
+	for _, d := range times {
+		t.Min, t.Max = min(t.Min, d), max(t.Max, d)
+		sum += d
+	}
+	t.Mean = sum / time.Duration(len(times))
+	var squares float64
+	for _, d := range times {
+		squares += math.Pow(float64(d-t.Mean), 2)
+	}
+	t.StdDev = time.Duration(math.Sqrt(squares / float64(len(times))))
+	r.Repeat = t
+}
+
+// repeated returns the results fetched several times, those with the
+// highest mean response time first.
+func (c *Crawler) repeated() []Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var res []Result
+	for _, r := range c.results {
+		if r.Repeat != nil {
+			res = append(res, r)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Repeat.Mean != res[j].Repeat.Mean {
+			return res[i].Repeat.Mean > res[j].Repeat.Mean
+		}
+		return resultKey(res[i]) < resultKey(res[j])
+	})
+	return res
+}
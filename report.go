@@ -0,0 +1,605 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (c *Crawler) report(w io.Writer, crawlTime time.Duration) {
+	fmt.Fprintln(w, "\nCrawling completed")
+	if c.runID != "" {
+		line := "Run " + c.runID
+		if !c.started.IsZero() && !c.finished.IsZero() {
+			line += fmt.Sprintf(", %s to %s", c.started.UTC().Format(time.RFC3339), c.finished.UTC().Format(time.RFC3339))
+		}
+		fmt.Fprintln(w, line)
+	}
+
+	color := func(c, s string) string { return s }
+	if useColor(w) {
+		color = colorize
+	}
+
+	// Display each link and its status, colored by status
+	if len(c.results) > 0 {
+		fmt.Fprintln(w, "\nDetailed Report:")
+		for _, r := range c.sortedResults() {
+			status := r.Status
+			if r.Err != nil {
+				status = r.Err.Error()
+			}
+			line := fmt.Sprintf("%s : %v | Response Time: %v", r.URL, status, r.ResponseTime)
+			if r.Protocol != "" {
+				line += " | " + r.Protocol
+			}
+			// URLs that only got there on a retry are the flaky ones.
+			if r.Attempts > 1 {
+				line += fmt.Sprintf(" | attempts: %d", r.Attempts)
+			}
+			fmt.Fprintln(w, color(c.success.resultColor(r), line))
+		}
+	}
+
+	// A multi-site run reports each site before the roll-up.
+	for _, site := range c.sites {
+		fmt.Fprintf(w, "\n=== %s ===\n", site.Name)
+		site.reportStats(w, site.elapsed)
+	}
+	if len(c.sites) > 0 {
+		fmt.Fprintf(w, "\n=== All sites (%d) ===\n", len(c.sites))
+	}
+
+	c.reportStats(w, crawlTime)
+}
+
+// ANSI colors of the report on a terminal.
+const (
+	colorRed     = "\033[31m"
+	colorYellow  = "\033[33m"
+	colorMagenta = "\033[35m"
+	colorReset   = "\033[0m"
+)
+
+// statusColor returns the color a status is shown in: 2xx plainly, 3xx
+// yellow and 4xx and 5xx red. Network errors are magenta.
+func statusColor(code int) string {
+	switch {
+	case code >= 400:
+		return colorRed
+	case code >= 300:
+		return colorYellow
+	}
+	return ""
+}
+
+func colorize(color, s string) string {
+	if color == "" {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// useColor reports whether w is a terminal the report can be colored on.
+func useColor(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && isTerminal(f)
+}
+
+// reportStats writes the status breakdown and summary of c.
+func (c *Crawler) reportStats(w io.Writer, crawlTime time.Duration) {
+	color := func(c, s string) string { return s }
+	if useColor(w) {
+		color = colorize
+	}
+
+	// Breakdown by status
+	fmt.Fprintln(w, "\nStatus Breakdown:")
+	statuses := make([]int, 0, len(c.stats.statusCount))
+	for status := range c.stats.statusCount {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	for _, status := range statuses {
+		fmt.Fprintln(w, color(c.success.color(status), fmt.Sprintf("Status %d: %d pages", status, c.stats.statusCount[status])))
+	}
+	if len(c.stats.errorClass) > 0 {
+		fmt.Fprintln(w, "\nError Breakdown:")
+		classes := make([]string, 0, len(c.stats.errorClass))
+		for class := range c.stats.errorClass {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		for _, class := range classes {
+			fmt.Fprintln(w, color(colorMagenta, fmt.Sprintf("%s: %d pages", class, c.stats.errorClass[class])))
+		}
+	}
+
+	if len(c.stats.protocols) > 0 {
+		fmt.Fprintln(w, "\nProtocol Breakdown:")
+		protocols := make([]string, 0, len(c.stats.protocols))
+		for proto := range c.stats.protocols {
+			protocols = append(protocols, proto)
+		}
+		sort.Strings(protocols)
+		for _, proto := range protocols {
+			fmt.Fprintf(w, "%s: %d pages\n", proto, c.stats.protocols[proto])
+		}
+		if n := c.stats.http3Fallbacks; n > 0 {
+			fmt.Fprintln(w, color(colorYellow, fmt.Sprintf("Fell back from HTTP/3: %d pages", n)))
+		}
+	}
+
+	// Total pages crawled
+	fmt.Fprintln(w, "\nSummary:")
+	fmt.Fprintf(w, "Total crawl time: %v\n", crawlTime)
+	fmt.Fprintf(w, "Total pages crawled: %d\n", c.stats.pages-c.stats.assets-c.stats.apis)
+	if c.stats.apis > 0 {
+		line := fmt.Sprintf("API requests: %d", c.stats.apis)
+		if c.stats.apiFailures > 0 {
+			line += color(colorRed, fmt.Sprintf(", %d failed", c.stats.apiFailures))
+		}
+		fmt.Fprintln(w, line)
+	}
+	if c.stats.assets > 0 {
+		line := fmt.Sprintf("Sitemap assets: %d fetched", c.stats.assets)
+		if c.stats.assetFailures > 0 {
+			line += color(colorRed, fmt.Sprintf(", %d failed", c.stats.assetFailures))
+		}
+		fmt.Fprintln(w, line)
+	}
+	if c.stats.fresh > 0 {
+		fmt.Fprintf(w, "Skipped as fresh: %d\n", c.stats.fresh)
+	}
+	if c.sampling() || c.sitemapAvailable > 0 {
+		line := fmt.Sprintf("Sitemap URLs selected: %d of %d available", c.sitemapSelected, c.sitemapAvailable)
+		if c.seed != 0 {
+			line += fmt.Sprintf(" (seed %d)", c.seed)
+		}
+		fmt.Fprintln(w, line)
+	}
+	if c.linksDiscovered > 0 {
+		in := c.linksDiscovered - c.sampledOut
+		fmt.Fprintf(w, "Crawl sample: %d links discovered, %d sampled in (%.0f%%), %d pages fetched (seed %d)\n",
+			c.linksDiscovered, in, float64(in)*100/float64(c.linksDiscovered), c.stats.pages, c.seed)
+	}
+	if c.stats.alternates > 0 {
+		fmt.Fprintf(w, "Alternate format pages: %d, %d of them AMP\n", c.stats.alternates, c.stats.amp)
+	}
+	if c.conditionalRequests > 0 {
+		fmt.Fprintf(w, "Validator cache: %d conditional requests, %d not modified (304), %d fetched in full (200)\n",
+			c.conditionalRequests, c.stats.statusCount[304], c.stats.statusCount[200])
+	}
+	if c.SaveBodies != "" {
+		fmt.Fprintf(w, "Saved bodies: %d files, %s written to %s\n", c.savedFiles, formatSize(c.savedBytes), c.SaveBodies)
+	}
+	if c.WARC != "" {
+		fmt.Fprintf(w, "WARC: %d responses written to %s\n", c.warcResponses, c.WARC)
+	}
+	if c.breakerTrips > 0 {
+		fmt.Fprintln(w, color(colorYellow, fmt.Sprintf("Circuit breaker openings: %d, paused for %v", c.breakerTrips, c.breakerOpen.Round(time.Second))))
+	}
+	if c.concurrencyPeak > 0 {
+		fmt.Fprintf(w, "Concurrency: auto, peaked at %d, %.1f on average\n", c.concurrencyPeak, c.concurrencyAverage)
+	}
+	if c.Shuffle && c.seed != 0 {
+		fmt.Fprintf(w, "Shuffled with seed %d\n", c.seed)
+	}
+	if c.shard.count > 0 {
+		own, other := c.shardCounts()
+		fmt.Fprintf(w, "Shard %v: %d URLs in this shard, %d left to other shards\n", c.shard, own, other)
+	}
+	if c.stats.errors > 0 {
+		fmt.Fprintln(w, color(colorMagenta, fmt.Sprintf("Failed requests: %d", c.stats.errors)))
+	}
+	if c.stats.slow > 0 {
+		fmt.Fprintf(w, "Slow pages: %d", c.stats.slow)
+		if c.SlowThreshold > 0 {
+			fmt.Fprintf(w, " (over %v)", c.SlowThreshold)
+		}
+		fmt.Fprintln(w)
+	}
+	if n := c.oversizedCount(); n > 0 {
+		fmt.Fprintf(w, "Oversized pages: %d\n", n)
+	}
+	if c.stats.headerViolations > 0 {
+		fmt.Fprintf(w, "Pages violating required headers: %d\n", c.stats.headerViolations)
+	}
+	if s := c.stats; s.assertionFailures > 0 || s.assertionsNotEvaluated > 0 {
+		fmt.Fprintf(w, "Pages failing content assertions: %d, not evaluated: %d\n", s.assertionFailures, s.assertionsNotEvaluated)
+	}
+	if c.stats.soft404 > 0 {
+		fmt.Fprintf(w, "Soft 404s: %d\n", c.stats.soft404)
+	}
+	if s := c.stats; s.uncompressed > 0 {
+		fmt.Fprintf(w, "Uncompressed responses: %d, ~%s more than gzipped\n", s.uncompressed, formatSize(s.compressionWaste))
+	}
+	if c.stats.seoIssues > 0 {
+		fmt.Fprintf(w, "Pages with SEO issues: %d\n", c.stats.seoIssues)
+	}
+	if c.stats.mixedContent > 0 {
+		fmt.Fprintf(w, "Pages with mixed content: %d\n", c.stats.mixedContent)
+	}
+	if c.stats.noindex > 0 {
+		fmt.Fprintf(w, "Pages marked noindex (not counted as failures): %d\n", c.stats.noindex)
+	}
+	if n := c.unsuccessful(); n > 0 {
+		fmt.Fprintln(w, color(colorRed, fmt.Sprintf("Unsuccessful responses: %d", n)))
+	}
+	states := c.stateCounts()
+	fmt.Fprintf(w, "URLs by state: %d done, %d failed", states[stateDone], states[stateFailed])
+	if n := states[stateFresh]; n > 0 {
+		fmt.Fprintf(w, ", %d skipped as fresh", n)
+	}
+	if n := states[stateQueued]; n > 0 {
+		fmt.Fprintf(w, ", %d discovered but never attempted", n)
+	}
+	if n := states[stateSampledOut]; n > 0 {
+		fmt.Fprintf(w, ", %d left out of the sample", n)
+	}
+	if n := states[stateTrapped]; n > 0 {
+		fmt.Fprintf(w, ", %d suppressed as possible crawler traps", n)
+	}
+	fmt.Fprintln(w)
+	if len(c.weights) > 0 {
+		fmt.Fprintln(w, "Order: by -priority weight, highest first")
+	}
+	if c.WeightedFile != "" && c.Order == orderFIFO {
+		fmt.Fprintln(w, "Order: by -weighted-file weight, heaviest first")
+	}
+	c.reportTraffic(w)
+	switch c.Order {
+	case orderPriority:
+		fmt.Fprintln(w, "Order: by sitemap priority, highest first")
+	case orderLastmod:
+		fmt.Fprintln(w, "Order: by sitemap lastmod, newest first")
+	}
+	if c.stats.offHost > 0 {
+		fmt.Fprintf(w, "Redirected off-host (links not followed): %d\n", c.stats.offHost)
+		for i, r := range c.offHostRedirects() {
+			if i == maxReportedFailures {
+				fmt.Fprintf(w, "  ... and %d more\n", c.stats.offHost-i)
+				break
+			}
+			fmt.Fprintf(w, "  %s -> %s\n", r.URL, r.FinalURL)
+		}
+	}
+	if c.stats.throttled > 0 {
+		fmt.Fprintf(w, "429 Too Many Requests: %d\n", c.stats.throttled)
+	}
+	if s := c.stats; s.retries > 0 {
+		fmt.Fprintf(w, "Retried requests: %d, %d URLs needed more than one attempt, %d succeeded on retry\n",
+			s.retries, s.multiAttempt, s.recovered)
+	}
+	if c.reportHostPeaks() {
+		fmt.Fprintln(w, "Peak concurrency per host:")
+		for _, p := range c.hosts.peaks() {
+			fmt.Fprintf(w, "  %s: %d\n", p.Host, p.Peak)
+		}
+	}
+	if n := len(c.failedSitemaps); n > 0 {
+		fmt.Fprintf(w, "Failed sitemaps: %d\n", n)
+		for i, f := range c.failedSitemaps {
+			if i == maxReportedFailures {
+				fmt.Fprintf(w, "  ... and %d more\n", n-i)
+				break
+			}
+			fmt.Fprintf(w, "  %s: %s\n", f.URL, f.Error)
+		}
+	}
+	c.reportOpenAPISkipped(w)
+	if n := len(c.redirectLoops); n > 0 {
+		fmt.Fprintf(w, "Redirect loops: %d\n", n)
+		for _, loop := range c.redirectLoops {
+			fmt.Fprintf(w, "  %s\n", strings.Join(loop.Chain, " -> "))
+		}
+	}
+	if c.stoppedBy == stoppedByQuit {
+		fmt.Fprintf(w, "Quit before the end: %d URLs not warmed\n", c.notWarmed)
+	} else if c.stoppedBy != "" {
+		fmt.Fprintf(w, "Stopped by -%s: %d URLs not warmed\n", c.stoppedBy, c.notWarmed)
+	}
+	hosts := make([]string, 0, len(c.skippedHosts))
+	for host := range c.skippedHosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		fmt.Fprintf(w, "Skipped host %s: %d queued URLs not warmed\n", host, c.skippedHosts[host])
+	}
+	if b := c.budget; b != nil {
+		fmt.Fprintf(w, "Downloaded %d of %d budgeted bytes", b.used.Load(), b.limit)
+		if b.exhausted() {
+			fmt.Fprint(w, " (truncated by budget)")
+		}
+		fmt.Fprintln(w)
+	}
+	if s := c.stats; s.purged > 0 {
+		fmt.Fprintf(w, "Purge requests: %d, %d failed, average %v\n",
+			s.purged, s.purgeFailures, (s.purgeTime / time.Duration(s.purged)).Round(time.Millisecond))
+	}
+
+	if c.stats.bytes > 0 {
+		fmt.Fprintf(w, "Throughput: %s/s average, %s/s peak\n",
+			formatSize(int64(c.avgThroughput(crawlTime))), formatSize(c.throughput.peakRate()))
+	}
+	if c.stats.variantRequests > 0 {
+		fmt.Fprintf(w, "Variant requests: %d\n", c.stats.variantRequests)
+	}
+	if n := c.stats.repeatRequests; n > 0 {
+		fmt.Fprintf(w, "Page requests: %d, %d of them repeats\n", c.stats.pages+n, n)
+	}
+	if s := c.stats; s.speedups > 0 {
+		fmt.Fprintf(w, "Second fetch: %.1fx faster on average over %d URLs, %d not faster\n",
+			s.speedupSum/float64(s.speedups), s.speedups, s.noSpeedup)
+	}
+
+	if lat := c.stats.latency; lat.count() > 0 {
+		approx := ""
+		if lat.approximate() {
+			approx = " (approximate)"
+		}
+		fmt.Fprintf(w, "Response times: p50 %v | p95 %v | p99 %v%s\n",
+			lat.quantile(0.50).Round(time.Millisecond),
+			lat.quantile(0.95).Round(time.Millisecond),
+			lat.quantile(0.99).Round(time.Millisecond),
+			approx)
+	}
+	c.reportPhases(w)
+	if checks := c.checkLatency(); len(checks) > 0 {
+		c.writeLatencyChecks(w, checks, color)
+	}
+
+	if links := c.redirectedLinks(); len(links) > 0 {
+		fmt.Fprintf(w, "\nLinks to redirects: %d\n", len(links))
+		for i, l := range links {
+			if i == maxReportedFailures {
+				fmt.Fprintf(w, "  ... and %d more\n", len(links)-i)
+				break
+			}
+			status := ""
+			switch {
+			case l.meta:
+				status = "meta refresh "
+			case l.RedirectStatus != 0:
+				status = strconv.Itoa(l.RedirectStatus) + " "
+			}
+			fmt.Fprintf(w, "  %s%s -> %s\n", status, l.URL, l.FinalURL)
+			fmt.Fprintf(w, "    %d links, from %s\n", l.links, strings.Join(l.linkedFrom, ", "))
+		}
+	}
+
+	if checked, _ := c.external.counts(); checked > 0 {
+		broken := c.external.brokenLinks()
+		fmt.Fprintf(w, "\nBroken external links: %d of %d checked\n", len(broken), checked)
+		for i, l := range broken {
+			if i == maxReportedFailures {
+				fmt.Fprintf(w, "  ... and %d more\n", len(broken)-i)
+				break
+			}
+			if l.Err != nil {
+				fmt.Fprintf(w, "  %s: %s\n", l.URL, color(colorMagenta, l.Err.Error()))
+			} else {
+				fmt.Fprintf(w, "  %d %s\n", l.StatusCode, l.URL)
+			}
+			fmt.Fprintf(w, "    from %s\n", strings.Join(l.linkedFrom, ", "))
+		}
+	}
+
+	c.reportChanges(w)
+	c.reportRegressions(w, color)
+
+	if groups := c.duplicates(); len(groups) > 0 {
+		fmt.Fprintf(w, "\nDuplicate content: %d groups\n", len(groups))
+		for i, g := range groups {
+			if i == maxReportedFailures {
+				fmt.Fprintf(w, "  ... and %d more groups\n", len(groups)-i)
+				break
+			}
+			fmt.Fprintf(w, "  %d URLs, sha256 %s\n", len(g.results), g.hash[:12])
+			for _, r := range g.results {
+				fmt.Fprintf(w, "    %s %s\n", formatSize(r.Size), r.URL)
+			}
+		}
+	}
+
+	c.reportOrphans(w)
+
+	if pages := c.uncompressed(); len(pages) > 0 {
+		fmt.Fprintln(w, "\nUncompressed responses:")
+		for i, r := range pages {
+			if i == maxReportedFailures {
+				fmt.Fprintf(w, "  ... and %d more\n", len(pages)-i)
+				break
+			}
+			fmt.Fprintf(w, "  %s (~%s gzipped) %s\n", formatSize(r.Size), formatSize(r.GzipEstimate), r.URL)
+		}
+	}
+
+	if pages := c.oversized(); len(pages) > 0 {
+		fmt.Fprintln(w, "\nOversized pages:")
+		for i, p := range pages {
+			if i == maxReportedFailures {
+				fmt.Fprintf(w, "  ... and %d more\n", len(pages)-i)
+				break
+			}
+			fmt.Fprintf(w, "  %s %s (%s)\n", formatSize(p.Size), p.URL, p.reason)
+		}
+	}
+
+	if violations := c.headerViolations(); len(violations) > 0 {
+		fmt.Fprintln(w, "\nHeader violations:")
+		for i, r := range violations {
+			if i == maxReportedFailures {
+				fmt.Fprintf(w, "  ... and %d more\n", len(violations)-i)
+				break
+			}
+			fmt.Fprintf(w, "  %s: %s\n", r.URL, strings.Join(r.HeaderViolations, "; "))
+		}
+	}
+	c.reportAssertions(w)
+
+	if soft := c.soft404s(); len(soft) > 0 {
+		fmt.Fprintln(w, "\nSoft 404s:")
+		for i, r := range soft {
+			if i == maxReportedFailures {
+				fmt.Fprintf(w, "  ... and %d more\n", len(soft)-i)
+				break
+			}
+			fmt.Fprintf(w, "  %s: %s\n", r.URL, r.Soft404)
+		}
+	}
+
+	if pages := c.seoIssues(); len(pages) > 0 {
+		fmt.Fprintln(w, "\nSEO issues:")
+		for i, r := range pages {
+			if i == maxReportedFailures {
+				fmt.Fprintf(w, "  ... and %d more\n", len(pages)-i)
+				break
+			}
+			fmt.Fprintf(w, "  %s: %s\n", r.URL, strings.Join(r.SEO.issues(), ", "))
+		}
+	}
+
+	if pages := c.mixedContentPages(); len(pages) > 0 {
+		fmt.Fprintln(w, "\nMixed/insecure references:")
+		for i, r := range pages {
+			if i == maxReportedFailures {
+				fmt.Fprintf(w, "  ... and %d more pages\n", len(pages)-i)
+				break
+			}
+			fmt.Fprintf(w, "  %s\n", r.URL)
+			for _, ref := range r.MixedContent {
+				fmt.Fprintf(w, "    %s\n", ref)
+			}
+		}
+	}
+
+	if slow := c.slowPages(); len(slow) > 0 {
+		fmt.Fprintln(w, "\nSlow pages:")
+		for i, r := range slow {
+			if i == maxReportedFailures {
+				fmt.Fprintf(w, "  ... and %d more\n", len(slow)-i)
+				break
+			}
+			fmt.Fprintf(w, "  %v %s\n", r.ResponseTime.Round(time.Millisecond), r.URL)
+		}
+	}
+
+	if varied := c.varied(); len(varied) > 0 {
+		fmt.Fprintln(w, "\nVariants warmed:")
+		for i, r := range varied {
+			if i == maxReportedFailures {
+				fmt.Fprintf(w, "  ... and %d more URLs\n", len(varied)-i)
+				break
+			}
+			fmt.Fprintf(w, "  %s\n", r.URL)
+			for _, v := range r.Variants {
+				fmt.Fprintf(w, "    %s\n", v)
+			}
+		}
+	}
+
+	c.reportLoad(w, crawlTime)
+
+	if repeated := c.repeated(); len(repeated) > 0 {
+		fmt.Fprintln(w, "\nRepeated fetches (slowest mean first):")
+		for i, r := range repeated {
+			if i == maxReportedFailures {
+				fmt.Fprintf(w, "  ... and %d more\n", len(repeated)-i)
+				break
+			}
+			t := r.Repeat
+			line := fmt.Sprintf("  %s: %d× min %v mean %v max %v stddev %v", r.URL, t.Count,
+				t.Min.Round(time.Millisecond), t.Mean.Round(time.Millisecond), t.Max.Round(time.Millisecond), t.StdDev.Round(time.Millisecond))
+			if t.Errors > 0 {
+				line += fmt.Sprintf(", %d failed", t.Errors)
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+
+	if slow := c.noSpeedup(); len(slow) > 0 {
+		fmt.Fprintln(w, "\nNot faster on the second fetch (possibly uncacheable):")
+		for i, r := range slow {
+			if i == maxReportedFailures {
+				fmt.Fprintf(w, "  ... and %d more\n", len(slow)-i)
+				break
+			}
+			fmt.Fprintf(w, "  %s: %v then %v\n", r.URL, r.ResponseTime.Round(time.Millisecond), r.SecondResponseTime.Round(time.Millisecond))
+		}
+	}
+
+	c.reportAuthFailures(w, color)
+	c.reportProxies(w, color)
+	c.reportTraps(w)
+
+	if failures := c.failures(); len(failures) > 0 {
+		fmt.Fprintln(w, "\nFailures:")
+		for i, r := range failures {
+			if i == maxReportedFailures {
+				fmt.Fprintf(w, "  ... and %d more\n", len(failures)-i)
+				break
+			}
+			line := fmt.Sprintf("  %s: %v", r.URL, r.Err)
+			switch {
+			case r.TimeoutLimit != "":
+				line = fmt.Sprintf("  %s: [%s after %s] %v", r.URL, r.ErrClass, r.TimeoutLimit, r.Err)
+			case r.ErrClass != "":
+				line = fmt.Sprintf("  %s: [%s] %v", r.URL, r.ErrClass, r.Err)
+			}
+			fmt.Fprintln(w, color(colorMagenta, line))
+		}
+	}
+
+	if unsuccessful := c.unsuccessfulResults(); len(unsuccessful) > 0 {
+		fmt.Fprintln(w, "\nUnsuccessful pages:")
+		for i, r := range unsuccessful {
+			if i == maxReportedFailures {
+				fmt.Fprintf(w, "  ... and %d more\n", len(unsuccessful)-i)
+				break
+			}
+			fmt.Fprintln(w, color(c.success.color(r.StatusCode), fmt.Sprintf("  %d %s", r.StatusCode, r.URL)))
+		}
+	}
+
+	if v := c.verification; v != nil {
+		c.reportVerification(w, v)
+	}
+}
+
+// maxReportedFailures caps the failed URLs listed in the text report.
+const maxReportedFailures = 20
+
+// maxReportedMisses caps the URLs listed as still MISS in the text report.
+const maxReportedMisses = 20
+
+func (c *Crawler) reportVerification(w io.Writer, v *verification) {
+	fmt.Fprintln(w, "\nVerification:")
+	by := "response time (hit = at least 2x faster)"
+	if v.header != "" {
+		by = v.header + " header"
+	}
+	fmt.Fprintf(w, "Checked %d URLs by %s\n", v.checked, by)
+	fmt.Fprintf(w, "Confirmed HIT: %d (%.1f%%)\n", v.hits, v.hitRatio()*100)
+	if v.failed > 0 {
+		fmt.Fprintf(w, "Failed requests: %d\n", v.failed)
+	}
+	if v.speedupCount > 0 {
+		fmt.Fprintf(w, "Average speed-up: %.1fx\n", v.avgSpeedup())
+	}
+	if len(v.misses) > 0 {
+		fmt.Fprintf(w, "Still MISS: %d\n", len(v.misses))
+		for i, u := range v.misses {
+			if i == maxReportedMisses {
+				fmt.Fprintf(w, "  ... and %d more\n", len(v.misses)-i)
+				break
+			}
+			fmt.Fprintf(w, "  %s\n", u)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// timingLines matches the lines of the report whose values depend on how
+// fast the requests happened to be, and responseTimes the response time of
+// every URL in the detailed report.
+var (
+	timingLines   = regexp.MustCompile(`(?m)^(Throughput|Response times): .*$`)
+	responseTimes = regexp.MustCompile(`Response Time: \S+`)
+)
+
+// crawlReport crawls a small site with broken links and a redirect loop and
+// returns the report, with the server's address replaced by example.test
+// and timings masked.
+func crawlReport(t *testing.T) []byte {
+	t.Helper()
+	pages := map[string]string{
+		"/":      `<a href="/a">a</a><a href="/missing">missing</a><a href="/b">b</a><a href="/loop/1">loop</a>`,
+		"/a":     `<a href="/b">b</a><a href="/gone">gone</a><a href="/broken">broken</a>`,
+		"/b":     `<a href="/">home</a>`,
+		"/other": ``,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/loop/1":
+			http.Redirect(w, r, "/loop/2", http.StatusFound)
+		case "/loop/2":
+			http.Redirect(w, r, "/loop/1", http.StatusFound)
+		case "/broken":
+			http.Error(w, "broken", http.StatusInternalServerError)
+		default:
+			body, ok := pages[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(body))
+		}
+	}))
+	defer srv.Close()
+	c := newTestCrawler(t, func(cfg *Config) {
+		cfg.StartURL = srv.URL + "/"
+		cfg.MaxConcurrency = 4
+	})
+	runWithin(t, c, 10*time.Second)
+
+	c.runID = "golden"
+	c.started, c.finished = time.Time{}, time.Time{}
+	var b bytes.Buffer
+	c.report(&b, 1500*time.Millisecond)
+	out := strings.ReplaceAll(b.String(), srv.URL, "http://example.test")
+	out = responseTimes.ReplaceAllString(out, "Response Time: (masked)")
+	return []byte(timingLines.ReplaceAllString(out, "$1: (masked)"))
+}
+
+func TestReportGolden(t *testing.T) {
+	got := crawlReport(t)
+	golden := filepath.Join("testdata", "report.golden")
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("report differs from %s (run with -update to accept it):\n%s", golden, got)
+	}
+	// Another run over the same site reports the same, whatever order the
+	// requests finished in.
+	if again := crawlReport(t); !bytes.Equal(again, got) {
+		t.Errorf("a second run reported differently:\n%s\nthen\n%s", got, again)
+	}
+}
+
+// listedURL matches the URLs of the detailed report and of the JSON results.
+var listedURL = regexp.MustCompile(`(?m)(?:^|"url": ?")http://example\.test(/[a-z])\b`)
+
+func TestRenderSortsResults(t *testing.T) {
+	results := []Result{
+		{URL: "http://example.test/c", StatusCode: 200, ResponseTime: 30 * time.Millisecond},
+		{URL: "http://example.test/a", StatusCode: 404, ResponseTime: 10 * time.Millisecond},
+		{URL: "http://example.test/d", StatusCode: 200, ResponseTime: 40 * time.Millisecond},
+		{URL: "http://example.test/b", StatusCode: 500, ResponseTime: 20 * time.Millisecond},
+	}
+	for _, tt := range []struct {
+		sort string
+		want string
+	}{
+		{sortURL, "/a /b /c /d"},
+		{sortStatus, "/c /d /a /b"},
+		{sortTime, "/d /c /b /a"},
+	} {
+		c := newTestCrawler(t, func(cfg *Config) { cfg.Sort = tt.sort })
+		for _, r := range results {
+			c.results[resultKey(r)] = r
+		}
+		for _, format := range []string{formatText, formatJSON, formatNDJSON} {
+			var b bytes.Buffer
+			render(c, format, &b, time.Second)
+			urls := listedURL.FindAllStringSubmatch(b.String(), -1)
+			var got []string
+			for _, u := range urls {
+				got = append(got, u[1])
+			}
+			if g := strings.Join(got, " "); g != tt.want {
+				t.Errorf("-sort %s -output %s listed %s, want %s", tt.sort, format, g, tt.want)
+			}
+		}
+	}
+}
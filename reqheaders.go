@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// headerRequirement is a response header every successful page must have,
+// with a value matching re if it is set.
+type headerRequirement struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// parseHeaderRequirements parses the -require-header names and the
+// -require-header-match values of the form "Name: regexp".
+func parseHeaderRequirements(names, matches []string) ([]headerRequirement, error) {
+	var res []headerRequirement
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("empty header name")
+		}
+		res = append(res, headerRequirement{name: http.CanonicalHeaderKey(name)})
+	}
+	for _, m := range matches {
+		name, pattern, ok := strings.Cut(m, ":")
+		name, pattern = strings.TrimSpace(name), strings.TrimSpace(pattern)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid header match %q, expected Name: regexp", m)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("header match %q: %w", m, err)
+		}
+		res = append(res, headerRequirement{name: http.CanonicalHeaderKey(name), re: re})
+	}
+	return res, nil
+}
+
+// checkHeaders returns how h violates the header requirements, and the
+// values of the required headers it has.
+func (c *Crawler) checkHeaders(h http.Header) (violations []string, values map[string]string) {
+	for _, req := range c.requiredHeaders {
+		vs, ok := h[req.name]
+		if !ok {
+			violations = append(violations, "missing "+req.name)
+			continue
+		}
+		value := strings.Join(vs, ", ")
+		if values == nil {
+			values = make(map[string]string)
+		}
+		values[req.name] = value
+		if req.re != nil && !req.re.MatchString(value) {
+			violations = append(violations, fmt.Sprintf("%s: %q doesn't match %s", req.name, value, req.re))
+		}
+	}
+	return violations, values
+}
+
+// captureHeaders returns the values of the named headers h has, or nil if
+// it has none of them.
+func captureHeaders(h http.Header, names []string) http.Header {
+	var captured http.Header
+	for _, name := range names {
+		name = http.CanonicalHeaderKey(name)
+		if vs := h.Values(name); len(vs) > 0 {
+			if captured == nil {
+				captured = make(http.Header)
+			}
+			captured[name] = slices.Clone(vs)
+		}
+	}
+	return captured
+}
+
+// headerViolations returns the results that violate the header
+// requirements, sorted by URL.
+func (c *Crawler) headerViolations() []Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var res []Result
+	for _, r := range c.results {
+		if len(r.HeaderViolations) > 0 {
+			res = append(res, r)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return resultKey(res[i]) < resultKey(res[j]) })
+	return res
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Attempt is the outcome of one request for a URL that took several.
+type Attempt struct {
+	StatusCode int
+	Err        error
+	Duration   time.Duration
+}
+
+// retryBaseDelay is the delay before the first retry of a URL whose
+// response doesn't say when to come back. It doubles with every attempt.
+const retryBaseDelay = time.Second
+
+// retryNetwork is the -retry-policy key of network errors.
+const retryNetwork = "network"
+
+// retryRule is an entry of the retry policy: the most attempts, the first
+// one included, a URL gets while answered with the status of key or with a
+// network error, and the delay before the first retry if not the default.
+type retryRule struct {
+	key      string
+	attempts int
+	base     time.Duration
+}
+
+func (r *retryRule) String() string {
+	s := r.key + ":" + strconv.Itoa(r.attempts)
+	if r.base > 0 {
+		s += "/" + r.base.String()
+	}
+	return s
+}
+
+// retryPolicy is the retry rule of each status, by its code, and of
+// network errors, by retryNetwork.
+type retryPolicy map[string]*retryRule
+
+// parseRetryPolicy parses a -retry-policy such as "429:5,503:5/2s,500:0":
+// statuses or network, each with the most attempts and optionally the
+// delay before the first retry, which doubles with every attempt.
+func parseRetryPolicy(s string) (retryPolicy, error) {
+	p := make(retryPolicy)
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid retry policy entry %q, expected status:attempts", entry)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key != retryNetwork {
+			code, err := strconv.Atoi(key)
+			if err != nil || code < 100 || code > 599 {
+				return nil, fmt.Errorf("invalid retry policy entry %q: %q is neither a status code nor %s", entry, key, retryNetwork)
+			}
+		}
+		if p[key] != nil {
+			return nil, fmt.Errorf("retry policy lists %s more than once", key)
+		}
+		rule := &retryRule{key: key}
+		value, base, hasBase := strings.Cut(value, "/")
+		attempts, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || attempts < 0 {
+			return nil, fmt.Errorf("invalid retry policy entry %q: %q isn't a number of attempts", entry, value)
+		}
+		rule.attempts = attempts
+		if hasBase {
+			if rule.base, err = time.ParseDuration(strings.TrimSpace(base)); err != nil || rule.base <= 0 {
+				return nil, fmt.Errorf("invalid retry policy entry %q: %q isn't a delay", entry, base)
+			}
+		}
+		p[key] = rule
+	}
+	return p, nil
+}
+
+// legacyRetryPolicy returns the policy of -retries and -retry-on: 429 and
+// the -retry-on statuses are retried -retries times.
+func legacyRetryPolicy(retries int, retryOn []int) retryPolicy {
+	p := retryPolicy{"429": {key: "429", attempts: retries + 1}}
+	for _, code := range retryOn {
+		key := strconv.Itoa(code)
+		p[key] = &retryRule{key: key, attempts: retries + 1}
+	}
+	return p
+}
+
+// forStatus returns the rule for a response with status code, or nil.
+func (p retryPolicy) forStatus(code int) *retryRule {
+	return p[strconv.Itoa(code)]
+}
+
+// forError returns the rule for a request that failed with an error of
+// class, or nil if the error isn't one a retry could fix.
+func (p retryPolicy) forError(class string) *retryRule {
+	switch class {
+	case errTimeout, errDNS, errRefused, errReset:
+		return p[retryNetwork]
+	}
+	return nil
+}
+
+// allows reports whether r allows another attempt after attempt, the
+// number of attempts made so far less one.
+func (r *retryRule) allows(attempt int) bool {
+	return r != nil && attempt+1 < r.attempts
+}
+
+// retryDelay returns how long to wait before retrying a request that was
+// answered with h: its Retry-After, as delay-seconds or an HTTP date, or
+// exponential backoff from base (retryBaseDelay if 0) by attempt (0 for
+// the first retry) if it has none. The delay never exceeds limit.
+func retryDelay(h http.Header, base time.Duration, attempt int, limit time.Duration, now time.Time) time.Duration {
+	d, ok := retryAfter(h, now)
+	if !ok {
+		if base <= 0 {
+			base = retryBaseDelay
+		}
+		d = base << min(attempt, 16)
+	}
+	if limit > 0 && d > limit {
+		d = limit
+	}
+	return d
+}
+
+// retryAfter parses the Retry-After header.
+func retryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(max(secs, 0)) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// retryLater queues t again after delay. The task stays pending in the
+// meantime, so Run doesn't return before it has been retried.
+func (c *Crawler) retryLater(t task, delay time.Duration) {
+	t.attempt++
+	c.wg.Add(1)
+	time.AfterFunc(delay, func() { c.frontier.push(t) })
+}
+
+// backoff slows down a crawler's requests while the site is answering
+// 429 Too Many Requests: every 429 doubles the pause taken before each
+// request and every other response halves it again.
+type backoff struct {
+	mu    sync.Mutex
+	delay time.Duration
+}
+
+const (
+	backoffMin = 100 * time.Millisecond
+	backoffMax = 10 * time.Second
+)
+
+func (b *backoff) slowDown() {
+	b.mu.Lock()
+	b.delay = min(max(2*b.delay, backoffMin), backoffMax)
+	b.mu.Unlock()
+}
+
+func (b *backoff) speedUp() {
+	b.mu.Lock()
+	if b.delay /= 2; b.delay < backoffMin {
+		b.delay = 0
+	}
+	b.mu.Unlock()
+}
+
+// wait sleeps for the current delay, or until ctx is done.
+func (b *backoff) wait(ctx context.Context) {
+	b.mu.Lock()
+	d := b.delay
+	b.mu.Unlock()
+	if d == 0 {
+		return
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
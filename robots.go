@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/PuerkitoBio/goquery"
+	"net/http"
+	"strings"
+)
+
+// robotsDirectives parses the comma separated directives of a robots meta
+// tag or X-Robots-Tag header, case-insensitively. none stands for both
+// noindex and nofollow.
+func robotsDirectives(content string) (noindex, nofollow bool) {
+	for _, token := range strings.Split(content, ",") {
+		switch strings.ToLower(strings.TrimSpace(token)) {
+		case "noindex":
+			noindex = true
+		case "nofollow":
+			nofollow = true
+		case "none":
+			noindex, nofollow = true, true
+		}
+	}
+	return noindex, nofollow
+}
+
+// robotsAgent is the user agent X-Robots-Tag values can be scoped to for
+// gowarmer.
+const robotsAgent = "gowarmer"
+
+// valuedDirectives are the robots directives that take a value after a
+// colon, which otherwise marks the user agent a directive is meant for.
+var valuedDirectives = map[string]bool{
+	"unavailable_after": true,
+	"max-snippet":       true,
+	"max-image-preview": true,
+	"max-video-preview": true,
+}
+
+// headerRobots returns the directives of the X-Robots-Tag headers in h.
+// Values scoped to a user agent, as in "googlebot: noindex", only count when
+// that is us, as in "gowarmer: noindex".
+func headerRobots(h http.Header) (noindex, nofollow bool) {
+	for _, value := range h.Values("X-Robots-Tag") {
+		if scope, rest, ok := strings.Cut(value, ":"); ok {
+			scope = strings.ToLower(strings.TrimSpace(scope))
+			if !strings.Contains(scope, ",") && !valuedDirectives[scope] {
+				if scope != robotsAgent {
+					continue
+				}
+				value = rest
+			}
+		}
+		ni, nf := robotsDirectives(value)
+		noindex, nofollow = noindex || ni, nofollow || nf
+	}
+	return noindex, nofollow
+}
+
+// metaRobots returns the directives of every <meta name="robots"> of doc.
+func metaRobots(doc *goquery.Document) (noindex, nofollow bool) {
+	doc.Find("meta[name]").Each(func(_ int, meta *goquery.Selection) {
+		if name, _ := meta.Attr("name"); !strings.EqualFold(strings.TrimSpace(name), "robots") {
+			return
+		}
+		content, _ := meta.Attr("content")
+		ni, nf := robotsDirectives(content)
+		noindex, nofollow = noindex || ni, nofollow || nf
+	})
+	return noindex, nofollow
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHeaderRobots(t *testing.T) {
+	tests := []struct {
+		name              string
+		values            []string
+		noindex, nofollow bool
+	}{
+		{name: "none"},
+		{name: "noindex", values: []string{"noindex"}, noindex: true},
+		{name: "list", values: []string{"noindex, nofollow"}, noindex: true, nofollow: true},
+		{name: "none directive", values: []string{"none"}, noindex: true, nofollow: true},
+		{name: "case", values: []string{"NoFollow"}, nofollow: true},
+		{name: "several headers", values: []string{"noarchive", "nofollow", "noindex"}, noindex: true, nofollow: true},
+		{name: "valued directive", values: []string{"unavailable_after: 25 Jun 2030 15:00:00 PST, noindex"}, noindex: true},
+		{name: "other agent", values: []string{"otherbot: nofollow"}},
+		{name: "our agent", values: []string{"gowarmer: noindex"}, noindex: true},
+		{name: "our agent in another case", values: []string{"GoWarmer: nofollow"}, nofollow: true},
+		{
+			name:    "agents mixed",
+			values:  []string{"gowarmer: noindex", "otherbot: nofollow"},
+			noindex: true,
+		},
+		{
+			name:     "agents mixed with a general value",
+			values:   []string{"otherbot: noindex", "nofollow"},
+			nofollow: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := make(http.Header)
+			for _, v := range tt.values {
+				h.Add("X-Robots-Tag", v)
+			}
+			noindex, nofollow := headerRobots(h)
+			if noindex != tt.noindex || nofollow != tt.nofollow {
+				t.Errorf("headerRobots(%q) = noindex %v, nofollow %v, want %v, %v",
+					tt.values, noindex, nofollow, tt.noindex, tt.nofollow)
+			}
+		})
+	}
+}
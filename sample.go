@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// sampling reports whether only some of the sitemap's URLs are warmed, with
+// -sitemap-limit, -sample or -sample-n.
+func (c *Crawler) sampling() bool {
+	return c.SitemapLimit > 0 || c.Sample > 0 || c.SampleN > 0
+}
+
+func validateSampling(cfg Config) error {
+	if cfg.Sample < 0 || cfg.Sample > 1 {
+		return fmt.Errorf("-sample %v out of range, expected a fraction between 0 and 1", cfg.Sample)
+	}
+	if cfg.Sample > 0 && cfg.SampleN > 0 {
+		return fmt.Errorf("-sample and -sample-n can't be combined")
+	}
+	if cfg.CrawlSample < 0 || cfg.CrawlSample > 1 {
+		return fmt.Errorf("-crawl-sample %v out of range, expected a fraction between 0 and 1", cfg.CrawlSample)
+	}
+	if cfg.SampleN < 0 || cfg.SitemapLimit < 0 {
+		return fmt.Errorf("-sample-n and -sitemap-limit can't be negative")
+	}
+	return nil
+}
+
+// scheduleSample loads the whole sitemap and schedules the URLs selected
+// from those that pass the include and exclude patterns and belong to this
+// shard: a uniform random sample of them with -sample or -sample-n, and then
+// the first -sitemap-limit, in the -order if one is given.
+func (c *Crawler) scheduleSample() error {
+	tasks, err := c.collectSitemapURLs(c.SitemapURL)
+	if err != nil {
+		return err
+	}
+
+	var available []task
+	seen := make(map[string]bool)
+	for _, t := range tasks {
+		t.url = removeHashFromURL(t.url)
+		key := urlKey(t.url)
+		if seen[key] || !c.allowed(t.url) {
+			continue
+		}
+		seen[key] = true
+		if !c.shard.owns(t.url) {
+			// Counted as belonging to another shard as usual.
+			c.scheduleTask(t)
+			continue
+		}
+		t.seq = uint64(len(available))
+		t.weight = c.weight(t.url)
+		available = append(available, t)
+	}
+
+	selected := available
+	n := c.SampleN
+	if c.Sample > 0 {
+		n = int(math.Round(c.Sample * float64(len(available))))
+	}
+	if (c.Sample > 0 || c.SampleN > 0) && n < len(available) {
+		picked := rand.New(rand.NewSource(c.seed)).Perm(len(available))[:n]
+		sort.Ints(picked)
+		selected = make([]task, n)
+		for i, j := range picked {
+			selected[i] = available[j]
+		}
+	}
+	if less := taskLess(c.Order, len(c.weights) > 0); less != nil {
+		sort.SliceStable(selected, func(i, j int) bool { return less(selected[i], selected[j]) })
+	}
+	if c.SitemapLimit > 0 && len(selected) > c.SitemapLimit {
+		selected = selected[:c.SitemapLimit]
+	}
+
+	c.lock.Lock()
+	c.sitemapAvailable, c.sitemapSelected = len(available), len(selected)
+	c.lock.Unlock()
+	args := []any{"available", len(available), "selected", len(selected)}
+	if c.seed != 0 {
+		args = append(args, "seed", c.seed)
+	}
+	slog.Info("selected sitemap URLs", c.logArgs(args...)...)
+
+	for _, t := range selected {
+		c.scheduleTask(t)
+	}
+	return nil
+}
+
+// sampledIn reports whether a link found on a page is fetched with
+// -crawl-sample. The choice is a hash of the seed and the URL, so the same
+// seed samples the same links whatever order they are found in.
+func (c *Crawler) sampledIn(u string) bool {
+	if c.CrawlSample <= 0 || c.CrawlSample >= 1 {
+		return true
+	}
+	return float64(shuffleKey(c.seed, urlKey(u))>>11)/(1<<53) < c.CrawlSample
+}
@@ -3,6 +3,11 @@
 package_name="gowarmer"	
 platforms=("linux/amd64" "darwin/arm64")
 
+version=$(git describe --tags --always --dirty 2>/dev/null || echo dev)
+commit=$(git rev-parse HEAD 2>/dev/null)
+date=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+ldflags="-X main.version=$version -X main.commit=$commit -X main.date=$date"
+
 for platform in "${platforms[@]}"
 do
 	platform_split=(${platform//\// })
@@ -13,9 +18,9 @@ do
 		output_name+='.exe'
 	fi	
 
-	env GOOS=$GOOS GOARCH=$GOARCH go build -o './dist/'$output_name
+	env GOOS=$GOOS GOARCH=$GOARCH go build -ldflags "$ldflags" -o './dist/'$output_name
 	if [ $? -ne 0 ]; then
    		echo 'An error has occurred! Aborting the script execution...'
 		exit 1
 	fi
-done
\ No newline at end of file
+done
@@ -0,0 +1,41 @@
+package main
+
+import "hash/fnv"
+
+// seenSet records which URLs have already been scheduled.
+type seenSet interface {
+	// add records u and reports whether it was not seen before.
+	add(u string) bool
+	len() int
+}
+
+type stringSet map[string]struct{}
+
+func (s stringSet) add(u string) bool {
+	if _, ok := s[u]; ok {
+		return false
+	}
+	s[u] = struct{}{}
+	return true
+}
+
+func (s stringSet) len() int { return len(s) }
+
+// hashSet stores a 64-bit FNV-1a hash per URL instead of the URL itself.
+// Two distinct URLs colliding would make the second one be skipped; for
+// n URLs the probability of any collision is roughly n²/2⁶⁵, about one in
+// four million for a three million URL crawl.
+type hashSet map[uint64]struct{}
+
+func (s hashSet) add(u string) bool {
+	h := fnv.New64a()
+	h.Write([]byte(u))
+	k := h.Sum64()
+	if _, ok := s[k]; ok {
+		return false
+	}
+	s[k] = struct{}{}
+	return true
+}
+
+func (s hashSet) len() int { return len(s) }
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// The -low-memory trade-offs documented in the README: a hash per URL
+// instead of the URL, and percentiles from a histogram.
+
+func TestHashSetAgreesWithStringSet(t *testing.T) {
+	const n = 500000
+	hashes, exact := make(hashSet), make(stringSet)
+	falsePositives := 0
+	for i := 0; i < n; i++ {
+		u := fmt.Sprintf("https://example.com/products/%d?page=%d", i, i%7)
+		if hashes.add(u) != exact.add(u) {
+			// The hash of a new URL was already there.
+			falsePositives++
+		}
+	}
+	// With 64-bit hashes a collision among half a million URLs has a
+	// probability of about 7e-9.
+	if falsePositives > 0 {
+		t.Errorf("%d of %d new URLs taken as seen", falsePositives, n)
+	}
+	if hashes.len() != exact.len() {
+		t.Errorf("hashSet has %d URLs, want %d", hashes.len(), exact.len())
+	}
+	for i := 0; i < n; i += 1000 {
+		u := fmt.Sprintf("https://example.com/products/%d?page=%d", i, i%7)
+		if hashes.add(u) {
+			t.Errorf("%s taken as new the second time", u)
+		}
+	}
+}
+
+func TestLatencyHistogramWithinOnePercent(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	exact, hist := &exactLatencies{}, newLatencyHistogram()
+	for i := 0; i < 100000; i++ {
+		// Response times spread over three orders of magnitude.
+		d := time.Duration(rng.ExpFloat64() * float64(200*time.Millisecond))
+		d += time.Millisecond
+		exact.record(d)
+		hist.record(d)
+	}
+	if hist.count() != exact.count() {
+		t.Errorf("histogram count %d, want %d", hist.count(), exact.count())
+	}
+	for _, q := range []float64{0.5, 0.9, 0.95, 0.99} {
+		want, got := exact.quantile(q), hist.quantile(q)
+		if diff := float64(got-want) / float64(want); diff < -0.01 || diff > 0.01 {
+			t.Errorf("p%v = %v, want %v within 1%% (off by %.2f%%)", q*100, got, want, diff*100)
+		}
+	}
+}
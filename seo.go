@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// seoAudit is what -seo-audit records about a page.
+type seoAudit struct {
+	// DescriptionLength is the length in characters of the meta
+	// description, -1 if the page has none.
+	DescriptionLength int `json:"description_length"`
+
+	// Canonical is the page's canonical URL, and CanonicalSelf whether it
+	// is the page itself.
+	Canonical     string `json:"canonical,omitempty"`
+	CanonicalSelf bool   `json:"canonical_self,omitempty"`
+
+	H1Count int  `json:"h1_count"`
+	NoIndex bool `json:"noindex,omitempty"`
+}
+
+// auditSEO audits the page at pageURL parsed into doc.
+func auditSEO(doc *goquery.Document, pageURL *url.URL) *seoAudit {
+	a := &seoAudit{DescriptionLength: -1, H1Count: doc.Find("h1").Length()}
+	a.NoIndex, _ = metaRobots(doc)
+
+	doc.Find("meta[name]").EachWithBreak(func(_ int, meta *goquery.Selection) bool {
+		if name, _ := meta.Attr("name"); !strings.EqualFold(strings.TrimSpace(name), "description") {
+			return true
+		}
+		content, _ := meta.Attr("content")
+		a.DescriptionLength = len([]rune(strings.TrimSpace(content)))
+		return false
+	})
+
+	doc.Find("link[rel][href]").EachWithBreak(func(_ int, link *goquery.Selection) bool {
+		rel, _ := link.Attr("rel")
+		isCanonical := func(v string) bool { return strings.EqualFold(v, "canonical") }
+		if !slices.ContainsFunc(strings.Fields(rel), isCanonical) {
+			return true
+		}
+		href, _ := link.Attr("href")
+		ref, err := url.Parse(strings.TrimSpace(href))
+		if err != nil {
+			a.Canonical = href
+			return false
+		}
+		canonical := pageURL.ResolveReference(ref)
+		a.Canonical = canonical.String()
+		a.CanonicalSelf = urlKey(canonical.String()) == urlKey(pageURL.String())
+		return false
+	})
+	return a
+}
+
+// issues returns the problems the audit found.
+func (a *seoAudit) issues() []string {
+	var issues []string
+	if a.DescriptionLength <= 0 {
+		issues = append(issues, "missing meta description")
+	}
+	if a.Canonical == "" {
+		issues = append(issues, "missing canonical")
+	}
+	if a.H1Count > 1 {
+		issues = append(issues, fmt.Sprintf("%d h1s", a.H1Count))
+	}
+	return issues
+}
+
+// seoIssues returns the audited results with issues, sorted by URL.
+func (c *Crawler) seoIssues() []Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var res []Result
+	for _, r := range c.results {
+		if r.SEO != nil && len(r.SEO.issues()) > 0 {
+			res = append(res, r)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return resultKey(res[i]) < resultKey(res[j]) })
+	return res
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// shard selects the share of the URLs one of several gowarmer instances
+// fetches. Every instance uses the same hash, so given the same shard count
+// they split the URLs between them without overlap.
+type shard struct {
+	index int // 1-based
+	count int
+}
+
+// parseShard parses "i/n", e.g. "2/4" for the second of four shards.
+func parseShard(s string) (shard, error) {
+	i, n, ok := strings.Cut(s, "/")
+	index, err1 := strconv.Atoi(strings.TrimSpace(i))
+	count, err2 := strconv.Atoi(strings.TrimSpace(n))
+	if !ok || err1 != nil || err2 != nil || count < 1 || index < 1 || index > count {
+		return shard{}, fmt.Errorf("invalid shard %q, expected i/n with 1 <= i <= n", s)
+	}
+	return shard{index: index, count: count}, nil
+}
+
+func (s shard) String() string {
+	return fmt.Sprintf("%d/%d", s.index, s.count)
+}
+
+// owns reports whether u belongs to the shard. Every spelling of a URL
+// with the same urlKey belongs to the same shard.
+func (s shard) owns(u string) bool {
+	if s.count <= 1 {
+		return true
+	}
+	h := fnv.New64a()
+	h.Write([]byte(urlKey(u)))
+	return h.Sum64()%uint64(s.count) == uint64(s.index-1)
+}
+
+// shardCounts returns the number of URLs seen that belong to c's shard and
+// to the other shards.
+func (c *Crawler) shardCounts() (own, other int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.seen.len() - c.otherShard, c.otherShard
+}
+
+// skippedFile collects the URLs that belong to other shards, one per line,
+// so they can be inspected or fed to `gowarmer list`.
+type skippedFile struct {
+	mu  sync.Mutex
+	f   *os.File
+	buf *bufio.Writer
+}
+
+func createSkippedFile(path string) (*skippedFile, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &skippedFile{f: f, buf: bufio.NewWriter(f)}, nil
+}
+
+func (sf *skippedFile) add(u string) {
+	if sf == nil {
+		return
+	}
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.buf.WriteString(u + "\n")
+}
+
+func (sf *skippedFile) close() error {
+	if sf == nil {
+		return nil
+	}
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	if err := sf.buf.Flush(); err != nil {
+		sf.f.Close()
+		return err
+	}
+	return sf.f.Close()
+}
@@ -0,0 +1,41 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+)
+
+// handlePauseSignals does nothing on platforms without SIGUSR1 and SIGUSR2.
+func handlePauseSignals(m monitor) (stop func()) {
+	return func() {}
+}
+
+// handleReopenSignal does nothing on platforms without SIGHUP.
+func handleReopenSignal(lf *logFile) (stop func()) {
+	return func() {}
+}
+
+// handleExitSignals writes the profiles of p when the process is
+// interrupted, then exits, until the returned function is called.
+func handleExitSignals(p *profiler) (stop func()) {
+	if p == nil {
+		return func() {}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ch:
+			p.stop()
+			os.Exit(1)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
@@ -0,0 +1,85 @@
+//go:build unix
+
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handlePauseSignals pauses m on SIGUSR1 and resumes it on SIGUSR2 until
+// the returned function is called.
+func handlePauseSignals(m monitor) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1, syscall.SIGUSR2)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-ch:
+				if sig == syscall.SIGUSR1 {
+					m.pause()
+				} else {
+					m.resume()
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+// handleReopenSignal reopens lf on SIGHUP, as logrotate expects, until the
+// returned function is called.
+func handleReopenSignal(lf *logFile) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ch:
+				if err := lf.reopen(); err != nil {
+					slog.Error("reopening the log file failed", "path", lf.path, "error", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+// handleExitSignals writes the profiles of p when the process is
+// interrupted or terminated, then exits as the signal would have, until the
+// returned function is called.
+func handleExitSignals(p *profiler) (stop func()) {
+	if p == nil {
+		return func() {}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-ch:
+			slog.Info("writing profiles before exiting", "signal", sig.String())
+			p.stop()
+			os.Exit(128 + int(sig.(syscall.Signal)))
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sitemapFailure is a sitemap that couldn't be loaded.
+type sitemapFailure struct {
+	URL   string `json:"url"`
+	Error string `json:"error"`
+}
+
+// maxSitemapDepth is how deep sitemap indexes may nest. The protocol
+// doesn't allow an index to list other indexes, but some sites do it anyway.
+const maxSitemapDepth = 5
+
+// processSitemapURL passes every page listed in the sitemap to add,
+// descending into the child sitemaps of an index. The children are fetched
+// concurrently, up to -sitemap-concurrency (or -c) at a time, and their pages
+// passed to add as soon as each one is parsed, so add must be safe for
+// concurrent use. A child that fails to load is logged, recorded for the
+// report and skipped so it doesn't take the rest of the run down with it.
+func (c *Crawler) processSitemapURL(sitemapURL string, add func(task)) error {
+	_, err := c.newSitemapWalk(sitemapURL, add).walk(sitemapURL, 0)
+	return err
+}
+
+// collectSitemapURLs returns every page listed in the sitemap, in the order
+// they are listed, children of an index in the order of the index.
+func (c *Crawler) collectSitemapURLs(sitemapURL string) ([]task, error) {
+	return c.newSitemapWalk(sitemapURL, nil).walk(sitemapURL, 0)
+}
+
+func (c *Crawler) newSitemapWalk(sitemapURL string, add func(task)) *sitemapWalk {
+	n := c.SitemapConcurrency
+	if n <= 0 {
+		n = max(c.MaxConcurrency, 1)
+	}
+	return &sitemapWalk{
+		c:    c,
+		add:  add,
+		sem:  make(chan struct{}, n),
+		seen: map[string]bool{urlKey(sitemapURL): true},
+	}
+}
+
+// sitemapWalk is a walk through a sitemap and the sitemaps it links to.
+// Pages are passed to add, or returned by walk if add is nil.
+type sitemapWalk struct {
+	c   *Crawler
+	add func(task)
+	sem chan struct{}
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func (w *sitemapWalk) walk(sitemapURL string, depth int) ([]task, error) {
+	children, pages, err := w.load(sitemapURL)
+	if err != nil {
+		return nil, err
+	}
+	if len(children) == 0 {
+		return pages, nil
+	}
+
+	var wg sync.WaitGroup
+	found := make([][]task, len(children))
+	for i, child := range children {
+		if !w.visit(child) {
+			slog.Debug("skipping sitemap listed more than once", "url", child)
+			continue
+		}
+		if depth >= maxSitemapDepth {
+			err := fmt.Errorf("sitemap %s: indexes nested more than %d deep", child, maxSitemapDepth)
+			slog.Error("skipping sitemap", "error", err)
+			w.c.sitemapFailed(child, err)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, child string) {
+			defer wg.Done()
+			var err error
+			if found[i], err = w.walk(child, depth+1); err != nil {
+				slog.Error("skipping sitemap", "error", err)
+				w.c.sitemapFailed(child, err)
+			}
+		}(i, child)
+	}
+	wg.Wait()
+	for _, f := range found {
+		pages = append(pages, f...)
+	}
+	return pages, nil
+}
+
+// visit reports whether u is a sitemap not walked yet, and marks it walked.
+func (w *sitemapWalk) visit(u string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	k := urlKey(u)
+	if w.seen[k] {
+		return false
+	}
+	w.seen[k] = true
+	return true
+}
+
+// load fetches and parses the sitemap at sitemapURL, passing its pages to
+// add or returning them. If it is an index it returns the child sitemaps
+// instead.
+func (w *sitemapWalk) load(sitemapURL string) (children []string, pages []task, err error) {
+	w.sem <- struct{}{}
+	defer func() { <-w.sem }()
+
+	c := w.c
+	c.limiter.wait(c.runCtx)
+	res, err := c.sendRequest(c.runCtx, sitemapURL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetching sitemap %s: %w", sitemapURL, err)
+	}
+	defer c.drainAndClose(res.Body, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, nil, fmt.Errorf("fetching sitemap %s: %s", sitemapURL, res.Status)
+	}
+
+	// With -check-compression the client leaves the sitemap compressed.
+	body := decodedBody(res.Body, res.Header.Get("Content-Encoding"))
+	if body == nil {
+		return nil, nil, fmt.Errorf("reading sitemap %s: can't decode Content-Encoding %s", sitemapURL, res.Header.Get("Content-Encoding"))
+	}
+	// The image and video extensions are told apart by their namespace,
+	// which the HTML parser doesn't keep, so they are read from the
+	// sitemap as XML.
+	var assets map[string][]task
+	if c.SitemapAssets {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading sitemap %s: %w", sitemapURL, err)
+		}
+		assets = c.sitemapAssets(data, sitemapURL)
+		body = bytes.NewReader(data)
+	}
+	doc, err := goquery.NewDocumentFromReader(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading sitemap document %s: %w", sitemapURL, err)
+	}
+
+	// Check if it's an index sitemap
+	doc.Find("sitemap loc").Each(func(index int, item *goquery.Selection) {
+		if u := strings.TrimSpace(item.Text()); u != "" {
+			children = append(children, u)
+		}
+	})
+	if len(children) > 0 {
+		return children, nil, nil
+	}
+
+	doc.Find("url").Each(func(index int, item *goquery.Selection) {
+		t := task{
+			url:      strings.TrimSpace(item.ChildrenFiltered("loc").First().Text()),
+			referrer: sitemapURL,
+			lastmod:  parseLastmod(item.ChildrenFiltered("lastmod").First().Text()),
+			priority: parsePriority(item.ChildrenFiltered("priority").First().Text()),
+		}
+		// A page listed twice has its assets added once.
+		found := append([]task{t}, assets[t.url]...)
+		delete(assets, t.url)
+		for _, t := range found {
+			switch {
+			case t.url == "":
+			case w.add != nil:
+				w.add(t)
+			default:
+				pages = append(pages, t)
+			}
+		}
+	})
+	return nil, pages, nil
+}
+
+// sitemapFailed records that the sitemap at u couldn't be loaded.
+func (c *Crawler) sitemapFailed(u string, err error) {
+	c.lock.Lock()
+	c.failedSitemaps = append(c.failedSitemaps, sitemapFailure{URL: u, Error: err.Error()})
+	c.lock.Unlock()
+}
+
+// lastmodLayouts are the W3C datetime forms allowed in a sitemap <lastmod>.
+var lastmodLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+}
+
+// parseLastmod parses a <lastmod> value, returning the zero time if it is
+// missing or malformed.
+func parseLastmod(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range lastmodLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// defaultPriority is the priority of a sitemap URL without <priority>, as
+// defined by the sitemap protocol.
+const defaultPriority = 0.5
+
+// parsePriority parses a <priority> value.
+func parsePriority(s string) float64 {
+	p, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || p < 0 || p > 1 {
+		return defaultPriority
+	}
+	return p
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSitemapAssetsMatchedByNamespace(t *testing.T) {
+	var hits hitCounter
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.count(r)
+		if r.URL.Path != "/sitemap.xml" {
+			return
+		}
+		// The extensions are bound to other prefixes than the usual image
+		// and video, and image is bound to an unrelated namespace.
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"
+	xmlns:pic="http://www.google.com/schemas/sitemap-image/1.1"
+	xmlns:vid="http://www.google.com/schemas/sitemap-video/1.1"
+	xmlns:image="http://example.com/not-images">
+<url>
+	<loc>%[1]s/page</loc>
+	<pic:image><pic:loc>%[1]s/photo.jpg</pic:loc></pic:image>
+	<vid:video><vid:content_loc>%[1]s/clip.mp4</vid:content_loc><vid:player_loc>%[1]s/player</vid:player_loc></vid:video>
+	<image:image><image:loc>%[1]s/decoy.jpg</image:loc></image:image>
+</url>
+</urlset>`, srv.URL)
+	}))
+	defer srv.Close()
+	c := newTestCrawler(t, func(cfg *Config) {
+		cfg.SitemapURL = srv.URL + "/sitemap.xml"
+		cfg.SitemapAssets = true
+	})
+
+	runWithin(t, c, 10*time.Second)
+
+	for path, want := range map[string]int{
+		"/page":      1,
+		"/photo.jpg": 1,
+		"/clip.mp4":  1,
+		"/player":    1,
+		"/decoy.jpg": 0,
+	} {
+		if n := hits.get(path); n != want {
+			t.Errorf("%s fetched %d times, want %d", path, n, want)
+		}
+	}
+}
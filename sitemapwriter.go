@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The limits of a single sitemap file set by the sitemaps.org protocol.
+const (
+	sitemapMaxURLs  = 50000
+	sitemapMaxBytes = 50 << 20
+)
+
+const (
+	sitemapHeader = `<?xml version="1.0" encoding="UTF-8"?>` + "\n"
+	urlsetOpen    = `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` + "\n"
+	urlsetClose   = "</urlset>\n"
+)
+
+// sitemapEntry is a URL of a generated sitemap.
+type sitemapEntry struct {
+	loc     string
+	lastmod time.Time
+}
+
+// sitemapEntries returns the URLs that belong in a sitemap generated from
+// the crawl, sorted: the HTML pages fetched successfully, at the location
+// they were redirected to. Pages marked noindex, looking like a soft 404 or
+// redirected off the host are left out.
+func (c *Crawler) sitemapEntries() []sitemapEntry {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	byLoc := make(map[string]sitemapEntry)
+	for _, r := range c.results {
+		if r.Err != nil || r.StatusCode < 200 || r.StatusCode > 299 || r.NoIndex || r.Soft404 != "" || r.OffHost {
+			continue
+		}
+		if r.ContentType != "" && !strings.Contains(r.ContentType, "html") {
+			continue
+		}
+		e := sitemapEntry{loc: r.URL}
+		if r.FinalURL != "" {
+			e.loc = r.FinalURL
+		}
+		if c.WriteSitemapLastmod {
+			e.lastmod, _ = http.ParseTime(r.LastModified)
+		}
+		if prev, ok := byLoc[e.loc]; ok && !e.lastmod.After(prev.lastmod) {
+			continue
+		}
+		byLoc[e.loc] = e
+	}
+	entries := make([]sitemapEntry, 0, len(byLoc))
+	for _, e := range byLoc {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].loc < entries[j].loc })
+	return entries
+}
+
+// writeSitemap writes the sitemap of the crawl to path. If it has more URLs
+// or bytes than a sitemap may, they are split over files numbered after
+// path, and path becomes their sitemap index, referring to them as if they
+// were published next to the first URL of the crawl, or at
+// WriteSitemapBase if set. It returns the number of URLs and files.
+func (c *Crawler) writeSitemap(path string) (urls, files int, err error) {
+	entries := c.sitemapEntries()
+
+	var parts [][]byte
+	var buf bytes.Buffer
+	count := 0
+	buf.WriteString(sitemapHeader + urlsetOpen)
+	for _, e := range entries {
+		var item bytes.Buffer
+		item.WriteString("  <url><loc>")
+		xml.EscapeText(&item, []byte(e.loc))
+		item.WriteString("</loc>")
+		if !e.lastmod.IsZero() {
+			fmt.Fprintf(&item, "<lastmod>%s</lastmod>", e.lastmod.UTC().Format(time.RFC3339))
+		}
+		item.WriteString("</url>\n")
+		if count == sitemapMaxURLs || buf.Len()+item.Len()+len(urlsetClose) > sitemapMaxBytes {
+			buf.WriteString(urlsetClose)
+			parts = append(parts, bytes.Clone(buf.Bytes()))
+			buf.Reset()
+			buf.WriteString(sitemapHeader + urlsetOpen)
+			count = 0
+		}
+		buf.Write(item.Bytes())
+		count++
+	}
+	buf.WriteString(urlsetClose)
+	parts = append(parts, buf.Bytes())
+
+	if len(parts) == 1 {
+		return len(entries), 1, os.WriteFile(path, parts[0], 0o644)
+	}
+
+	base := c.WriteSitemapBase
+	if base == "" && len(entries) > 0 {
+		if u, err := url.Parse(entries[0].loc); err == nil {
+			base = u.Scheme + "://" + u.Host + "/"
+		}
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	var index bytes.Buffer
+	index.WriteString(sitemapHeader + `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` + "\n")
+	for i, part := range parts {
+		name := fmt.Sprintf("%s-%d%s", stem, i+1, ext)
+		if err := os.WriteFile(name, part, 0o644); err != nil {
+			return 0, 0, err
+		}
+		index.WriteString("  <sitemap><loc>")
+		xml.EscapeText(&index, []byte(base+url.PathEscape(filepath.Base(name))))
+		index.WriteString("</loc></sitemap>\n")
+	}
+	index.WriteString("</sitemapindex>\n")
+	return len(entries), len(parts) + 1, os.WriteFile(path, index.Bytes(), 0o644)
+}
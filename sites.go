@@ -0,0 +1,290 @@
+package main
+
+import (
+	"maps"
+	"sync"
+	"time"
+)
+
+// monitor is the live view of a run used by the progress display, the
+// status server and the StatsD gauges. It is implemented by a Crawler and,
+// in a multi-site run, by the fleet of all site crawlers.
+type monitor interface {
+	counts() (done, errors, queued, total int)
+	status() statusResponse
+	requestRate(now, since time.Time) float64
+	active() int64
+	concurrency() int
+	pause()
+	resume()
+	isPaused() bool
+	stop()
+	skipHost(host string) int
+}
+
+// fleet adds up the crawlers of a multi-site run.
+type fleet struct {
+	crawlers []*Crawler
+	start    time.Time
+}
+
+// counts sums the counts of every site. The total is only known once every
+// site knows its own.
+func (f *fleet) counts() (done, errors, queued, total int) {
+	totalKnown := true
+	for _, c := range f.crawlers {
+		d, e, q, t := c.counts()
+		done, errors, queued, total = done+d, errors+e, queued+q, total+t
+		if t == 0 {
+			totalKnown = false
+		}
+	}
+	if !totalKnown {
+		total = 0
+	}
+	return done, errors, queued, total
+}
+
+func (f *fleet) status() statusResponse {
+	now := time.Now()
+	s := statusResponse{StatusCount: make(map[string]int), States: make(map[string]int)}
+	for _, c := range f.crawlers {
+		cs := c.status()
+		for state, n := range cs.States {
+			s.States[state] += n
+		}
+		s.Fetched += cs.Fetched
+		s.Queued += cs.Queued
+		s.Errors += cs.Errors
+		s.Fresh += cs.Fresh
+		s.Rate += cs.Rate
+		for status, count := range cs.StatusCount {
+			s.StatusCount[status] += count
+		}
+	}
+	_, _, _, s.Total = f.counts()
+	s.Paused = f.isPaused()
+	s.ElapsedMs = now.Sub(f.start).Milliseconds()
+	return s
+}
+
+func (f *fleet) requestRate(now, since time.Time) float64 {
+	var rate float64
+	for _, c := range f.crawlers {
+		rate += c.requestRate(now, since)
+	}
+	return rate
+}
+
+// concurrency sums the current limits of the sites tuned with -c auto.
+func (f *fleet) concurrency() int {
+	n := 0
+	for _, c := range f.crawlers {
+		n += c.concurrency()
+	}
+	return n
+}
+
+func (f *fleet) active() int64 {
+	var n int64
+	for _, c := range f.crawlers {
+		n += c.active()
+	}
+	return n
+}
+
+func (f *fleet) pause() {
+	for _, c := range f.crawlers {
+		c.pause()
+	}
+}
+
+func (f *fleet) resume() {
+	for _, c := range f.crawlers {
+		c.resume()
+	}
+}
+
+func (f *fleet) stop() {
+	for _, c := range f.crawlers {
+		c.stop()
+	}
+}
+
+func (f *fleet) skipHost(host string) int {
+	n := 0
+	for _, c := range f.crawlers {
+		n += c.skipHost(host)
+	}
+	return n
+}
+
+func (f *fleet) isPaused() bool {
+	for _, c := range f.crawlers {
+		if !c.isPaused() {
+			return false
+		}
+	}
+	return len(f.crawlers) > 0
+}
+
+// logArgs prefixes log attributes with the site name in a multi-site run.
+func (c *Crawler) logArgs(args ...any) []any {
+	if c.Name == "" {
+		return args
+	}
+	return append([]any{"site", c.Name}, args...)
+}
+
+// runSites runs the crawlers, at most parallel at a time, calling done after
+// each one finishes. Every site runs to completion regardless of how the
+// others fare.
+func runSites(crawlers []*Crawler, parallel int, done func(*Crawler)) {
+	if parallel < 1 {
+		parallel = 1
+	}
+	sem := make(chan struct{}, parallel)
+
+	var wg sync.WaitGroup
+	for _, c := range crawlers {
+		wg.Add(1)
+		go func(c *Crawler) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			c.Run()
+			if c.Verify {
+				c.verify()
+			}
+			done(c)
+		}(c)
+	}
+	wg.Wait()
+}
+
+// rollup combines the results of the site crawlers into one crawler that
+// the report, output and notifications are produced from. The per-site
+// crawlers stay available through its sites field.
+func rollup(cfg Config, crawlers []*Crawler) (*Crawler, error) {
+	for _, c := range crawlers {
+		cfg.LowMemory = cfg.LowMemory || c.LowMemory
+	}
+	r, err := NewCrawler(cfg)
+	if err != nil {
+		return nil, err
+	}
+	r.sites = crawlers
+	r.budget = crawlers[0].budget
+	r.proxies = crawlers[0].proxies
+	r.seed = crawlers[0].seed
+	r.runID = crawlers[0].runID
+
+	for _, c := range crawlers {
+		if r.results != nil {
+			for key, res := range c.results {
+				r.results[key] = res
+			}
+		}
+		r.stats.merge(c.stats)
+		r.throughput.peak = max(r.throughput.peak, c.throughput.peakRate())
+		r.failedSitemaps = append(r.failedSitemaps, c.failedSitemaps...)
+		r.openAPISkipped = append(r.openAPISkipped, c.openAPISkipped...)
+		if c.seed != crawlers[0].seed {
+			// The sites were sampled or shuffled with seeds of their own.
+			r.seed = 0
+		}
+		if r.started.IsZero() || c.started.Before(r.started) {
+			r.started = c.started
+		}
+		if c.finished.After(r.finished) {
+			r.finished = c.finished
+		}
+		r.linksDiscovered += c.linksDiscovered
+		// The sites run side by side, so their concurrency adds up.
+		r.concurrencyPeak += c.concurrencyPeak
+		r.concurrencyAverage += c.concurrencyAverage
+		r.breakerTrips += c.breakerTrips
+		r.savedFiles += c.savedFiles
+		r.savedBytes += c.savedBytes
+		r.warcResponses += c.warcResponses
+		r.conditionalRequests += c.conditionalRequests
+		r.authAborted = r.authAborted || c.authAborted
+		if tw := c.traffic; tw != nil {
+			if r.traffic == nil {
+				r.traffic = &trafficWeights{}
+			}
+			r.traffic.total += tw.total
+			r.traffic.warmed += tw.warmed
+		}
+		if ch := c.changes; ch != nil {
+			if r.changes == nil {
+				r.changes = &contentChanges{}
+			}
+			r.changes.changed = append(r.changes.changed, ch.changed...)
+			r.changes.added = append(r.changes.added, ch.added...)
+			r.changes.removed = append(r.changes.removed, ch.removed...)
+			r.changes.sort()
+		}
+		if bc := c.regressions; bc != nil {
+			if r.regressions == nil {
+				r.regressions = &baselineComparison{}
+			}
+			r.regressions.regressed = append(r.regressions.regressed, bc.regressed...)
+			r.regressions.added = append(r.regressions.added, bc.added...)
+			r.regressions.sort()
+		}
+		r.breakerOpen += c.breakerOpen
+		r.sampledOut += c.sampledOut
+		if throttled := c.traps.list(); len(throttled) > 0 {
+			if r.traps == nil {
+				r.traps = loadedTraps(throttled)
+			} else {
+				r.traps.add(throttled)
+			}
+		}
+		r.sitemapAvailable += c.sitemapAvailable
+		r.sitemapSelected += c.sitemapSelected
+		r.redirectLoops = append(r.redirectLoops, c.redirectLoops...)
+		for host, n := range c.skippedHosts {
+			if r.skippedHosts == nil {
+				r.skippedHosts = make(map[string]int)
+			}
+			r.skippedHosts[host] += n
+		}
+		if c.external != nil {
+			if r.external == nil {
+				r.external = newExternalChecker(nil, 1, 0)
+			}
+			r.external.merge(c.external)
+		}
+		if r.inlinks != nil {
+			maps.Copy(r.inlinks, c.inlinks)
+		}
+		if c.sitemapURLs != nil {
+			if r.sitemapURLs == nil {
+				r.sitemapURLs = make(map[string]string)
+			}
+			maps.Copy(r.sitemapURLs, c.sitemapURLs)
+		}
+		for _, p := range c.hosts.peaks() {
+			r.hosts.peak[p.Host] = max(r.hosts.peak[p.Host], p.Peak)
+		}
+		if c.verification != nil {
+			if r.verification == nil {
+				r.verification = &verification{header: c.verification.header}
+			}
+			r.verification.merge(c.verification)
+		}
+	}
+	return r, nil
+}
+
+// siteSummaries returns the JSON summary of each site of a roll-up.
+func (c *Crawler) siteSummaries() []jsonSummary {
+	var res []jsonSummary
+	for _, s := range c.sites {
+		res = append(res, s.jsonSummary(s.elapsed))
+	}
+	return res
+}
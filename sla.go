@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// latencyCheck is the outcome of one of the -assert-* latency assertions.
+type latencyCheck struct {
+	Name     string
+	Limit    time.Duration
+	Measured time.Duration
+	Passed   bool
+}
+
+// checkLatency evaluates the configured latency assertions over the
+// successful responses, using the same recorder as the summary percentiles.
+// With no successful responses every assertion fails.
+func (c *Crawler) checkLatency() []latencyCheck {
+	lat := c.stats.latency
+	assertions := []struct {
+		name     string
+		limit    time.Duration
+		measured func() time.Duration
+	}{
+		{"p95", c.AssertP95, func() time.Duration { return lat.quantile(0.95) }},
+		{"p99", c.AssertP99, func() time.Duration { return lat.quantile(0.99) }},
+		{"mean", c.AssertMean, func() time.Duration { return lat.sum() / time.Duration(lat.count()) }},
+	}
+
+	var checks []latencyCheck
+	for _, a := range assertions {
+		if a.limit <= 0 {
+			continue
+		}
+		check := latencyCheck{Name: a.name, Limit: a.limit}
+		if lat.count() > 0 {
+			check.Measured = a.measured()
+			check.Passed = check.Measured <= a.limit
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// latencyFailed reports whether any of the checks failed.
+func latencyFailed(checks []latencyCheck) bool {
+	for _, check := range checks {
+		if !check.Passed {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Crawler) writeLatencyChecks(w io.Writer, checks []latencyCheck, color func(c, s string) string) {
+	fmt.Fprintln(w, "\nLatency assertions:")
+	for _, check := range checks {
+		line := fmt.Sprintf("  PASS %s %v <= %v", check.Name, check.Measured.Round(time.Millisecond), check.Limit)
+		switch {
+		case c.stats.latency.count() == 0:
+			line = fmt.Sprintf("  FAIL %s: no successful responses", check.Name)
+		case !check.Passed:
+			line = fmt.Sprintf("  FAIL %s %v > %v", check.Name, check.Measured.Round(time.Millisecond), check.Limit)
+		}
+		if !check.Passed {
+			line = color(colorRed, line)
+		}
+		fmt.Fprintln(w, line)
+	}
+}
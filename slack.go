@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Values accepted by -notify-on.
+const (
+	notifyAll    = "all"
+	notifyErrors = "errors"
+	notifyNever  = "never"
+)
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type string     `json:"type"`
+	Text *slackText `json:"text,omitempty"`
+}
+
+type slackMessage struct {
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+// shouldNotify reports whether a run with the given failures should be
+// announced according to the -notify-on setting.
+func shouldNotify(notifyOn string, failures int) bool {
+	switch notifyOn {
+	case notifyAll:
+		return true
+	case notifyErrors:
+		return failures > 0
+	}
+	return false
+}
+
+// newSlackMessage formats the run summary using Slack's block kit, listing up
+// to maxFailures of the failed pages.
+func newSlackMessage(p webhookPayload, maxFailures int) slackMessage {
+	s := p.Summary
+	failures := len(p.Errors)
+
+	title := fmt.Sprintf("Cache warming finished: %d pages in %v", s.TotalPages, msDuration(s.CrawlTimeMs))
+	icon := ":white_check_mark:"
+	if failures > 0 {
+		title = fmt.Sprintf("Cache warming found %d failing pages out of %d", failures, s.TotalPages)
+		icon = ":warning:"
+	}
+
+	var statuses []int
+	for code := range s.StatusCount {
+		n, _ := strconv.Atoi(code)
+		statuses = append(statuses, n)
+	}
+	sort.Ints(statuses)
+	var breakdown strings.Builder
+	for _, status := range statuses {
+		fmt.Fprintf(&breakdown, "• `%d`: %d\n", status, s.StatusCount[strconv.Itoa(status)])
+	}
+	if s.Errors > 0 {
+		fmt.Fprintf(&breakdown, "• request errors: %d\n", s.Errors)
+	}
+
+	msg := slackMessage{
+		Text: title,
+		Blocks: []slackBlock{
+			{Type: "header", Text: &slackText{Type: "plain_text", Text: title}},
+			{Type: "section", Text: &slackText{Type: "mrkdwn", Text: fmt.Sprintf(
+				"%s *%d* pages crawled in *%v* (run `%s`)\n*Status breakdown*\n%s",
+				icon, s.TotalPages, msDuration(s.CrawlTimeMs), p.RunID, breakdown.String())}},
+		},
+	}
+
+	if failures > 0 && maxFailures > 0 {
+		var list strings.Builder
+		list.WriteString("*Failing pages*\n")
+		for i, page := range p.Errors {
+			if i == maxFailures {
+				fmt.Fprintf(&list, "…and %d more\n", failures-maxFailures)
+				break
+			}
+			reason := strconv.Itoa(page.StatusCode)
+			if page.Error != "" {
+				reason = page.Error
+			}
+			fmt.Fprintf(&list, "• <%s> — %s\n", page.URL, reason)
+		}
+		msg.Blocks = append(msg.Blocks, slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: list.String()}})
+	}
+
+	return msg
+}
+
+func postSlack(webhookURL string, msg slackMessage, timeout time.Duration) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: timeout}
+	res, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+func msDuration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond)).Round(time.Millisecond)
+}
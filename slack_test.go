@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSlackMessageSuccess(t *testing.T) {
+	p := webhookPayload{
+		RunID: "20240101T000000Z-abcd",
+		Summary: jsonSummary{
+			CrawlTimeMs: 61500,
+			TotalPages:  120,
+			StatusCount: map[string]int{"301": 2, "200": 118},
+		},
+	}
+	msg := newSlackMessage(p, 10)
+
+	if want := "Cache warming finished: 120 pages in 1m1.5s"; msg.Text != want {
+		t.Errorf("text %q, want %q", msg.Text, want)
+	}
+	if len(msg.Blocks) != 2 {
+		t.Fatalf("%d blocks, want a header and a summary", len(msg.Blocks))
+	}
+	if msg.Blocks[0].Type != "header" || msg.Blocks[0].Text.Text != msg.Text {
+		t.Errorf("header block %+v, want the title", msg.Blocks[0])
+	}
+	want := ":white_check_mark: *120* pages crawled in *1m1.5s* (run `20240101T000000Z-abcd`)\n" +
+		"*Status breakdown*\n• `200`: 118\n• `301`: 2\n"
+	if got := msg.Blocks[1].Text.Text; got != want {
+		t.Errorf("summary block\n%q\nwant\n%q", got, want)
+	}
+	if msg.Blocks[1].Text.Type != "mrkdwn" {
+		t.Errorf("summary block of type %q, want mrkdwn", msg.Blocks[1].Text.Type)
+	}
+}
+
+func TestSlackMessageFailures(t *testing.T) {
+	p := webhookPayload{
+		RunID: "run",
+		Summary: jsonSummary{
+			CrawlTimeMs: 2000,
+			TotalPages:  10,
+			Errors:      1,
+			StatusCount: map[string]int{"200": 6, "404": 2, "500": 1},
+		},
+		Errors: []webhookPage{
+			{URL: "https://example.com/a", StatusCode: 404},
+			{URL: "https://example.com/b", StatusCode: 404},
+			{URL: "https://example.com/c", StatusCode: 500},
+			{URL: "https://example.com/d", Error: "connection refused"},
+		},
+	}
+	msg := newSlackMessage(p, 2)
+
+	if want := "Cache warming found 4 failing pages out of 10"; msg.Text != want {
+		t.Errorf("text %q, want %q", msg.Text, want)
+	}
+	if len(msg.Blocks) != 3 {
+		t.Fatalf("%d blocks, want a header, a summary and the failures", len(msg.Blocks))
+	}
+	summary := msg.Blocks[1].Text.Text
+	for _, want := range []string{":warning:", "• `404`: 2", "• `500`: 1", "• request errors: 1"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary block %q doesn't contain %q", summary, want)
+		}
+	}
+	want := "*Failing pages*\n" +
+		"• <https://example.com/a> — 404\n" +
+		"• <https://example.com/b> — 404\n" +
+		"…and 2 more\n"
+	if got := msg.Blocks[2].Text.Text; got != want {
+		t.Errorf("failures block\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestShouldNotify(t *testing.T) {
+	tests := []struct {
+		notifyOn string
+		failures int
+		want     bool
+	}{
+		{notifyAll, 0, true},
+		{notifyErrors, 0, false},
+		{notifyErrors, 1, true},
+		{notifyNever, 1, false},
+	}
+	for _, tt := range tests {
+		if got := shouldNotify(tt.notifyOn, tt.failures); got != tt.want {
+			t.Errorf("shouldNotify(%q, %d) = %v, want %v", tt.notifyOn, tt.failures, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+// defaultSoft404Pattern matches the phrases not-found pages commonly use.
+const defaultSoft404Pattern = `(?i)page not found|404 not found|could not be found|can't be found|no longer (exists|available)|doesn't exist|does not exist`
+
+// soft404Detector recognizes pages answered with 200 that are really "not
+// found" pages, by their text, by an element only those pages have or by
+// their size.
+type soft404Detector struct {
+	pattern  *regexp.Regexp
+	selector cascadia.Selector
+	minSize  int64
+
+	// selectorText is the selector as configured, for the report.
+	selectorText string
+}
+
+// newSoft404Detector returns the detector configured by cfg, or nil without
+// -soft-404.
+func newSoft404Detector(cfg Config) (*soft404Detector, error) {
+	if !cfg.Soft404 {
+		return nil, nil
+	}
+	d := &soft404Detector{minSize: cfg.Soft404MinSize, selectorText: cfg.Soft404Selector}
+	var err error
+	if cfg.Soft404Pattern != "" {
+		if d.pattern, err = regexp.Compile(cfg.Soft404Pattern); err != nil {
+			return nil, fmt.Errorf("pattern: %w", err)
+		}
+	}
+	if cfg.Soft404Selector != "" {
+		if d.selector, err = cascadia.Compile(cfg.Soft404Selector); err != nil {
+			return nil, fmt.Errorf("selector: %w", err)
+		}
+	}
+	return d, nil
+}
+
+// check returns why the page parsed into doc, whose body was size bytes,
+// looks like a "not found" page, or "" if it doesn't.
+func (d *soft404Detector) check(doc *goquery.Document, size int64) string {
+	if d.selector != nil && doc.FindMatcher(d.selector).Length() > 0 {
+		return "has " + d.selectorText
+	}
+	if d.pattern != nil {
+		text := doc.Find("title").Text() + " " + doc.Find("h1, h2").Text()
+		if m := d.pattern.FindString(text); m != "" {
+			return fmt.Sprintf("says %q", strings.TrimSpace(m))
+		}
+	}
+	if size < d.minSize {
+		return fmt.Sprintf("body of only %d bytes", size)
+	}
+	return ""
+}
+
+// soft404s returns the results that look like "not found" pages, sorted by
+// URL.
+func (c *Crawler) soft404s() []Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var res []Result
+	for _, r := range c.results {
+		if r.Soft404 != "" {
+			res = append(res, r)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return resultKey(res[i]) < resultKey(res[j]) })
+	return res
+}
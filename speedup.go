@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// measureSpeedup fetches the URL of r a second time, with the same headers
+// as the first, after SpeedupDelay, and records how much faster it was.
+func (c *Crawler) measureSpeedup(ctx context.Context, r *Result, header http.Header) {
+	if c.SpeedupDelay > 0 {
+		timer := time.NewTimer(c.SpeedupDelay)
+		select {
+		case <-timer.C:
+		case <-c.runCtx.Done():
+			timer.Stop()
+			return
+		}
+	}
+	c.limiter.wait(c.runCtx)
+
+	start := time.Now()
+	res, err := c.sendRequest(ctx, r.URL, header)
+	responseTime := time.Since(start)
+	if err != nil {
+		slog.Warn("second fetch failed", "url", r.URL, "error", err)
+		return
+	}
+	c.drainAndClose(res.Body, res.Body)
+
+	r.SecondResponseTime = max(responseTime, time.Microsecond)
+	r.Speedup = float64(r.ResponseTime) / float64(r.SecondResponseTime)
+	slog.Debug("fetched again", "url", r.URL, "status", res.StatusCode, "duration", responseTime, "speedup", r.Speedup)
+}
+
+// noSpeedup returns the results whose second fetch was no faster than the
+// first, sorted by URL.
+func (c *Crawler) noSpeedup() []Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var res []Result
+	for _, r := range c.results {
+		if r.SecondResponseTime > 0 && r.Speedup <= 1 {
+			res = append(res, r)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return resultKey(res[i]) < resultKey(res[j]) })
+	return res
+}
@@ -0,0 +1,173 @@
+package main
+
+import "sort"
+
+// URL states. A URL is queued from when it is discovered until a worker
+// starts fetching it, and is done or failed after that. URLs still queued
+// when the crawl ends were never attempted, e.g. because a limit was hit.
+const (
+	stateQueued   = "queued"
+	stateInFlight = "in_flight"
+	stateDone     = "done"
+	stateFailed   = "failed"
+	stateFresh    = "skipped_fresh"
+	// Links left out by -crawl-sample are never queued.
+	stateSampledOut = "sampled_out"
+	// Links left out by -trap-detection are never queued either.
+	stateTrapped = "trapped"
+)
+
+// state returns the state of a URL with result r.
+func (r Result) state() string {
+	switch {
+	case r.Fresh:
+		return stateFresh
+	case r.Err != nil:
+		return stateFailed
+	}
+	return stateDone
+}
+
+// stateCounts breaks the URLs discovered so far down by state. Results
+// loaded with `gowarmer report` have no queued or in-flight URLs.
+func (c *Crawler) stateCounts() map[string]int {
+	if len(c.sites) > 0 {
+		counts := make(map[string]int)
+		for _, s := range c.sites {
+			for state, n := range s.stateCounts() {
+				counts[state] += n
+			}
+		}
+		return counts
+	}
+
+	inFlight := int(c.inFlight.Load())
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	counts := map[string]int{
+		stateDone:     c.stats.pages - c.stats.errors,
+		stateFailed:   c.stats.errors,
+		stateFresh:    c.stats.fresh,
+		stateInFlight: inFlight,
+	}
+	attempted := c.stats.pages + c.stats.fresh + inFlight
+	trapped := c.traps.suppressed()
+	if queued := c.seen.len() - c.otherShard - c.sampledOut - trapped - attempted; queued > 0 {
+		counts[stateQueued] = queued
+	}
+	if c.sampledOut > 0 {
+		counts[stateSampledOut] = c.sampledOut
+	}
+	if trapped > 0 {
+		counts[stateTrapped] = trapped
+	}
+	return counts
+}
+
+// Orders of the detailed report and the JSON results: by URL, by status
+// and then URL, or slowest first.
+const (
+	sortURL    = "url"
+	sortStatus = "status"
+	sortTime   = "time"
+)
+
+func validSort(s string) bool {
+	switch s {
+	case "", sortURL, sortStatus, sortTime:
+		return true
+	}
+	return false
+}
+
+// sortedResults returns the results in the order of Sort, by URL unless
+// another is chosen, so that identical runs list them identically.
+func (c *Crawler) sortedResults() []Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	res := make([]Result, 0, len(c.results))
+	for _, r := range c.results {
+		res = append(res, r)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		a, b := res[i], res[j]
+		switch {
+		case c.Sort == sortStatus && a.StatusCode != b.StatusCode:
+			return a.StatusCode < b.StatusCode
+		case c.Sort == sortTime && a.ResponseTime != b.ResponseTime:
+			return a.ResponseTime > b.ResponseTime
+		}
+		return resultKey(a) < resultKey(b)
+	})
+	return res
+}
+
+// offHostRedirects returns the results that were redirected off-host,
+// sorted by URL.
+func (c *Crawler) offHostRedirects() []Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var res []Result
+	for _, r := range c.results {
+		if r.OffHost {
+			res = append(res, r)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return resultKey(res[i]) < resultKey(res[j]) })
+	return res
+}
+
+// slowPages returns the results slower than the slow threshold, slowest
+// first.
+func (c *Crawler) slowPages() []Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var res []Result
+	for _, r := range c.results {
+		if r.Slow {
+			res = append(res, r)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].ResponseTime != res[j].ResponseTime {
+			return res[i].ResponseTime > res[j].ResponseTime
+		}
+		return resultKey(res[i]) < resultKey(res[j])
+	})
+	return res
+}
+
+// uncompressed returns the responses that should have been compressed but
+// weren't, the largest first.
+func (c *Crawler) uncompressed() []Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var res []Result
+	for _, r := range c.results {
+		if r.Uncompressed {
+			res = append(res, r)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Size != res[j].Size {
+			return res[i].Size > res[j].Size
+		}
+		return resultKey(res[i]) < resultKey(res[j])
+	})
+	return res
+}
+
+// failures returns the results that failed with an error, sorted by URL.
+func (c *Crawler) failures() []Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var res []Result
+	for _, r := range c.results {
+		if r.state() == stateFailed {
+			res = append(res, r)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return resultKey(res[i]) < resultKey(res[j]) })
+	return res
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// stats holds the running aggregates the summary is computed from, so the
+// report doesn't depend on keeping every result in memory.
+type stats struct {
+	pages  int
+	fresh  int
+	errors int
+
+	// bytes is the size of the response bodies received.
+	bytes int64
+
+	offHost int
+
+	// headerViolations counts the pages violating the header requirements.
+	headerViolations int
+	// assertionFailures counts the pages failing a content assertion, and
+	// assertionsNotEvaluated those it couldn't be checked on.
+	assertionFailures      int
+	assertionsNotEvaluated int
+
+	// uncompressed counts the responses that should have been compressed,
+	// and compressionWaste the bytes that compressing them would have
+	// saved.
+	uncompressed     int
+	compressionWaste int64
+
+	// seoIssues counts the audited pages with SEO issues.
+	seoIssues int
+
+	// soft404 counts the pages that look like "not found" pages.
+	soft404 int
+
+	// mixedContent counts the pages with mixed content.
+	mixedContent int
+
+	// slow counts the pages slower than the slow threshold, and oversize
+	// those larger than the page size limit.
+	slow     int
+	oversize int
+
+	// noindex counts the pages marked noindex, and noindexStatus breaks
+	// them down by status.
+	noindex       int
+	noindexStatus map[int]int
+
+	// throttled counts the 429 responses, retried or not, retries the
+	// requests that were retried and recovered the URLs that succeeded
+	// after being retried.
+	throttled int
+	retries   int
+	recovered int
+
+	// variantRequests counts the requests made for variants, and
+	// repeatRequests those made to fetch URLs again with -repeat.
+	variantRequests int
+	repeatRequests  int
+
+	// multiAttempt counts the URLs that took more than one attempt.
+	multiAttempt int
+
+	// alternates counts the alternate format pages found with
+	// -alternates, amp the AMP ones among them.
+	alternates int
+	amp        int
+
+	// assets counts the sitemap images and videos warmed with
+	// -sitemap-assets, assetFailures those that failed.
+	assets        int
+	assetFailures int
+
+	// apis counts the API requests of -openapi, apiFailures those that
+	// failed.
+	apis        int
+	apiFailures int
+
+	purged        int
+	purgeFailures int
+	purgeTime     time.Duration
+
+	// speedups counts the URLs fetched twice, speedupSum adds up how much
+	// faster the second fetch was and noSpeedup counts those it wasn't.
+	speedups   int
+	speedupSum float64
+	noSpeedup  int
+
+	statusCount map[int]int
+	errorClass  map[string]int
+	latency     latencyRecorder
+
+	// protocols counts the responses by protocol with -http3, and
+	// http3Fallbacks those that weren't over HTTP/3.
+	protocols      map[string]int
+	http3Fallbacks int
+
+	// phases are the durations of the phases of the requests timed with
+	// -timings, timed the number of those requests and reusedConns the
+	// ones that went over a connection already open.
+	phases      map[string]latencyRecorder
+	timed       int
+	reusedConns int
+}
+
+func newStats(lowMemory bool) *stats {
+	s := &stats{
+		statusCount:   make(map[int]int),
+		errorClass:    make(map[string]int),
+		noindexStatus: make(map[int]int),
+		protocols:     make(map[string]int),
+	}
+	if lowMemory {
+		s.latency = newLatencyHistogram()
+	} else {
+		s.latency = &exactLatencies{}
+	}
+	return s
+}
+
+func (s *stats) add(r Result) {
+	if r.Purged {
+		s.purged++
+		s.purgeTime += r.PurgeTime
+		if r.PurgeErr != nil {
+			s.purgeFailures++
+		}
+	}
+	if r.Fresh {
+		s.fresh++
+		return
+	}
+	if r.OffHost {
+		s.offHost++
+	}
+	if r.Attempts > 1 {
+		s.multiAttempt++
+	}
+	s.pages++
+	s.bytes += r.Size
+	if r.Asset != "" {
+		s.assets++
+		if r.Err != nil || r.StatusCode >= 400 {
+			s.assetFailures++
+		}
+	}
+	if r.API {
+		s.apis++
+		if r.Err != nil || r.StatusCode >= 400 {
+			s.apiFailures++
+		}
+	}
+	if r.Alternate != "" {
+		s.alternates++
+		if r.Alternate == alternateAMP {
+			s.amp++
+		}
+	}
+	if r.Err != nil {
+		s.errors++
+		if r.ErrClass != "" {
+			s.errorClass[r.ErrClass]++
+		}
+		return
+	}
+	s.statusCount[r.StatusCode]++
+	if r.Protocol != "" {
+		s.protocols[r.Protocol]++
+		if r.HTTP3Fallback {
+			s.http3Fallbacks++
+		}
+	}
+	if r.Slow {
+		s.slow++
+	}
+	if r.Oversize {
+		s.oversize++
+	}
+	if len(r.HeaderViolations) > 0 {
+		s.headerViolations++
+	}
+	if failed, notEvaluated := assertionCounts(r); failed {
+		s.assertionFailures++
+	} else if notEvaluated {
+		s.assertionsNotEvaluated++
+	}
+	if len(r.MixedContent) > 0 {
+		s.mixedContent++
+	}
+	if r.Soft404 != "" {
+		s.soft404++
+	}
+	if r.Uncompressed {
+		s.uncompressed++
+		s.compressionWaste += r.Size - r.GzipEstimate
+	}
+	if r.SEO != nil && len(r.SEO.issues()) > 0 {
+		s.seoIssues++
+	}
+	s.variantRequests += len(r.Variants)
+	if r.Repeat != nil {
+		s.repeatRequests += r.Repeat.Count - 1
+	}
+	if r.SecondResponseTime > 0 {
+		s.speedups++
+		s.speedupSum += r.Speedup
+		if r.Speedup <= 1 {
+			s.noSpeedup++
+		}
+	}
+	if r.NoIndex {
+		s.noindex++
+		s.noindexStatus[r.StatusCode]++
+	}
+	s.latency.record(r.ResponseTime)
+	if t := r.Timings; t != nil {
+		s.timed++
+		if t.Reused {
+			s.reusedConns++
+		}
+		for _, phase := range phases {
+			if d := t.get(phase); d > 0 {
+				s.phase(phase).record(d)
+			}
+		}
+	}
+	if r.Attempts > 1 && r.StatusCode < 400 {
+		s.recovered++
+	}
+}
+
+// merge adds the aggregates of o to s.
+func (s *stats) merge(o *stats) {
+	s.pages += o.pages
+	s.bytes += o.bytes
+	s.fresh += o.fresh
+	s.offHost += o.offHost
+	s.noindex += o.noindex
+	s.slow += o.slow
+	s.oversize += o.oversize
+	s.headerViolations += o.headerViolations
+	s.assertionFailures += o.assertionFailures
+	s.assertionsNotEvaluated += o.assertionsNotEvaluated
+	s.mixedContent += o.mixedContent
+	s.soft404 += o.soft404
+	s.seoIssues += o.seoIssues
+	s.uncompressed += o.uncompressed
+	s.compressionWaste += o.compressionWaste
+	s.throttled += o.throttled
+	s.retries += o.retries
+	s.recovered += o.recovered
+	s.multiAttempt += o.multiAttempt
+	s.variantRequests += o.variantRequests
+	s.repeatRequests += o.repeatRequests
+	s.alternates += o.alternates
+	s.amp += o.amp
+	s.assets += o.assets
+	s.assetFailures += o.assetFailures
+	s.apis += o.apis
+	s.apiFailures += o.apiFailures
+	s.errors += o.errors
+	s.purged += o.purged
+	s.purgeFailures += o.purgeFailures
+	s.purgeTime += o.purgeTime
+	s.speedups += o.speedups
+	s.speedupSum += o.speedupSum
+	s.noSpeedup += o.noSpeedup
+	for status, count := range o.statusCount {
+		s.statusCount[status] += count
+	}
+	for status, count := range o.noindexStatus {
+		s.noindexStatus[status] += count
+	}
+	for class, count := range o.errorClass {
+		s.errorClass[class] += count
+	}
+	for proto, count := range o.protocols {
+		s.protocols[proto] += count
+	}
+	s.http3Fallbacks += o.http3Fallbacks
+	mergeLatency(s.latency, o.latency)
+	s.timed += o.timed
+	s.reusedConns += o.reusedConns
+	for phase, lat := range o.phases {
+		mergeLatency(s.phase(phase), lat)
+	}
+}
+
+// phase returns the recorder of the durations of phase, of the same kind
+// as the one of the response times.
+func (s *stats) phase(phase string) latencyRecorder {
+	if lat := s.phases[phase]; lat != nil {
+		return lat
+	}
+	if s.phases == nil {
+		s.phases = make(map[string]latencyRecorder)
+	}
+	var lat latencyRecorder = &exactLatencies{}
+	if _, ok := s.latency.(*latencyHistogram); ok {
+		lat = newLatencyHistogram()
+	}
+	s.phases[phase] = lat
+	return lat
+}
+
+// mergeLatency records the samples of src in dst.
+func mergeLatency(dst, src latencyRecorder) {
+	switch l := src.(type) {
+	case *exactLatencies:
+		for _, d := range l.values {
+			dst.record(d)
+		}
+	case *latencyHistogram:
+		if h, ok := dst.(*latencyHistogram); ok {
+			h.add(l)
+			break
+		}
+		// Only the bucket values are left, which still beats dropping
+		// the samples.
+		for i, c := range l.counts {
+			for ; c > 0; c-- {
+				dst.record(bucketValue(i))
+			}
+		}
+	}
+}
+
+// latencyRecorder collects response times and answers quantile queries.
+type latencyRecorder interface {
+	record(d time.Duration)
+	quantile(q float64) time.Duration
+	count() int
+	sum() time.Duration
+	approximate() bool
+}
+
+// exactLatencies keeps every sample and computes exact quantiles.
+type exactLatencies struct {
+	values []time.Duration
+	sorted bool
+	total  time.Duration
+}
+
+func (e *exactLatencies) record(d time.Duration) {
+	e.values = append(e.values, d)
+	e.sorted = false
+	e.total += d
+}
+
+func (e *exactLatencies) quantile(q float64) time.Duration {
+	if len(e.values) == 0 {
+		return 0
+	}
+	if !e.sorted {
+		sort.Slice(e.values, func(i, j int) bool { return e.values[i] < e.values[j] })
+		e.sorted = true
+	}
+	return e.values[rank(q, len(e.values))]
+}
+
+func (e *exactLatencies) count() int { return len(e.values) }
+
+func (e *exactLatencies) sum() time.Duration { return e.total }
+
+func (e *exactLatencies) approximate() bool { return false }
+
+// rank returns the nearest-rank index of quantile q in n sorted samples.
+func rank(q float64, n int) int {
+	i := int(math.Ceil(q*float64(n))) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= n {
+		i = n - 1
+	}
+	return i
+}
+
+// histogramGrowth is the ratio between neighbouring bucket bounds. Quantiles
+// reported by latencyHistogram are within 1% of the true sample value.
+const histogramGrowth = 1.02
+
+// latencyHistogram is a log-bucketed histogram over microseconds. It uses a
+// fixed amount of memory regardless of the number of samples, at the cost of
+// quantiles being approximate.
+type latencyHistogram struct {
+	counts []uint64
+	n      int
+	total  time.Duration
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{}
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	i := 0
+	if us := float64(d.Microseconds()); us > 1 {
+		i = int(math.Log(us) / math.Log(histogramGrowth))
+	}
+	for len(h.counts) <= i {
+		h.counts = append(h.counts, 0)
+	}
+	h.counts[i]++
+	h.n++
+	h.total += d
+}
+
+func (h *latencyHistogram) quantile(q float64) time.Duration {
+	if h.n == 0 {
+		return 0
+	}
+	target := uint64(rank(q, h.n)) + 1
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= target {
+			return bucketValue(i)
+		}
+	}
+	return 0
+}
+
+// add merges the samples of o into h.
+func (h *latencyHistogram) add(o *latencyHistogram) {
+	for len(h.counts) < len(o.counts) {
+		h.counts = append(h.counts, 0)
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	h.n += o.n
+	h.total += o.total
+}
+
+// bucketValue returns the geometric middle of bucket i.
+func bucketValue(i int) time.Duration {
+	us := math.Pow(histogramGrowth, float64(i)+0.5)
+	return time.Duration(us * float64(time.Microsecond))
+}
+
+func (h *latencyHistogram) count() int { return h.n }
+
+func (h *latencyHistogram) sum() time.Duration { return h.total }
+
+func (h *latencyHistogram) approximate() bool { return true }
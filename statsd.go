@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statsdClient sends metrics over UDP. Send errors are ignored: metrics are
+// best effort and must never slow down or fail the crawl.
+//
+// Metrics, all prefixed with "gowarmer.":
+//
+//	requests        counter per completed request, by status class (2xx..5xx, error)
+//	response_time   timer in milliseconds per completed request
+//	queue_depth     gauge of URLs waiting in the frontier
+//	in_flight       gauge of requests currently being fetched
+//
+// Without -statsd-tags the status class is appended to the metric name
+// (gowarmer.requests.2xx); with tags the DogStatsD tag extension is used
+// (gowarmer.requests:1|c|#status_class:2xx,env:prod).
+type statsdClient struct {
+	conn net.Conn
+	tags string
+}
+
+func newStatsdClient(addr string, tags []string) (*statsdClient, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdClient{conn: conn, tags: strings.Join(tags, ",")}, nil
+}
+
+func (s *statsdClient) send(name, value, kind string, tags ...string) {
+	line := "gowarmer." + name + ":" + value + "|" + kind
+	if s.tags != "" || len(tags) > 0 {
+		all := tags
+		if s.tags != "" {
+			all = append(all, s.tags)
+		}
+		line += "|#" + strings.Join(all, ",")
+	}
+	s.conn.Write([]byte(line))
+}
+
+func (s *statsdClient) result(r Result) {
+	class := "error"
+	if r.Err == nil {
+		class = fmt.Sprintf("%dxx", r.StatusCode/100)
+	}
+	if s.tags != "" {
+		s.send("requests", "1", "c", "status_class:"+class)
+	} else {
+		s.send("requests."+class, "1", "c")
+	}
+	s.send("response_time", strconv.FormatInt(r.ResponseTime.Milliseconds(), 10), "ms")
+}
+
+// reportGauges sends the queue depth and in-flight gauges every second until
+// stop is closed.
+func (s *statsdClient) reportGauges(m monitor, stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_, _, queued, _ := m.counts()
+			s.send("queue_depth", strconv.Itoa(queued), "g")
+			s.send("in_flight", strconv.FormatInt(m.active(), 10), "g")
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (s *statsdClient) close() {
+	s.conn.Close()
+}
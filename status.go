@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type statusResponse struct {
+	Fetched     int            `json:"fetched"`
+	Queued      int            `json:"queued"`
+	Errors      int            `json:"errors"`
+	Fresh       int            `json:"skipped_fresh,omitempty"`
+	StatusCount map[string]int `json:"status_count"`
+	Rate        float64        `json:"rps"`
+	ElapsedMs   int64          `json:"elapsed_ms"`
+	Total       int            `json:"total,omitempty"`
+	Paused      bool           `json:"paused,omitempty"`
+	States      map[string]int `json:"states"`
+}
+
+func (c *Crawler) status() statusResponse {
+	now := time.Now()
+	s := statusResponse{StatusCount: make(map[string]int)}
+
+	c.lock.Lock()
+	s.Fetched, s.Fresh, s.Errors = c.stats.pages, c.stats.fresh, c.stats.errors
+	for status, count := range c.stats.statusCount {
+		s.StatusCount[strconv.Itoa(status)] = count
+	}
+	if c.totalKnown.Load() {
+		s.Total = c.seen.len() - c.otherShard - c.sampledOut - c.traps.suppressed()
+	}
+	started := c.started
+	s.Paused = !c.pausedAt.IsZero()
+	c.lock.Unlock()
+
+	s.Queued = c.frontier.len()
+	s.States = c.stateCounts()
+	if !started.IsZero() {
+		s.Rate = c.rate.rate(now, started)
+		s.ElapsedMs = now.Sub(started).Milliseconds()
+	}
+	return s
+}
+
+// statusServer serves /status and /healthz while a crawl is running.
+type statusServer struct {
+	srv *http.Server
+}
+
+func startStatusServer(addr string, m monitor) (*statusServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(m.status())
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+
+	s := &statusServer{srv: &http.Server{Handler: mux}}
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			slog.Error("status server failed", "error", err)
+		}
+	}()
+	slog.Info("serving status", "addr", ln.Addr().String())
+	return s, nil
+}
+
+func (s *statusServer) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s.srv.Shutdown(ctx)
+}
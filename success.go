@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// successCodes is the set of statuses that count as a successful warm, given
+// with -success-codes as codes, ranges and classes, e.g. 200-204,2xx,304.
+// Without any, every status below 400 counts.
+type successCodes struct {
+	codes   map[int]bool
+	classes map[int]bool
+}
+
+func parseSuccessCodes(specs []string) (successCodes, error) {
+	var s successCodes
+	for _, spec := range specs {
+		spec = strings.ToLower(strings.TrimSpace(spec))
+		if class, ok := strings.CutSuffix(spec, "xx"); ok {
+			n, err := strconv.Atoi(class)
+			if err != nil || n < 1 || n > 5 {
+				return successCodes{}, fmt.Errorf("invalid status class %q", spec)
+			}
+			if s.classes == nil {
+				s.classes = make(map[int]bool)
+			}
+			s.classes[n] = true
+			continue
+		}
+		from, to, isRange := strings.Cut(spec, "-")
+		first, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil || first < 100 || first > 599 {
+			return successCodes{}, fmt.Errorf("invalid status code %q", spec)
+		}
+		last := first
+		if isRange {
+			last, err = strconv.Atoi(strings.TrimSpace(to))
+			if err != nil || last < first || last > 599 {
+				return successCodes{}, fmt.Errorf("invalid status range %q", spec)
+			}
+		}
+		if s.codes == nil {
+			s.codes = make(map[int]bool)
+		}
+		for code := first; code <= last; code++ {
+			s.codes[code] = true
+		}
+	}
+	return s, nil
+}
+
+// match reports whether a response with status code counts as a success.
+func (s successCodes) match(code int) bool {
+	if s.codes == nil && s.classes == nil {
+		return code < 400
+	}
+	return s.codes[code] || s.classes[code/100]
+}
+
+// color returns the color a status is shown in. Without -success-codes
+// that depends on its class, see statusColor; with them, successful statuses
+// are shown plainly and any other in red.
+func (s successCodes) color(code int) string {
+	switch {
+	case s.codes == nil && s.classes == nil:
+		return statusColor(code)
+	case s.match(code):
+		return ""
+	}
+	return colorRed
+}
+
+// resultColor returns the color r is shown in.
+func (s successCodes) resultColor(r Result) string {
+	switch {
+	case r.Err != nil:
+		return colorMagenta
+	case r.Fresh:
+		return ""
+	}
+	return s.color(r.StatusCode)
+}
+
+// unsuccessfulResults returns the results answered with a status that isn't
+// one of the success codes, sorted by URL.
+func (c *Crawler) unsuccessfulResults() []Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var res []Result
+	for _, r := range c.results {
+		// Authentication failures have a section of their own.
+		if r.Err == nil && !c.succeeded(r) && !authFailure(r.StatusCode) {
+			res = append(res, r)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return resultKey(res[i]) < resultKey(res[j]) })
+	return res
+}
+
+// succeeded reports whether r was warmed successfully: fetched without an
+// error and answered with one of the success codes. Pages marked noindex
+// are utility pages whose status doesn't matter.
+func (c *Crawler) succeeded(r Result) bool {
+	return r.Err == nil && (r.Fresh || r.NoIndex || c.success.match(r.StatusCode))
+}
+
+// unsuccessful returns the number of responses whose status isn't one of
+// the success codes, not counting pages marked noindex.
+func (c *Crawler) unsuccessful() int {
+	n := 0
+	for status, count := range c.stats.statusCount {
+		if !c.success.match(status) {
+			n += count - c.stats.noindexStatus[status]
+		}
+	}
+	return n
+}
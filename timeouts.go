@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// urlPattern is a pattern URLs are matched against, by -timeout-for and
+// the content assertions.
+type urlPattern struct {
+	pattern string
+	re      *regexp.Regexp
+	// path is set for globs starting with /, which are matched against the
+	// path of the URL rather than all of it.
+	path bool
+}
+
+// compileURLPattern compiles a pattern. It is a regular expression,
+// matched anywhere in the URL like -include, if it has any of the
+// characters ^$+()[]{}|\, and a glob otherwise: * matches any run of
+// characters, ? any one, and the glob has to match the whole path if it
+// starts with / or the whole URL otherwise.
+func compileURLPattern(pattern string) (urlPattern, error) {
+	p := urlPattern{pattern: pattern}
+	var err error
+	if strings.ContainsAny(pattern, `^$+()[]{}|\`) {
+		p.re, err = regexp.Compile(pattern)
+	} else {
+		p.re, err = regexp.Compile(globRegexp(pattern))
+		p.path = strings.HasPrefix(pattern, "/")
+	}
+	return p, err
+}
+
+// timeoutRule is a -timeout-for override: requests for URLs matching the
+// pattern get timeout instead of -timeout.
+type timeoutRule struct {
+	urlPattern
+	timeout time.Duration
+	// hits counts the requests the rule applied to, so patterns that match
+	// nothing can be pointed out.
+	hits atomic.Int64
+}
+
+// parseTimeoutRules parses -timeout-for values of the form
+// "pattern=duration", with patterns as compileURLPattern takes them.
+func parseTimeoutRules(specs []string) ([]*timeoutRule, error) {
+	var rules []*timeoutRule
+	for _, spec := range specs {
+		i := strings.LastIndex(spec, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid timeout %q, expected pattern=duration", spec)
+		}
+		pattern := strings.TrimSpace(spec[:i])
+		timeout, err := time.ParseDuration(strings.TrimSpace(spec[i+1:]))
+		if err != nil || timeout <= 0 || pattern == "" {
+			return nil, fmt.Errorf("invalid timeout %q, expected pattern=duration", spec)
+		}
+		rule := &timeoutRule{timeout: timeout}
+		if rule.urlPattern, err = compileURLPattern(pattern); err != nil {
+			return nil, fmt.Errorf("invalid timeout %q: %w", spec, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// globRegexp returns an anchored regular expression matching what glob
+// matches.
+func globRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+func (r urlPattern) match(u string) bool {
+	if !r.path {
+		return r.re.MatchString(u)
+	}
+	parsed, err := url.Parse(u)
+	return err == nil && r.re.MatchString(parsed.Path)
+}
+
+// timeoutFor returns the timeout for a request for u: that of the first
+// -timeout-for rule it matches, or -timeout.
+func (c *Crawler) timeoutFor(u string) time.Duration {
+	for _, r := range c.timeouts {
+		if r.match(u) {
+			r.hits.Add(1)
+			return r.timeout
+		}
+	}
+	return c.Timeout
+}
+
+// withTimeout gives the request for u the deadline of its timeout when
+// there are -timeout-for rules; otherwise the client's timeout applies.
+// The deadline covers reading the body, so the context is only released
+// once the body is closed.
+func (c *Crawler) withTimeout(ctx context.Context, u string) (context.Context, context.CancelFunc) {
+	if len(c.timeouts) == 0 {
+		return ctx, func() {}
+	}
+	timeout := c.timeoutFor(u)
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// cancelOnClose is a response body that releases the context of its
+// request when closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// describeTimeout returns the limit a request for u that timed out was
+// held to, for the report.
+func (c *Crawler) describeTimeout(u string) string {
+	for _, r := range c.timeouts {
+		if r.match(u) {
+			return fmt.Sprintf("%v, -timeout-for %s", r.timeout, r.pattern)
+		}
+	}
+	return fmt.Sprintf("%v, -timeout", c.Timeout)
+}
+
+// warnUnusedTimeouts warns about the -timeout-for rules that applied to no
+// request, most likely because of a typo.
+func (c *Crawler) warnUnusedTimeouts() {
+	for _, r := range c.timeouts {
+		if r.hits.Load() == 0 {
+			slog.Warn("-timeout-for pattern matched no URL", c.logArgs("pattern", r.pattern)...)
+		}
+	}
+}
+
+// attachCancel ties cancel to the body of res, or calls it if the request
+// failed.
+func attachCancel(res *http.Response, err error, cancel context.CancelFunc) {
+	if err != nil || res == nil {
+		cancel()
+		return
+	}
+	res.Body = cancelOnClose{res.Body, cancel}
+}
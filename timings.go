@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// The phases of a request timed with -timings, in the order they happen.
+const (
+	phaseDNS      = "dns"
+	phaseConnect  = "connect"
+	phaseTLS      = "tls"
+	phaseTTFB     = "ttfb"
+	phaseTransfer = "transfer"
+)
+
+var phases = []string{phaseDNS, phaseConnect, phaseTLS, phaseTTFB, phaseTransfer}
+
+// phaseTimings are the durations of the phases of a request: the DNS
+// lookup, the TCP connection and the TLS handshake, which are zero when a
+// connection is reused or the phase wasn't needed, the time from the
+// request being sent to the first byte of the response, which is the
+// server's think time, and the time the body took to read. When the
+// request was redirected they are those of the last request.
+type phaseTimings struct {
+	DNS      time.Duration
+	Connect  time.Duration
+	TLS      time.Duration
+	TTFB     time.Duration
+	Transfer time.Duration
+
+	// Reused is set if the request went over a connection already open,
+	// so there was no DNS lookup, connection or handshake to time.
+	Reused bool
+}
+
+// get returns the duration of phase.
+func (t *phaseTimings) get(phase string) time.Duration {
+	switch phase {
+	case phaseDNS:
+		return t.DNS
+	case phaseConnect:
+		return t.Connect
+	case phaseTLS:
+		return t.TLS
+	case phaseTTFB:
+		return t.TTFB
+	case phaseTransfer:
+		return t.Transfer
+	}
+	return 0
+}
+
+// jsonTimings are the phaseTimings of a result. Phases that didn't happen
+// are left out.
+type jsonTimings struct {
+	DNSMs      float64 `json:"dns_ms,omitempty"`
+	ConnectMs  float64 `json:"connect_ms,omitempty"`
+	TLSMs      float64 `json:"tls_ms,omitempty"`
+	TTFBMs     float64 `json:"ttfb_ms,omitempty"`
+	TransferMs float64 `json:"transfer_ms,omitempty"`
+	Reused     bool    `json:"reused,omitempty"`
+}
+
+func (t *phaseTimings) json() *jsonTimings {
+	if t == nil {
+		return nil
+	}
+	return &jsonTimings{
+		DNSMs:      durationMs(t.DNS),
+		ConnectMs:  durationMs(t.Connect),
+		TLSMs:      durationMs(t.TLS),
+		TTFBMs:     durationMs(t.TTFB),
+		TransferMs: durationMs(t.Transfer),
+		Reused:     t.Reused,
+	}
+}
+
+func (jt *jsonTimings) timings() *phaseTimings {
+	if jt == nil {
+		return nil
+	}
+	ms := func(v float64) time.Duration { return time.Duration(v * float64(time.Millisecond)) }
+	return &phaseTimings{
+		DNS:      ms(jt.DNSMs),
+		Connect:  ms(jt.ConnectMs),
+		TLS:      ms(jt.TLSMs),
+		TTFB:     ms(jt.TTFBMs),
+		Transfer: ms(jt.TransferMs),
+		Reused:   jt.Reused,
+	}
+}
+
+// requestTrace times the phases of a request with httptrace. The callbacks
+// may be called from the goroutines dialing, so it is locked.
+type requestTrace struct {
+	mu sync.Mutex
+	t  phaseTimings
+
+	dnsStart, connectStart, tlsStart time.Time
+	wrote, firstByte                 time.Time
+}
+
+// withTrace returns ctx with a new requestTrace attached to time the
+// request made with it.
+func withTrace(ctx context.Context) (context.Context, *requestTrace) {
+	rt := &requestTrace{}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(string) {
+			// Every request of a redirect chain starts over, so the
+			// timings are those of the last one.
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			rt.t = phaseTimings{}
+			rt.dnsStart, rt.connectStart, rt.tlsStart = time.Time{}, time.Time{}, time.Time{}
+			rt.wrote, rt.firstByte = time.Time{}, time.Time{}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			rt.t.Reused = info.Reused
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			rt.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			rt.t.DNS = time.Since(rt.dnsStart)
+		},
+		ConnectStart: func(string, string) {
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			// With several addresses to try, the connection is timed
+			// from the first attempt.
+			if rt.connectStart.IsZero() {
+				rt.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			if err == nil && rt.t.Connect == 0 {
+				rt.t.Connect = time.Since(rt.connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			rt.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			rt.t.TLS = time.Since(rt.tlsStart)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			rt.wrote = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			rt.firstByte = time.Now()
+			if !rt.wrote.IsZero() {
+				rt.t.TTFB = rt.firstByte.Sub(rt.wrote)
+			}
+		},
+	}), rt
+}
+
+// finish returns the timings of the request, once its body has been read
+// or it failed. The transfer takes until the body was read, which includes
+// the time spent parsing it for links as it comes in.
+func (rt *requestTrace) finish() *phaseTimings {
+	if rt == nil {
+		return nil
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	t := rt.t
+	if !rt.firstByte.IsZero() {
+		t.Transfer = time.Since(rt.firstByte)
+	}
+	return &t
+}
+
+// jsonPhase is the spread of the durations of a phase over the requests
+// it happened in.
+type jsonPhase struct {
+	Count int     `json:"count"`
+	P50Ms float64 `json:"p50_ms"`
+	P95Ms float64 `json:"p95_ms"`
+	P99Ms float64 `json:"p99_ms"`
+}
+
+// jsonPhases returns the percentiles of every phase timed with -timings.
+func (s *stats) jsonPhases() map[string]jsonPhase {
+	if len(s.phases) == 0 {
+		return nil
+	}
+	res := make(map[string]jsonPhase, len(s.phases))
+	for phase, lat := range s.phases {
+		res[phase] = jsonPhase{
+			Count: lat.count(),
+			P50Ms: durationMs(lat.quantile(0.50)),
+			P95Ms: durationMs(lat.quantile(0.95)),
+			P99Ms: durationMs(lat.quantile(0.99)),
+		}
+	}
+	return res
+}
+
+// reportPhases writes the percentiles of every phase timed with -timings,
+// over the requests it happened in.
+func (c *Crawler) reportPhases(w io.Writer) {
+	s := c.stats
+	if len(s.phases) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "Request phases (p50 | p95 | p99):")
+	for _, phase := range phases {
+		lat := s.phases[phase]
+		if lat == nil || lat.count() == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "  %-10s %v | %v | %v over %d requests\n", phase+":",
+			roundPhase(lat.quantile(0.50)), roundPhase(lat.quantile(0.95)), roundPhase(lat.quantile(0.99)), lat.count())
+	}
+	if s.timed > 0 {
+		fmt.Fprintf(w, "  Reused connections: %d of %d requests, without DNS, connect or TLS phases\n", s.reusedConns, s.timed)
+	}
+}
+
+// roundPhase rounds a phase to a tenth of a millisecond, since some take
+// far less than one.
+func roundPhase(d time.Duration) time.Duration {
+	return d.Round(100 * time.Microsecond)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"math/rand"
+	"net/http"
+	"os"
+	"time"
+)
+
+// tracingEnabled reports whether spans should be exported, either because
+// -otel-endpoint is set or because the standard OTLP variables are.
+func tracingEnabled(cfg Config) bool {
+	return cfg.OTelEndpoint != "" ||
+		os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" ||
+		os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// setupTracing configures an OTLP/HTTP exporter and returns the tracer along
+// with a function that flushes pending spans.
+func setupTracing(cfg Config) (trace.Tracer, func(context.Context) error, error) {
+	var opts []otlptracehttp.Option
+	if cfg.OTelEndpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(cfg.OTelEndpoint))
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	v, _, _ := buildInfo()
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName("gowarmer"),
+		semconv.ServiceVersion(v),
+	))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(fetchSampler{ratio: cfg.OTelSampleRatio}),
+	)
+	return tp.Tracer("gowarmer"), tp.Shutdown, nil
+}
+
+// fetchSampler always samples the root span of a run and samples each fetch
+// span independently with the given ratio. The trace ID based samplers can't
+// be used for this since every fetch shares the run's trace ID.
+type fetchSampler struct {
+	ratio float64
+}
+
+func (s fetchSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	parent := trace.SpanContextFromContext(p.ParentContext)
+	decision := sdktrace.Drop
+	if !parent.IsValid() || rand.Float64() < s.ratio {
+		decision = sdktrace.RecordAndSample
+	}
+	return sdktrace.SamplingResult{Decision: decision, Tracestate: parent.TraceState()}
+}
+
+func (s fetchSampler) Description() string {
+	return "fetchSampler"
+}
+
+// traceContextHook propagates the span of the request's context to the
+// origin in the traceparent header.
+func traceContextHook(req *http.Request) error {
+	propagation.TraceContext{}.Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+	return nil
+}
+
+// startFetchSpan starts the span of a single fetch. It's a no-op returning a
+// nil span when tracing is disabled.
+func (c *Crawler) startFetchSpan(u string) (context.Context, trace.Span) {
+	if c.tracer == nil {
+		return c.runCtx, nil
+	}
+	return c.tracer.Start(c.runCtx, "GET",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPRequestMethodKey.String("GET"), semconv.URLFull(u)))
+}
+
+func endFetchSpan(span trace.Span, r Result, retries int) {
+	if span == nil {
+		return
+	}
+	span.SetAttributes(
+		attribute.Float64("gowarmer.response_time_ms", float64(r.ResponseTime)/float64(time.Millisecond)),
+		attribute.Int64("gowarmer.bytes", r.Size),
+		attribute.Int("gowarmer.retries", retries),
+	)
+	if r.Err != nil {
+		span.RecordError(r.Err)
+		span.SetStatus(codes.Error, r.Err.Error())
+	} else {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(r.StatusCode))
+		if r.StatusCode >= 500 {
+			span.SetStatus(codes.Error, r.Status)
+		}
+	}
+	span.End()
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Why -trap-detection throttled a pattern.
+const (
+	trapRepeatedSegment = "repeated_segment"
+	trapParamValues     = "param_values"
+	trapPatternURLs     = "pattern_urls"
+)
+
+// trapDigits matches the runs of digits collapsed in URL patterns, so that
+// /events/2031/05/ and /events/2031/06/ are the same pattern.
+var trapDigits = regexp.MustCompile(`[0-9]+`)
+
+// trapLimit is a -trap-limit override of -trap-max-pattern-urls for the
+// patterns of the URLs matching pattern, for large sections that are
+// legitimate.
+type trapLimit struct {
+	urlPattern
+	limit int
+}
+
+// parseTrapLimits parses -trap-limit values of the form "pattern=limit",
+// with patterns as compileURLPattern takes them.
+func parseTrapLimits(specs []string) ([]trapLimit, error) {
+	var res []trapLimit
+	for _, spec := range specs {
+		i := strings.LastIndex(spec, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid trap limit %q, expected pattern=limit", spec)
+		}
+		pattern := strings.TrimSpace(spec[:i])
+		limit, err := strconv.Atoi(strings.TrimSpace(spec[i+1:]))
+		if err != nil || limit <= 0 || pattern == "" {
+			return nil, fmt.Errorf("invalid trap limit %q, expected pattern=limit", spec)
+		}
+		l := trapLimit{limit: limit}
+		if l.urlPattern, err = compileURLPattern(pattern); err != nil {
+			return nil, fmt.Errorf("invalid trap limit %q: %w", spec, err)
+		}
+		res = append(res, l)
+	}
+	return res, nil
+}
+
+// trapThrottle is a pattern -trap-detection stopped following links to,
+// with the number of URLs it suppressed.
+type trapThrottle struct {
+	Pattern    string `json:"pattern"`
+	Reason     string `json:"reason"`
+	Limit      int    `json:"limit"`
+	Suppressed int    `json:"suppressed"`
+	// Example is the first URL suppressed.
+	Example string `json:"example"`
+}
+
+// trapDetector keeps a crawl out of infinite URL spaces, like calendars
+// linking to the next month forever, by capping the links followed: to URLs
+// with a path segment repeated more than maxRepeats times, to more than
+// maxParamValues distinct values of a query parameter on a path, and to
+// more than maxPatternURLs URLs of a pattern, the host and path with digits
+// collapsed. It is guarded by the crawler's lock.
+type trapDetector struct {
+	maxRepeats     int
+	maxParamValues int
+	maxPatternURLs int
+	limits         []trapLimit
+
+	patternURLs map[string]int
+	// paramValues are the values of every query parameter by path.
+	paramValues map[string]map[string]map[string]struct{}
+	throttled   map[string]*trapThrottle
+}
+
+// newTrapDetector returns the detector of -trap-detection, or nil if it is
+// off.
+func newTrapDetector(cfg Config) (*trapDetector, error) {
+	if !cfg.TrapDetection {
+		return nil, nil
+	}
+	limits, err := parseTrapLimits(cfg.TrapLimits)
+	if err != nil {
+		return nil, err
+	}
+	return &trapDetector{
+		maxRepeats:     cfg.TrapMaxRepeats,
+		maxParamValues: cfg.TrapMaxParamValues,
+		maxPatternURLs: cfg.TrapMaxPatternURLs,
+		limits:         limits,
+		patternURLs:    make(map[string]int),
+		paramValues:    make(map[string]map[string]map[string]struct{}),
+		throttled:      make(map[string]*trapThrottle),
+	}, nil
+}
+
+// trapPattern returns the pattern of u: its host and path with every run
+// of digits collapsed into {n}.
+func trapPattern(u *url.URL) string {
+	return u.Host + trapDigits.ReplaceAllString(u.EscapedPath(), "{n}")
+}
+
+// admit reports whether a link to u is followed, counting it against the
+// caps if it is. A cap of 0 is no cap.
+func (d *trapDetector) admit(u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return true
+	}
+	pattern := trapPattern(parsed)
+
+	if d.maxRepeats > 0 {
+		repeats := make(map[string]int)
+		for _, seg := range strings.Split(parsed.EscapedPath(), "/") {
+			if seg == "" {
+				continue
+			}
+			if repeats[seg]++; repeats[seg] > d.maxRepeats {
+				d.suppress(pattern, trapRepeatedSegment, d.maxRepeats, u)
+				return false
+			}
+		}
+	}
+
+	path := parsed.Host + parsed.EscapedPath()
+	var added [][2]string
+	if d.maxParamValues > 0 {
+		for name, values := range parsed.Query() {
+			seen := d.paramValues[path][name]
+			for _, v := range values {
+				if _, ok := seen[v]; ok {
+					continue
+				}
+				if len(seen) >= d.maxParamValues {
+					d.suppress(path+"?"+name+"=", trapParamValues, d.maxParamValues, u)
+					return false
+				}
+				added = append(added, [2]string{name, v})
+			}
+		}
+	}
+
+	limit := d.maxPatternURLs
+	for _, l := range d.limits {
+		if l.match(u) {
+			limit = l.limit
+			break
+		}
+	}
+	if limit > 0 && d.patternURLs[pattern] >= limit {
+		d.suppress(pattern, trapPatternURLs, limit, u)
+		return false
+	}
+
+	d.patternURLs[pattern]++
+	for _, a := range added {
+		if d.paramValues[path] == nil {
+			d.paramValues[path] = make(map[string]map[string]struct{})
+		}
+		if d.paramValues[path][a[0]] == nil {
+			d.paramValues[path][a[0]] = make(map[string]struct{})
+		}
+		d.paramValues[path][a[0]][a[1]] = struct{}{}
+	}
+	return true
+}
+
+// suppress counts u as suppressed by the pattern throttled for reason.
+func (d *trapDetector) suppress(pattern, reason string, limit int, u string) {
+	key := reason + " " + pattern
+	t := d.throttled[key]
+	if t == nil {
+		t = &trapThrottle{Pattern: pattern, Reason: reason, Limit: limit, Example: u}
+		d.throttled[key] = t
+		slog.Warn("possible crawler trap, not following more links to it", "pattern", pattern, "reason", reason, "limit", limit, "url", u)
+	}
+	t.Suppressed++
+}
+
+// list returns the throttled patterns, those that suppressed the most URLs
+// first.
+func (d *trapDetector) list() []trapThrottle {
+	if d == nil {
+		return nil
+	}
+	res := make([]trapThrottle, 0, len(d.throttled))
+	for _, t := range d.throttled {
+		res = append(res, *t)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Suppressed != res[j].Suppressed {
+			return res[i].Suppressed > res[j].Suppressed
+		}
+		return res[i].Reason+" "+res[i].Pattern < res[j].Reason+" "+res[j].Pattern
+	})
+	return res
+}
+
+// suppressed returns the number of URLs suppressed.
+func (d *trapDetector) suppressed() int {
+	if d == nil {
+		return 0
+	}
+	n := 0
+	for _, t := range d.throttled {
+		n += t.Suppressed
+	}
+	return n
+}
+
+// loadedTraps returns a detector holding the throttled patterns of a run
+// read back from its results, or nil if there are none.
+func loadedTraps(throttled []trapThrottle) *trapDetector {
+	if len(throttled) == 0 {
+		return nil
+	}
+	d := &trapDetector{throttled: make(map[string]*trapThrottle)}
+	d.add(throttled)
+	return d
+}
+
+// add adds throttled patterns to those of d.
+func (d *trapDetector) add(throttled []trapThrottle) {
+	for _, t := range throttled {
+		key := t.Reason + " " + t.Pattern
+		if prev := d.throttled[key]; prev != nil {
+			prev.Suppressed += t.Suppressed
+			continue
+		}
+		t := t
+		d.throttled[key] = &t
+	}
+}
+
+// reportTraps writes the patterns -trap-detection throttled and the URLs
+// they suppressed.
+func (c *Crawler) reportTraps(w io.Writer) {
+	throttled := c.traps.list()
+	if len(throttled) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nPossible crawler traps: %d URLs suppressed\n", c.traps.suppressed())
+	for i, t := range throttled {
+		if i == maxReportedFailures {
+			fmt.Fprintf(w, "  ... and %d more\n", len(throttled)-i)
+			break
+		}
+		var why string
+		switch t.Reason {
+		case trapRepeatedSegment:
+			why = fmt.Sprintf("a path segment repeated over %d times", t.Limit)
+		case trapParamValues:
+			why = fmt.Sprintf("over %d values", t.Limit)
+		default:
+			why = fmt.Sprintf("over %d URLs", t.Limit)
+		}
+		fmt.Fprintf(w, "  %s: %d suppressed, %s, e.g. %s\n", t.Pattern, t.Suppressed, why, t.Example)
+	}
+}
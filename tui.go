@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tuiInterval    = 500 * time.Millisecond
+	tuiRecent      = 15
+	tuiLogLines    = 5
+	tuiSparkWidth  = 60
+	tuiMaxURLWidth = 90
+)
+
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// tui is the full-screen view of a run shown with -tui: the counters, a
+// sparkline of response times, the most recent results and log messages.
+// It reads single keys from the terminal to pause and resume (p), skip the
+// host of the most recent result (s) and quit, printing the report (q).
+//
+// It only drives the run through the monitor, so the crawler doesn't know
+// about it.
+type tui struct {
+	m     monitor
+	w     io.Writer
+	in    *os.File
+	start time.Time
+	// success colors the statuses by -success-codes.
+	success successCodes
+
+	mu     sync.Mutex
+	recent []Result
+	logs   []string
+	// sparkline has the average response time of each interval, and
+	// pending the response times of the current one.
+	sparkline []time.Duration
+	pending   []time.Duration
+	message   string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newTUI(m monitor, w io.Writer, in *os.File) *tui {
+	return &tui{
+		m:     m,
+		w:     w,
+		in:    in,
+		start: time.Now(),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// record is a result listener.
+func (t *tui) record(r Result) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.recent = append(t.recent, r)
+	if len(t.recent) > tuiRecent {
+		t.recent = t.recent[len(t.recent)-tuiRecent:]
+	}
+	if r.Err == nil && !r.Fresh {
+		t.pending = append(t.pending, r.ResponseTime)
+	}
+}
+
+// Write keeps the last log messages to show them below the results.
+func (t *tui) Write(b []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+		t.logs = append(t.logs, line)
+	}
+	if len(t.logs) > tuiLogLines {
+		t.logs = t.logs[len(t.logs)-tuiLogLines:]
+	}
+	return len(b), nil
+}
+
+// run switches to the alternate screen and redraws it until finish is
+// called.
+func (t *tui) run() {
+	defer close(t.done)
+
+	keys := make(chan byte)
+	if restore := rawTerminal(t.in); restore != nil {
+		defer restore()
+		go readKeys(t.in, keys, t.stop)
+	}
+	fmt.Fprint(t.w, "\033[?1049h\033[?25l")
+	defer fmt.Fprint(t.w, "\033[?25h\033[?1049l")
+
+	ticker := time.NewTicker(tuiInterval)
+	defer ticker.Stop()
+	t.draw()
+	for {
+		select {
+		case <-ticker.C:
+			t.tick()
+			t.draw()
+		case k := <-keys:
+			t.key(k)
+			t.draw()
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+// finish stops the TUI and gives the terminal back as it was, so the
+// report is printed normally.
+func (t *tui) finish() {
+	close(t.stop)
+	<-t.done
+}
+
+func (t *tui) key(k byte) {
+	switch k {
+	case 'p', 'P':
+		if t.m.isPaused() {
+			t.m.resume()
+			t.setMessage("resumed")
+		} else {
+			t.m.pause()
+			t.setMessage("paused")
+		}
+	case 's', 'S':
+		host := t.currentHost()
+		if host == "" {
+			t.setMessage("no host to skip yet")
+			return
+		}
+		n := t.m.skipHost(host)
+		t.setMessage(fmt.Sprintf("skipped %s, dropped %d queued URLs", host, n))
+	case 'q', 'Q':
+		t.m.stop()
+		t.setMessage("quitting once the requests in flight finish")
+	}
+}
+
+func (t *tui) setMessage(s string) {
+	t.mu.Lock()
+	t.message = s
+	t.mu.Unlock()
+}
+
+// currentHost returns the host of the most recent result.
+func (t *tui) currentHost() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.recent) == 0 {
+		return ""
+	}
+	return taskHost(task{url: t.recent[len(t.recent)-1].URL})
+}
+
+// tick closes the current interval of the sparkline.
+func (t *tui) tick() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var avg time.Duration
+	if len(t.pending) > 0 {
+		var sum time.Duration
+		for _, d := range t.pending {
+			sum += d
+		}
+		avg = sum / time.Duration(len(t.pending))
+	}
+	t.pending = t.pending[:0]
+	t.sparkline = append(t.sparkline, avg)
+	if len(t.sparkline) > tuiSparkWidth {
+		t.sparkline = t.sparkline[len(t.sparkline)-tuiSparkWidth:]
+	}
+}
+
+func (t *tui) draw() {
+	done, errors, queued, total := t.m.counts()
+	paused := t.m.isPaused()
+	rate := t.m.requestRate(time.Now(), t.start)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var b bytes.Buffer
+	b.WriteString("\033[H\033[2J")
+	state := "running"
+	if paused {
+		state = colorize(colorYellow, "PAUSED")
+	}
+	fmt.Fprintf(&b, "gowarmer  %s  elapsed %v\r\n\r\n", state, time.Since(t.start).Round(time.Second))
+	fmt.Fprintf(&b, "%s   Errors %d   %.1f req/s", progressSummary(done, queued, total, rate), errors, rate)
+	if n := t.m.concurrency(); n > 0 {
+		fmt.Fprintf(&b, "   Concurrency %d", n)
+	}
+	b.WriteString("\r\n\r\n")
+
+	spark, peak := sparkline(t.sparkline)
+	fmt.Fprintf(&b, "Response times  %s  peak %v\r\n\r\n", spark, peak.Round(time.Millisecond))
+
+	b.WriteString("Recent:\r\n")
+	for i := len(t.recent) - 1; i >= 0; i-- {
+		r := t.recent[i]
+		u := r.URL
+		if len(u) > tuiMaxURLWidth {
+			u = u[:tuiMaxURLWidth-3] + "..."
+		}
+		var line string
+		switch {
+		case r.Fresh:
+			line = fmt.Sprintf("  FRESH %s", u)
+		case r.Err != nil:
+			line = fmt.Sprintf("  ERR %-7v %s", r.ResponseTime.Round(time.Millisecond), u)
+		default:
+			line = fmt.Sprintf("  %3d %-7v %6s %s", r.StatusCode, r.ResponseTime.Round(time.Millisecond), formatSize(r.Size), u)
+		}
+		b.WriteString(colorize(t.success.resultColor(r), line) + "\r\n")
+	}
+
+	if len(t.logs) > 0 {
+		b.WriteString("\r\nLog:\r\n")
+		for _, line := range t.logs {
+			fmt.Fprintf(&b, "  %s\r\n", line)
+		}
+	}
+
+	b.WriteString("\r\n")
+	if t.message != "" {
+		fmt.Fprintf(&b, "%s\r\n", t.message)
+	}
+	b.WriteString("p pause/resume   s skip the host of the latest URL   q quit and print the report")
+	t.w.Write(b.Bytes())
+}
+
+// sparkline draws durations as bars scaled to the largest of them, which it
+// returns as well.
+func sparkline(ds []time.Duration) (string, time.Duration) {
+	var peak time.Duration
+	for _, d := range ds {
+		peak = max(peak, d)
+	}
+	var b strings.Builder
+	for _, d := range ds {
+		i := 0
+		if peak > 0 {
+			i = int(float64(d) / float64(peak) * float64(len(sparkBars)-1))
+		}
+		b.WriteRune(sparkBars[i])
+	}
+	return b.String(), peak
+}
+
+// rawTerminal switches the terminal in to character mode without echo, so
+// single key presses can be read, and returns the function that restores
+// it. It returns nil if in isn't a terminal or its mode can't be changed.
+func rawTerminal(in *os.File) (restore func()) {
+	if !isTerminal(in) {
+		return nil
+	}
+	stty := func(args ...string) ([]byte, error) {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = in
+		return cmd.Output()
+	}
+	saved, err := stty("-g")
+	if err != nil {
+		return nil
+	}
+	if _, err := stty("-icanon", "-echo", "min", "1"); err != nil {
+		return nil
+	}
+	return func() {
+		stty(strings.TrimSpace(string(saved)))
+	}
+}
+
+// readKeys sends the bytes read from in to keys until it can't read or stop
+// is closed.
+func readKeys(in *os.File, keys chan<- byte, stop <-chan struct{}) {
+	buf := make([]byte, 1)
+	for {
+		n, err := in.Read(buf)
+		if err != nil || n == 0 {
+			return
+		}
+		select {
+		case keys <- buf[0]:
+		case <-stop:
+			return
+		}
+	}
+}
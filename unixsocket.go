@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// errUnixSocketTLS is the error of an https request with -unix-socket.
+var errUnixSocketTLS = errors.New("-unix-socket doesn't support https URLs, use http")
+
+// validateUnixSocket checks that -unix-socket is a socket and that the
+// URLs to warm and the other flags can go with it.
+func validateUnixSocket(cfg Config) error {
+	fi, err := os.Stat(cfg.UnixSocket)
+	if err != nil {
+		return fmt.Errorf("-unix-socket: %w", err)
+	}
+	if fi.Mode().Type() != os.ModeSocket {
+		return fmt.Errorf("-unix-socket: %s isn't a socket", cfg.UnixSocket)
+	}
+	if cfg.Proxy != "" || cfg.ProxyFile != "" {
+		return fmt.Errorf("-unix-socket can't be used with -proxy or -proxy-file")
+	}
+	if cfg.CheckExternal {
+		return fmt.Errorf("-check-external checks links to other hosts, which -unix-socket can't reach")
+	}
+	for _, u := range []string{cfg.StartURL, cfg.SitemapURL} {
+		if parsed, err := url.Parse(u); err == nil && parsed.Scheme == "https" {
+			return fmt.Errorf("%s: %w", u, errUnixSocketTLS)
+		}
+	}
+	return nil
+}
+
+// unixSocketTransport returns a transport connecting to the Unix socket at
+// path whatever the host of the URL, like curl --unix-socket. The URL and
+// Host header are sent as given, so the server sees the site it expects.
+func unixSocketTransport(path string) http.RoundTripper {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", path)
+	}
+	t.DialTLSContext = func(context.Context, string, string) (net.Conn, error) {
+		return nil, errUnixSocketTLS
+	}
+	return t
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// urlKey returns the form of u that decides whether two URLs are the same
+// page, whichever source they came from: the scheme and host are lowercased,
+// default ports, the fragment and a trailing slash are dropped, and percent
+// escapes are normalized, so "https://Example.com:443/%7Eme/" and
+// "https://example.com/~me" have the same key. The URL that is fetched keeps
+// the spelling it was first found with.
+func urlKey(u string) string {
+	return normalizeURL(u, true)
+}
+
+// redirectKey is urlKey keeping the trailing slash, since a redirect from
+// /about to /about/ goes somewhere else as far as the server is concerned.
+func redirectKey(u string) string {
+	return normalizeURL(u, false)
+}
+
+func normalizeURL(u string, trimSlash bool) string {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Opaque != "" || parsed.Host == "" {
+		return removeHashFromURL(u)
+	}
+
+	scheme := strings.ToLower(parsed.Scheme)
+	host := strings.ToLower(parsed.Hostname())
+	if port := parsed.Port(); port != "" && !(scheme == "http" && port == "80") && !(scheme == "https" && port == "443") {
+		host += ":" + port
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	path := normalizeEscapes(parsed.EscapedPath())
+	if trimSlash && len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	key := scheme + "://" + host + path
+	if parsed.RawQuery != "" {
+		key += "?" + normalizeEscapes(parsed.RawQuery)
+	}
+	return key
+}
+
+// normalizeEscapes decodes the percent escapes of unreserved characters,
+// which never change the meaning of a URL, and uppercases the others.
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteString(strings.ToUpper(s[i : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
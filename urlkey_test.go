@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestURLKey(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"https://example.com/a", "https://example.com/a/", true},
+		{"https://example.com/a", "https://EXAMPLE.com/a", true},
+		{"HTTPS://example.com/a", "https://example.com/a", true},
+		{"https://example.com:443/a", "https://example.com/a", true},
+		{"http://example.com:80/a", "http://example.com/a", true},
+		{"https://example.com/a#top", "https://example.com/a", true},
+		{"https://example.com/%7Eme", "https://example.com/~me", true},
+		{"https://example.com/a%2fb", "https://example.com/a%2Fb", true},
+		{"https://example.com", "https://example.com/", true},
+		{"https://Example.com:443/%7Eme/", "https://example.com/~me", true},
+		{"https://[::1]:443/a", "https://[::1]/a", true},
+
+		{"https://example.com/a", "http://example.com/a", false},
+		{"https://example.com:8443/a", "https://example.com/a", false},
+		{"http://example.com:443/a", "http://example.com/a", false},
+		{"https://example.com/a?x=1", "https://example.com/a", false},
+		{"https://example.com/A", "https://example.com/a", false},
+		{"https://example.com/a%2Fb", "https://example.com/a/b", false},
+	}
+	for _, tt := range tests {
+		ka, kb := urlKey(tt.a), urlKey(tt.b)
+		if (ka == kb) != tt.same {
+			t.Errorf("urlKey(%q) = %q, urlKey(%q) = %q, want same %v", tt.a, ka, tt.b, kb, tt.same)
+		}
+	}
+}
+
+func TestCrawlFetchesEverySpellingOfAPageOnce(t *testing.T) {
+	var hits hitCounter
+	var upper string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.count(r)
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			fmt.Fprintf(w, `<a href="/p">1</a><a href="/p/">2</a><a href="%s/p">3</a><a href="/%%70">4</a>`, upper)
+		}
+	}))
+	defer srv.Close()
+	// Crawled as localhost so that the host has letters to spell in
+	// another case. Default ports are left to TestURLKey.
+	start := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	upper = strings.Replace(srv.URL, "127.0.0.1", "LocalHost", 1)
+	c := newTestCrawler(t, func(cfg *Config) {
+		cfg.StartURL = start + "/"
+	})
+
+	runWithin(t, c, 10*time.Second)
+
+	if n := hits.get("/p") + hits.get("/p/") + hits.get("/%70"); n != 1 {
+		t.Errorf("/p fetched %d times in its spellings, want once", n)
+	}
+	if c.stats.pages != 2 {
+		t.Errorf("%d pages crawled, want 2", c.stats.pages)
+	}
+}
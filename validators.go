@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// validatorCache keeps the ETag and Last-Modified of every URL between runs
+// with -validator-cache, so that a URL is requested conditionally even
+// without the output of the previous run. It also keeps the links found
+// on each page, which a crawl follows when the page comes back 304 Not
+// Modified and has no body to find them in.
+//
+// It is read-only while the crawlers run and updated with their results
+// at the end.
+type validatorCache struct {
+	path string
+	// keep is the number of runs an entry survives without its URL being
+	// requested.
+	keep    int
+	entries map[string]*validatorEntry
+}
+
+// validatorEntry is the entry of a URL, by resultKey.
+type validatorEntry struct {
+	URL          string   `json:"url"`
+	ETag         string   `json:"etag,omitempty"`
+	LastModified string   `json:"last_modified,omitempty"`
+	Links        []string `json:"links,omitempty"`
+	// Missed counts the runs since the URL was last requested.
+	Missed int `json:"missed,omitempty"`
+}
+
+// loadValidatorCache reads the cache at path, which is empty if the file
+// doesn't exist yet.
+func loadValidatorCache(path string, keep int) (*validatorCache, error) {
+	vc := &validatorCache{path: path, keep: keep, entries: make(map[string]*validatorEntry)}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return vc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Entries map[string]*validatorEntry `json:"entries"`
+	}
+	if err := json.Unmarshal(b, &file); err != nil {
+		return nil, err
+	}
+	if file.Entries != nil {
+		vc.entries = file.Entries
+	}
+	return vc, nil
+}
+
+// conditional returns the headers that make the request for the URL of r
+// conditional, or nil if there are no validators for it.
+func (vc *validatorCache) conditional(key string) http.Header {
+	if vc == nil {
+		return nil
+	}
+	e, ok := vc.entries[key]
+	if !ok || e.ETag == "" && e.LastModified == "" {
+		return nil
+	}
+	h := make(http.Header)
+	if e.ETag != "" {
+		h.Set("If-None-Match", e.ETag)
+	}
+	if e.LastModified != "" {
+		h.Set("If-Modified-Since", e.LastModified)
+	}
+	return h
+}
+
+// links returns the links found on the page with the given key by the run
+// that last fetched it in full.
+func (vc *validatorCache) links(key string) []string {
+	if e, ok := vc.entries[key]; ok {
+		return e.Links
+	}
+	return nil
+}
+
+// update records the results of a crawler. A URL that failed keeps its
+// entry as it was, one that is gone or no longer has validators loses it.
+func (vc *validatorCache) update(c *Crawler) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	links := make(map[string][]string)
+	for _, r := range c.results {
+		if r.Referrer != "" && r.Err == nil {
+			from := resultKey(Result{Site: r.Site, URL: r.Referrer})
+			links[from] = append(links[from], r.URL)
+		}
+	}
+	for key, r := range c.results {
+		e, ok := vc.entries[key]
+		if !ok {
+			e = &validatorEntry{URL: r.URL}
+		}
+		e.Missed = -1
+		switch {
+		case r.Err != nil || r.Fresh:
+		case r.StatusCode == http.StatusNotModified:
+			// A 304 may come with new validators, but the links are
+			// those found when the page was last fetched in full.
+			if r.ETag != "" {
+				e.ETag = r.ETag
+			}
+			if r.LastModified != "" {
+				e.LastModified = r.LastModified
+			}
+		case r.StatusCode >= 400:
+			delete(vc.entries, key)
+			continue
+		default:
+			e.ETag, e.LastModified, e.Links = r.ETag, r.LastModified, links[key]
+		}
+		if e.ETag == "" && e.LastModified == "" {
+			delete(vc.entries, key)
+			continue
+		}
+		vc.entries[key] = e
+	}
+}
+
+// save prunes the entries of the URLs that haven't been requested in keep
+// runs and replaces the cache file with the rest, atomically.
+func (vc *validatorCache) save() error {
+	for key, e := range vc.entries {
+		// Entries updated in this run were marked with -1.
+		if e.Missed++; e.Missed > vc.keep {
+			delete(vc.entries, key)
+		}
+	}
+	b, err := json.Marshal(struct {
+		Entries map[string]*validatorEntry `json:"entries"`
+	}{vc.entries})
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(vc.path), filepath.Base(vc.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), vc.path)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// variantValues returns the values each request header is warmed with when
+// a response varies on it, from Encodings, Languages and Variants.
+func (cfg Config) variantValues() map[string][]string {
+	values := make(map[string][]string)
+	for name, v := range cfg.Variants {
+		values[http.CanonicalHeaderKey(name)] = v
+	}
+	if len(cfg.Encodings) > 0 {
+		values["Accept-Encoding"] = cfg.Encodings
+	}
+	if len(cfg.Languages) > 0 {
+		values["Accept-Language"] = cfg.Languages
+	}
+	return values
+}
+
+// varyHeaders returns the request headers a response varies on.
+func varyHeaders(h http.Header) []string {
+	var names []string
+	for _, value := range h.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" && name != "*" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// variantHeaders returns a header for every combination of the configured
+// values of the vary headers. Headers without configured values are left
+// out, and nil is returned if none of them has any.
+func (c *Crawler) variantHeaders(vary []string) []http.Header {
+	var names []string
+	for _, name := range vary {
+		if len(c.variants[name]) > 0 && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+
+	combos := []http.Header{{}}
+	for _, name := range names {
+		var next []http.Header
+		for _, h := range combos {
+			for _, v := range c.variants[name] {
+				h2 := h.Clone()
+				h2.Set(name, v)
+				next = append(next, h2)
+			}
+		}
+		combos = next
+	}
+	return combos
+}
+
+// warmVariants fetches r's URL once for every variant its response varies
+// on, on top of base, and records the outcome of each in r.Variants.
+func (c *Crawler) warmVariants(ctx context.Context, r *Result, vary []string, base http.Header) {
+	for _, variant := range c.variantHeaders(vary) {
+		header := base.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		for name, values := range variant {
+			header[name] = values
+		}
+
+		c.limiter.wait(c.runCtx)
+		res, err := c.sendRequest(ctx, r.URL, header)
+		outcome := describeVariant(variant)
+		if err != nil {
+			slog.Warn("fetching variant failed", "url", r.URL, "variant", outcome, "error", err)
+			outcome += ": " + err.Error()
+		} else {
+			c.drainAndClose(res.Body, res.Body)
+			slog.Debug("fetched variant", "url", r.URL, "variant", outcome, "status", res.StatusCode)
+			outcome += fmt.Sprintf(": %d", res.StatusCode)
+		}
+		r.Variants = append(r.Variants, outcome)
+	}
+}
+
+// varied returns the results whose variants were warmed, sorted by URL.
+func (c *Crawler) varied() []Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var res []Result
+	for _, r := range c.results {
+		if len(r.Variants) > 0 {
+			res = append(res, r)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return resultKey(res[i]) < resultKey(res[j]) })
+	return res
+}
+
+// describeVariant formats a variant as e.g. "Accept-Encoding=br Accept-Language=de".
+func describeVariant(h http.Header) string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + "=" + h.Get(name)
+	}
+	return strings.Join(parts, " ")
+}
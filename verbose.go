@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// verboseWriter writes a line for every completed URL with -v, e.g.
+//
+//	[1423 done / 310 queued] 200 142ms 18KB https://example.com/products/widget
+type verboseWriter struct {
+	mu    sync.Mutex
+	w     io.Writer
+	m     monitor
+	color bool
+	// success colors the statuses by -success-codes.
+	success successCodes
+}
+
+func newVerboseWriter(w io.Writer, m monitor, color bool) *verboseWriter {
+	return &verboseWriter{w: w, m: m, color: color}
+}
+
+func (vw *verboseWriter) write(r Result) {
+	done, _, queued, _ := vw.m.counts()
+
+	var line string
+	switch {
+	case r.Fresh:
+		line = fmt.Sprintf("FRESH %s", r.URL)
+	case r.Err != nil:
+		class := r.ErrClass
+		if class == "" {
+			class = errOther
+		}
+		line = fmt.Sprintf("ERR %s %v %s: %v", class, r.ResponseTime.Round(time.Millisecond), r.URL, r.Err)
+	default:
+		line = fmt.Sprintf("%d %v %s %s", r.StatusCode, r.ResponseTime.Round(time.Millisecond), formatSize(r.Size), r.URL)
+		if r.FinalURL != "" {
+			line += " -> " + r.FinalURL
+		}
+	}
+	line = fmt.Sprintf("[%d done / %d queued] %s", done, queued, line)
+	names := make([]string, 0, len(r.CapturedHeaders))
+	for name := range r.CapturedHeaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		line += fmt.Sprintf(" %s=%s", name, strings.Join(r.CapturedHeaders[name], ","))
+	}
+
+	if vw.color {
+		line = colorize(vw.success.resultColor(r), line)
+	}
+
+	vw.mu.Lock()
+	defer vw.mu.Unlock()
+	fmt.Fprintln(vw.w, line)
+}
+
+// formatSize formats a number of bytes, e.g. 18KB.
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%dKB", n>>10)
+	}
+	return fmt.Sprintf("%dB", n)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// verification is the outcome of re-requesting warmed URLs to check that
+// they are now served from the cache.
+type verification struct {
+	// header is the cache status header checked, or empty if hits were
+	// judged by response time.
+	header string
+
+	checked int
+	hits    int
+	failed  int
+	misses  []string
+
+	speedupSum   float64
+	speedupCount int
+}
+
+func (v *verification) hitRatio() float64 {
+	if v.checked == 0 {
+		return 0
+	}
+	return float64(v.hits) / float64(v.checked)
+}
+
+func (v *verification) avgSpeedup() float64 {
+	if v.speedupCount == 0 {
+		return 0
+	}
+	return v.speedupSum / float64(v.speedupCount)
+}
+
+func (v *verification) merge(o *verification) {
+	v.checked += o.checked
+	v.hits += o.hits
+	v.failed += o.failed
+	v.misses = append(v.misses, o.misses...)
+	v.speedupSum += o.speedupSum
+	v.speedupCount += o.speedupCount
+}
+
+// timeHitSpeedup is how much faster the second request must be to count as
+// a hit when there is no cache status header to go by.
+const timeHitSpeedup = 2
+
+// verify re-requests the successfully warmed URLs, or VerifySample of
+// them, and records whether each one was a cache hit: by CacheHeader if it
+// is set, otherwise by being at least timeHitSpeedup times faster than the
+// first time. Links aren't extracted again.
+func (c *Crawler) verify() {
+	var urls []Result
+	for _, r := range c.results {
+		if r.Err == nil && r.StatusCode < 400 && !r.Fresh {
+			urls = append(urls, r)
+		}
+	}
+	if c.VerifySample > 0 && c.VerifySample < len(urls) {
+		rand.Shuffle(len(urls), func(i, j int) { urls[i], urls[j] = urls[j], urls[i] })
+		urls = urls[:c.VerifySample]
+	}
+
+	v := &verification{header: c.CacheHeader}
+	slog.Info("verifying", c.logArgs("urls", len(urls))...)
+
+	work := make(chan Result)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < max(1, c.MaxConcurrency); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for first := range work {
+				hit, speedup, err := c.verifyURL(first)
+				mu.Lock()
+				switch {
+				case err != nil:
+					v.failed++
+					slog.Warn("verification request failed", "url", first.URL, "error", err)
+				default:
+					v.checked++
+					if hit {
+						v.hits++
+					} else {
+						v.misses = append(v.misses, first.URL)
+					}
+					if speedup > 0 {
+						v.speedupSum += speedup
+						v.speedupCount++
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, r := range urls {
+		work <- r
+	}
+	close(work)
+	wg.Wait()
+
+	sort.Strings(v.misses)
+	c.lock.Lock()
+	c.verification = v
+	c.lock.Unlock()
+}
+
+func (c *Crawler) verifyURL(first Result) (hit bool, speedup float64, err error) {
+	c.limiter.wait(c.runCtx)
+
+	start := time.Now()
+	res, err := c.sendRequest(c.runCtx, first.URL, nil)
+	responseTime := time.Since(start)
+	if err != nil {
+		return false, 0, err
+	}
+	c.drainAndClose(res.Body, res.Body)
+
+	if responseTime > 0 && first.ResponseTime > 0 {
+		speedup = float64(first.ResponseTime) / float64(responseTime)
+	}
+	if c.CacheHeader != "" {
+		hit = isCacheHit(res.Header, c.CacheHeader)
+	} else {
+		hit = speedup >= timeHitSpeedup
+	}
+	slog.Debug("verified", "url", first.URL, "status", res.StatusCode, "hit", hit, "duration", responseTime)
+	return hit, speedup, nil
+}
+
+// isCacheHit reports whether the cache status header says HIT, as Varnish
+// (X-Cache: HIT), Cloudflare (CF-Cache-Status: HIT) and most CDNs put it.
+func isCacheHit(h http.Header, name string) bool {
+	return strings.Contains(strings.ToUpper(h.Get(name)), "HIT")
+}
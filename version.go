@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Set at build time with
+// -ldflags "-X main.version=... -X main.commit=... -X main.date=...".
+var (
+	version = ""
+	commit  = ""
+	date    = ""
+)
+
+// buildInfo returns the version, commit and build date, falling back to the
+// information the Go toolchain embeds when they weren't set at build time.
+func buildInfo() (v, c, d string) {
+	v, c, d = version, commit, date
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			v = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && c == "":
+				c = s.Value
+			case s.Key == "vcs.time" && d == "":
+				d = s.Value
+			}
+		}
+	}
+	if v == "" {
+		v = "dev"
+	}
+	if len(c) > 12 {
+		c = c[:12]
+	}
+	return v, c, d
+}
+
+func versionString() string {
+	v, c, d := buildInfo()
+	s := "gowarmer " + v
+	if c != "" {
+		s += fmt.Sprintf(" (commit %s", c)
+		if d != "" {
+			s += ", built " + d
+		}
+		s += ")"
+	}
+	return s
+}
+
+// userAgent identifies the crawler build in origin logs.
+func userAgent() string {
+	v, _, _ := buildInfo()
+	return "CacheWarmer/1.0 gowarmer/" + v
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// warcDate is the format of WARC-Date.
+const warcDate = "2006-01-02T15:04:05Z"
+
+// warcWriter writes the responses of a run as WARC 1.1 records, a request
+// and a response record for each, after a warcinfo record. With a .gz file
+// name every record is compressed as a gzip member of its own, as WARC
+// readers expect. It is shared by the crawlers of a multi-site run.
+type warcWriter struct {
+	limit int64
+
+	mu      sync.Mutex
+	f       *os.File
+	buf     *bufio.Writer
+	gzip    bool
+	records int
+	err     error
+}
+
+func createWARC(path string, limit int64) (*warcWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &warcWriter{limit: limit, f: f, buf: bufio.NewWriter(f), gzip: strings.HasSuffix(path, ".gz")}
+	v, _, _ := buildInfo()
+	if v == "" {
+		v = "devel"
+	}
+	info := fmt.Sprintf("software: gowarmer/%s\r\nformat: WARC File Format 1.1\r\nconformsTo: https://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\n", v)
+	w.record([][2]string{
+		{"WARC-Type", "warcinfo"},
+		{"WARC-Date", time.Now().UTC().Format(warcDate)},
+		{"WARC-Filename", filepath.Base(path)},
+		{"WARC-Record-ID", warcRecordID()},
+		{"Content-Type", "application/warc-fields"},
+	}, []byte(info))
+	if w.err != nil {
+		f.Close()
+		return nil, w.err
+	}
+	return w, nil
+}
+
+// warcCapture is the body of a response being read, kept to be written
+// with the response once it is complete.
+type warcCapture struct {
+	res       *http.Response
+	fetched   time.Time
+	body      bytes.Buffer
+	limit     int64
+	truncated bool
+}
+
+// capture starts keeping the body of res, up to the -max-body-size limit.
+func (w *warcWriter) capture(res *http.Response, fetched time.Time) *warcCapture {
+	if w == nil {
+		return nil
+	}
+	return &warcCapture{res: res, fetched: fetched, limit: w.limit}
+}
+
+func (c *warcCapture) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := c.limit - int64(c.body.Len()); int64(len(p)) > room {
+		p = p[:max(room, 0)]
+		c.truncated = true
+	}
+	c.body.Write(p)
+	return n, nil
+}
+
+// write adds the request and response records of a capture.
+func (w *warcWriter) write(c *warcCapture) error {
+	res := c.res
+	var req bytes.Buffer
+	fmt.Fprintf(&req, "%s %s HTTP/1.1\r\n", res.Request.Method, res.Request.URL.RequestURI())
+	fmt.Fprintf(&req, "Host: %s\r\n", res.Request.URL.Host)
+	header := res.Request.Header.Clone()
+	// The credentials don't belong in an archive.
+	header.Del("Authorization")
+	header.Write(&req)
+	req.WriteString("\r\n")
+
+	var resp bytes.Buffer
+	fmt.Fprintf(&resp, "%s %s\r\n", res.Proto, res.Status)
+	res.Header.Write(&resp)
+	resp.WriteString("\r\n")
+	resp.Write(c.body.Bytes())
+
+	target := res.Request.URL.String()
+	date := c.fetched.UTC().Format(warcDate)
+	responseID := warcRecordID()
+	responseFields := [][2]string{
+		{"WARC-Type", "response"},
+		{"WARC-Record-ID", responseID},
+		{"WARC-Date", date},
+		{"WARC-Target-URI", target},
+		{"Content-Type", "application/http;msgtype=response"},
+		{"WARC-Payload-Digest", warcDigest(c.body.Bytes())},
+		{"WARC-Block-Digest", warcDigest(resp.Bytes())},
+	}
+	if c.truncated {
+		responseFields = append(responseFields, [2]string{"WARC-Truncated", "length"})
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.record(responseFields, resp.Bytes())
+	w.record([][2]string{
+		{"WARC-Type", "request"},
+		{"WARC-Record-ID", warcRecordID()},
+		{"WARC-Date", date},
+		{"WARC-Target-URI", target},
+		{"WARC-Concurrent-To", responseID},
+		{"Content-Type", "application/http;msgtype=request"},
+		{"WARC-Block-Digest", warcDigest(req.Bytes())},
+	}, req.Bytes())
+	return w.err
+}
+
+// writeWARC writes a capture and counts it.
+func (c *Crawler) writeWARC(captured *warcCapture) {
+	if err := c.warc.write(captured); err != nil {
+		slog.Error("writing the WARC file failed", "url", captured.res.Request.URL.String(), "error", err)
+		return
+	}
+	c.lock.Lock()
+	c.warcResponses++
+	c.lock.Unlock()
+}
+
+// record writes a record with the given named fields and block. The caller
+// holds w.mu, except while the writer is created. After an error nothing
+// more is written.
+func (w *warcWriter) record(fields [][2]string, block []byte) {
+	if w.err != nil {
+		return
+	}
+	var out io.Writer = w.buf
+	var zw *gzip.Writer
+	if w.gzip {
+		zw = gzip.NewWriter(w.buf)
+		out = zw
+	}
+	var b bytes.Buffer
+	b.WriteString("WARC/1.1\r\n")
+	for _, f := range fields {
+		fmt.Fprintf(&b, "%s: %s\r\n", f[0], f[1])
+	}
+	fmt.Fprintf(&b, "Content-Length: %d\r\n\r\n", len(block))
+	b.Write(block)
+	b.WriteString("\r\n\r\n")
+	if _, err := out.Write(b.Bytes()); err != nil {
+		w.err = err
+		return
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			w.err = err
+			return
+		}
+	}
+	w.records++
+}
+
+// close flushes and closes the file and returns the number of records
+// written.
+func (w *warcWriter) close() (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.err
+	if ferr := w.buf.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return w.records, err
+}
+
+// warcRecordID returns a new WARC-Record-ID, a random UUID URN.
+func warcRecordID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// warcDigest returns the SHA-1 digest of b in the base32 form WARC readers
+// expect.
+func warcDigest(b []byte) string {
+	sum := sha1.Sum(b)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
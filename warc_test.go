@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// warcRecord is a record read back from a WARC file.
+type warcRecord struct {
+	fields map[string]string
+	block  []byte
+}
+
+// readWARCRecords parses the records of r, failing the test on anything
+// that isn't WARC 1.1.
+func readWARCRecords(t *testing.T, r io.Reader) []warcRecord {
+	t.Helper()
+	br := bufio.NewReader(r)
+	var records []warcRecord
+	for {
+		version, err := br.ReadString('\n')
+		if err == io.EOF && version == "" {
+			return records
+		}
+		if version != "WARC/1.1\r\n" {
+			t.Fatalf("record %d starts with %q, want WARC/1.1", len(records), version)
+		}
+		rec := warcRecord{fields: make(map[string]string)}
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				t.Fatalf("record %d: reading the fields: %v", len(records), err)
+			}
+			if line == "\r\n" {
+				break
+			}
+			name, value, ok := strings.Cut(strings.TrimSuffix(line, "\r\n"), ": ")
+			if !ok {
+				t.Fatalf("record %d: malformed field %q", len(records), line)
+			}
+			rec.fields[name] = value
+		}
+		n, err := strconv.Atoi(rec.fields["Content-Length"])
+		if err != nil {
+			t.Fatalf("record %d: Content-Length %q", len(records), rec.fields["Content-Length"])
+		}
+		rec.block = make([]byte, n)
+		if _, err := io.ReadFull(br, rec.block); err != nil {
+			t.Fatalf("record %d: reading the block: %v", len(records), err)
+		}
+		end := make([]byte, 4)
+		if _, err := io.ReadFull(br, end); err != nil || string(end) != "\r\n\r\n" {
+			t.Fatalf("record %d ends with %q, want two CRLFs", len(records), end)
+		}
+		records = append(records, rec)
+	}
+}
+
+func TestWARCRecords(t *testing.T) {
+	pages := map[string]string{
+		"/":        `<a href="/a">a</a><a href="/missing">missing</a>`,
+		"/a":       `<p>the body of a</p>`,
+		"/missing": "404 page not found\n",
+	}
+	for _, name := range []string{"out.warc", "out.warc.gz"} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/missing" {
+					http.NotFound(w, r)
+					return
+				}
+				w.Header().Set("Content-Type", "text/html")
+				fmt.Fprint(w, pages[r.URL.Path])
+			}))
+			defer srv.Close()
+			path := filepath.Join(t.TempDir(), name)
+			warc, err := createWARC(path, 1<<20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := newTestCrawler(t, func(cfg *Config) {
+				cfg.StartURL = srv.URL + "/"
+				cfg.Username, cfg.Password = "user", "secret"
+			})
+			c.warc = warc
+			runWithin(t, c, 10*time.Second)
+			written, err := warc.close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var r io.Reader = bytes.NewReader(data)
+			if strings.HasSuffix(name, ".gz") {
+				// Every record is a gzip member of its own.
+				members := 0
+				zr, err := gzip.NewReader(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var all bytes.Buffer
+				for {
+					zr.Multistream(false)
+					if _, err := io.Copy(&all, zr); err != nil {
+						t.Fatal(err)
+					}
+					members++
+					if err := zr.Reset(r); err == io.EOF {
+						break
+					} else if err != nil {
+						t.Fatal(err)
+					}
+				}
+				if members != written {
+					t.Errorf("%d gzip members for %d records", members, written)
+				}
+				r = &all
+			}
+			records := readWARCRecords(t, r)
+
+			if len(records) != written || written != 1+2*len(pages) {
+				t.Fatalf("%d records read, %d written, want a warcinfo and two per page (%d)", len(records), written, 1+2*len(pages))
+			}
+			if typ := records[0].fields["WARC-Type"]; typ != "warcinfo" {
+				t.Errorf("first record a %s, want warcinfo", typ)
+			}
+			ids := make(map[string]bool)
+			responses := make(map[string]warcRecord)
+			for i, rec := range records {
+				id := rec.fields["WARC-Record-ID"]
+				if !strings.HasPrefix(id, "<urn:uuid:") || ids[id] {
+					t.Errorf("record %d: WARC-Record-ID %q not a new UUID URN", i, id)
+				}
+				ids[id] = true
+				if _, err := time.Parse(warcDate, rec.fields["WARC-Date"]); err != nil {
+					t.Errorf("record %d: WARC-Date: %v", i, err)
+				}
+				if digest, ok := rec.fields["WARC-Block-Digest"]; ok && digest != warcDigest(rec.block) {
+					t.Errorf("record %d: WARC-Block-Digest %s, want %s", i, digest, warcDigest(rec.block))
+				}
+				if rec.fields["WARC-Type"] == "response" {
+					responses[id] = rec
+				}
+			}
+
+			for _, rec := range records[1:] {
+				target := rec.fields["WARC-Target-URI"]
+				switch rec.fields["WARC-Type"] {
+				case "response":
+					res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(rec.block)), nil)
+					if err != nil {
+						t.Fatalf("%s: response block: %v", target, err)
+					}
+					body, _ := io.ReadAll(res.Body)
+					if want := pages[strings.TrimPrefix(target, srv.URL)]; string(body) != want {
+						t.Errorf("%s: body %q, want %q", target, body, want)
+					}
+					if digest := rec.fields["WARC-Payload-Digest"]; digest != warcDigest(body) {
+						t.Errorf("%s: WARC-Payload-Digest %s, want %s", target, digest, warcDigest(body))
+					}
+				case "request":
+					if _, ok := responses[rec.fields["WARC-Concurrent-To"]]; !ok {
+						t.Errorf("%s: request concurrent to %q, not a response", target, rec.fields["WARC-Concurrent-To"])
+					}
+					req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(rec.block)))
+					if err != nil {
+						t.Fatalf("%s: request block: %v", target, err)
+					}
+					if req.Header.Get("Authorization") != "" {
+						t.Errorf("%s: credentials in the request record", target)
+					}
+					if got := "http://" + req.Host + req.URL.RequestURI(); got != target {
+						t.Errorf("request for %s recorded for %s", got, target)
+					}
+				default:
+					t.Errorf("a %s record after the warcinfo", rec.fields["WARC-Type"])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// webhookAttempts is how many times delivery is tried before giving up.
+const webhookAttempts = 3
+
+// maxWebhookErrors caps the failed pages listed in the payload.
+const maxWebhookErrors = 100
+
+type webhookPage struct {
+	URL            string  `json:"url"`
+	StatusCode     int     `json:"status,omitempty"`
+	ResponseTimeMs float64 `json:"response_time_ms"`
+	Error          string  `json:"error,omitempty"`
+}
+
+type webhookPayload struct {
+	RunID      string        `json:"run_id"`
+	ExitStatus int           `json:"exit_status"`
+	Summary    jsonSummary   `json:"summary"`
+	Errors     []webhookPage `json:"errors"`
+	WorstPages []webhookPage `json:"worst_pages"`
+}
+
+func newRunID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b)
+}
+
+func (c *Crawler) webhookPayload(crawlTime time.Duration, exitStatus int) webhookPayload {
+	p := webhookPayload{
+		RunID:      c.runID,
+		ExitStatus: exitStatus,
+		Summary:    c.jsonSummary(crawlTime),
+		Errors:     []webhookPage{},
+		WorstPages: []webhookPage{},
+	}
+
+	var ok []Result
+	for _, r := range c.results {
+		page := webhookPage{URL: r.URL, StatusCode: r.StatusCode, ResponseTimeMs: durationMs(r.ResponseTime)}
+		if !c.succeeded(r) {
+			if r.Err != nil {
+				page.Error = r.Err.Error()
+			}
+			p.Errors = append(p.Errors, page)
+		} else if !r.Fresh {
+			ok = append(ok, r)
+		}
+	}
+	sort.Slice(p.Errors, func(i, j int) bool { return p.Errors[i].URL < p.Errors[j].URL })
+	if len(p.Errors) > maxWebhookErrors {
+		p.Errors = p.Errors[:maxWebhookErrors]
+	}
+
+	sort.Slice(ok, func(i, j int) bool {
+		if ok[i].ResponseTime != ok[j].ResponseTime {
+			return ok[i].ResponseTime > ok[j].ResponseTime
+		}
+		return ok[i].URL < ok[j].URL
+	})
+	for i := 0; i < len(ok) && i < 10; i++ {
+		p.WorstPages = append(p.WorstPages, webhookPage{URL: ok[i].URL, StatusCode: ok[i].StatusCode, ResponseTimeMs: durationMs(ok[i].ResponseTime)})
+	}
+	return p
+}
+
+// sendWebhook POSTs the run results to c.Webhook, retrying a couple of times
+// on failure. When WebhookSecret is set the body is signed with HMAC-SHA256
+// and the signature sent as "X-Gowarmer-Signature: sha256=<hex>".
+func (c *Crawler) sendWebhook(crawlTime time.Duration, exitStatus int) error {
+	body, err := json.Marshal(c.webhookPayload(crawlTime, exitStatus))
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: c.WebhookTimeout}
+	for attempt := 1; ; attempt++ {
+		err = c.postWebhook(client, body)
+		if err == nil || attempt == webhookAttempts {
+			return err
+		}
+		slog.Warn("webhook delivery failed, retrying", "url", c.Webhook, "attempt", attempt, "error", err)
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+}
+
+func (c *Crawler) postWebhook(client *http.Client, body []byte) error {
+	req, err := http.NewRequest("POST", c.Webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent())
+	for name, value := range c.WebhookHeaders {
+		req.Header.Set(name, value)
+	}
+	if c.WebhookSecret != "" {
+		mac := hmac.New(sha256.New, []byte(c.WebhookSecret))
+		mac.Write(body)
+		req.Header.Set("X-Gowarmer-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
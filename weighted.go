@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// trafficWeights are the weights of the URLs of a -weighted-file, such as
+// their pageviews, by urlKey, and how much of their total was warmed.
+type trafficWeights struct {
+	byKey  map[string]float64
+	total  float64
+	warmed float64
+}
+
+// weightedRow is a URL of a -weighted-file with its weight.
+type weightedRow struct {
+	url    string
+	weight float64
+}
+
+// readWeightedFile reads a CSV of url,weight rows. Rows that are blank or
+// start with # are ignored, and so is a first row whose weight isn't a
+// number, taken as a header. Malformed rows are logged with their line
+// number and skipped. The weights of URLs listed more than once, as
+// urlKey sees them, add up.
+func readWeightedFile(path string) ([]weightedRow, error) {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	r := csv.NewReader(in)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	var rows []weightedRow
+	index := make(map[string]int)
+	for first := true; ; first = false {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			slog.Warn("skipping malformed row of the weighted file", "path", path, "line", parseErr.StartLine, "error", parseErr.Err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := r.FieldPos(0)
+		row, err := parseWeightedRow(record)
+		if err != nil {
+			if !first || len(record) != 2 {
+				slog.Warn("skipping malformed row of the weighted file", "path", path, "line", line, "error", err)
+			}
+			continue
+		}
+		key := urlKey(removeHashFromURL(row.url))
+		if i, ok := index[key]; ok {
+			rows[i].weight += row.weight
+			continue
+		}
+		index[key] = len(rows)
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func parseWeightedRow(record []string) (weightedRow, error) {
+	if len(record) != 2 {
+		return weightedRow{}, fmt.Errorf("expected url,weight, got %d fields", len(record))
+	}
+	u := strings.TrimSpace(record[0])
+	if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+		return weightedRow{}, fmt.Errorf("%q isn't an http or https URL", u)
+	}
+	weight, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+	if err != nil || weight < 0 {
+		return weightedRow{}, fmt.Errorf("%q isn't a weight", record[1])
+	}
+	return weightedRow{url: u, weight: weight}, nil
+}
+
+// processWeightedFile schedules the URLs of a -weighted-file, the heaviest
+// first, or only the WeightedTop heaviest if set. The weight of every row
+// counts towards the total the report compares the warmed URLs with, so
+// the URLs left out count as not warmed.
+func (c *Crawler) processWeightedFile(path string) error {
+	rows, err := readWeightedFile(path)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].weight > rows[j].weight })
+
+	tw := &trafficWeights{byKey: make(map[string]float64, len(rows))}
+	for _, row := range rows {
+		tw.total += row.weight
+	}
+	if c.WeightedTop > 0 && len(rows) > c.WeightedTop {
+		rows = rows[:c.WeightedTop]
+	}
+	for _, row := range rows {
+		tw.byKey[urlKey(removeHashFromURL(row.url))] = row.weight
+	}
+	c.lock.Lock()
+	c.traffic = tw
+	c.lock.Unlock()
+
+	for _, row := range rows {
+		c.scheduleTask(task{url: row.url, priority: row.weight})
+	}
+	return nil
+}
+
+// recordTraffic adds the weight of the URL of r to the warmed weight if it
+// was warmed successfully. The caller holds the lock.
+func (c *Crawler) recordTraffic(r Result) {
+	if c.traffic == nil || !c.succeeded(r) {
+		return
+	}
+	key := urlKey(r.URL)
+	c.traffic.warmed += c.traffic.byKey[key]
+	// A URL is only counted once, however many times it is fetched.
+	delete(c.traffic.byKey, key)
+}
+
+// reportTraffic writes the share of the total weight of a -weighted-file
+// that was warmed.
+func (c *Crawler) reportTraffic(w io.Writer) {
+	tw := c.traffic
+	if tw == nil || tw.total <= 0 {
+		return
+	}
+	fmt.Fprintf(w, "Weighted coverage: warmed URLs representing %.1f%% of the recorded weight (%s of %s)\n",
+		tw.warmed/tw.total*100, formatWeight(tw.warmed), formatWeight(tw.total))
+}
+
+func formatWeight(w float64) string {
+	return strconv.FormatFloat(w, 'f', -1, 64)
+}